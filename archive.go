@@ -0,0 +1,222 @@
+package rotating
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// archiveMarkerSuffix is appended to the name of a file that has been
+// rotated out to create a marker that records that the file has not been
+// archived yet, so that it is archived (and kept from being purged) by
+// the next process if this one exits before
+const archiveMarkerSuffix = `_archive`
+
+// defaultArchiveTimeout bounds each call to Archive, unless specified
+// otherwise by WithArchiveTimeout
+const defaultArchiveTimeout = 10 * time.Minute
+
+// Archiver hands over the files that have been rotated out to another
+// system, e.g. by uploading them to object storage, as specified by
+// WithArchiver. Archive is called with the path of each file once it is
+// complete (and compressed, with WithCompress or WithCompressor), and
+// must only return nil once the file has been handed over, as the file
+// may be purged from then on. The archiver may remove the file itself.
+//
+// The context is canceled when the context passed to NewFile is, or when
+// the timeout specified by WithArchiveTimeout expires.
+type Archiver interface {
+	Archive(ctx context.Context, path string) error
+}
+
+// ArchiverFunc is an Archiver implemented by a function
+type ArchiverFunc func(context.Context, string) error
+
+func (fn ArchiverFunc) Archive(ctx context.Context, path string) error {
+	return fn(ctx, path)
+}
+
+// archiveEntry is a file that has been rotated out as previous, and is
+// archived as filename (which differs if it has been compressed)
+type archiveEntry struct {
+	previous string
+	filename string
+}
+
+// archiveSet records the files that have been rotated out but not
+// archived yet, which are excluded from the retention policy, and the
+// files that failed to be archived, which are retried
+type archiveSet struct {
+	mu     sync.Mutex
+	names  map[string]struct{}
+	failed []archiveEntry
+}
+
+func newArchiveSet() *archiveSet {
+	return &archiveSet{names: make(map[string]struct{})}
+}
+
+func (s *archiveSet) add(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range names {
+		s.names[name] = struct{}{}
+	}
+}
+
+func (s *archiveSet) remove(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range names {
+		delete(s.names, name)
+	}
+}
+
+func (s *archiveSet) list() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (s *archiveSet) fail(e archiveEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = append(s.failed, e)
+}
+
+func (s *archiveSet) takeFailed() []archiveEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failed := s.failed
+	s.failed = nil
+	return failed
+}
+
+// unarchivedNames returns the names that the file rotated out as previous
+// may have until it has been archived
+func (f *File) unarchivedNames(previous string) []string {
+	if f.compressor == nil {
+		return []string{previous}
+	}
+	return []string{previous, previous + f.compressor.Suffix()}
+}
+
+// markUnarchived records that the file rotated out as previous has to be
+// archived, both in memory and on disk.
+// It must be called while holding the lock
+func (f *File) markUnarchived(previous string) {
+	f.unarchived.add(f.unarchivedNames(previous)...)
+
+	fh, err := createFile(f.fs, previous+archiveMarkerSuffix, os.O_WRONLY, f.create)
+	if err != nil {
+		f.handleError(fileError(OpArchive, previous, errors.Wrap(err, `failed to create marker`)))
+		return
+	}
+	_ = fh.Close()
+}
+
+// archive hands over the given file, which was rotated out as previous,
+// to the Archiver specified by WithArchiver, after retrying the files
+// that failed to be archived before.
+// It is run from the archive worker
+func (f *File) archive(previous, filename string) error {
+	for _, e := range f.unarchived.takeFailed() {
+		if err := f.archiveFile(e.previous, e.filename); err != nil {
+			f.handleError(err)
+		}
+	}
+	return f.archiveFile(previous, filename)
+}
+
+// archiveFile makes a single attempt to archive the given file. Until it
+// succeeds, both previous and the file are kept from being purged, and
+// the file is queued to be retried.
+// It is run from the archive worker
+func (f *File) archiveFile(previous, filename string) error {
+	ctx, cancel := f.archiveContext()
+	defer cancel()
+
+	if err := f.archiver.Archive(ctx, filename); err != nil {
+		f.unarchived.fail(archiveEntry{previous: previous, filename: filename})
+		return fileError(OpArchive, filename, err)
+	}
+
+	f.unarchived.remove(f.unarchivedNames(previous)...)
+	if err := f.fs.Remove(previous + archiveMarkerSuffix); err != nil && !os.IsNotExist(err) {
+		return fileError(OpArchive, filename, errors.Wrap(err, `failed to remove marker`))
+	}
+	return nil
+}
+
+func (f *File) archiveContext() (context.Context, context.CancelFunc) {
+	if f.archiveTimeout > 0 {
+		return context.WithTimeout(f.parentCtx, f.archiveTimeout)
+	}
+	return context.WithCancel(f.parentCtx)
+}
+
+// recoverArchives queues the files that were rotated out, but not
+// archived, by a previous process, as recorded by their markers
+func (f *File) recoverArchives() {
+	markers, err := f.fs.Glob(f.globPattern + archiveMarkerSuffix)
+	if err != nil {
+		f.handleError(fileError(OpArchive, f.globPattern, err))
+		return
+	}
+
+	for _, marker := range markers {
+		previous := strings.TrimSuffix(marker, archiveMarkerSuffix)
+		f.unarchived.add(f.unarchivedNames(previous)...)
+		f.archiving.push(func() error {
+			return f.recoverArchive(previous)
+		})
+	}
+}
+
+// recoverArchive archives the file that was rotated out as previous by a
+// previous process, compressing it first if it has not been yet.
+// It is run from the archive worker
+func (f *File) recoverArchive(previous string) error {
+	if current, _ := f.activeName.Load().(string); current == previous {
+		// The file is written to again, and is archived once it is
+		// rotated out
+		return nil
+	}
+
+	var name string
+	if _, err := f.fs.Stat(previous); err == nil {
+		name = previous
+		if f.compressor != nil {
+			compressed, err := f.compress(previous)
+			if err != nil {
+				f.handleError(fileError(OpCompress, previous, err))
+			} else if compressed != "" {
+				name = compressed
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return fileError(OpArchive, previous, err)
+	} else if f.compressor != nil {
+		if _, err := f.fs.Stat(previous + f.compressor.Suffix()); err == nil {
+			name = previous + f.compressor.Suffix()
+		}
+	}
+
+	if name == "" {
+		// The file is gone, so there is nothing left to archive
+		f.unarchived.remove(f.unarchivedNames(previous)...)
+		if err := f.fs.Remove(previous + archiveMarkerSuffix); err != nil && !os.IsNotExist(err) {
+			return fileError(OpArchive, previous, errors.Wrap(err, `failed to remove marker`))
+		}
+		return nil
+	}
+	return f.archiveFile(previous, name)
+}
@@ -0,0 +1,290 @@
+// Package azblobrotate uploads the files that have been rotated out by a
+// *rotating.File to Azure Blob Storage as block blobs.
+//
+// The Uploader talks to the Blob service REST API directly using
+// net/http, and authenticates with a shared access signature (SAS): the
+// container URL passed to New carries the SAS token as its query string,
+// e.g. "https://account.blob.core.windows.net/logs?sv=...&sig=...". The
+// token needs the create and write permissions.
+//
+// Files up to the block size are uploaded with a single Put Blob request.
+// Larger files are uploaded in blocks (Put Block), which are committed
+// together (Put Block List) once all of them have been uploaded, so the
+// blob never contains a partial file.
+package azblobrotate
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+)
+
+// DefaultBlockSize is the size of the blocks that large files are
+// uploaded in, unless specified otherwise
+const DefaultBlockSize = 4 << 20
+
+// maxBlocks is the maximum number of blocks in a block blob
+const maxBlocks = 50000
+
+// apiVersion is the version of the Blob service REST API that is used
+const apiVersion = `2020-10-02`
+
+// Options configures the Uploader
+type Options struct {
+	// Prefix is prepended to the base names of the files to form the
+	// names of the blobs, e.g. "app/"
+	Prefix string
+
+	// BlockSize is the size of the blocks that files larger than it are
+	// uploaded in. If zero, DefaultBlockSize is used
+	BlockSize int
+
+	// DeleteLocal specifies that files are removed once they have been
+	// uploaded successfully
+	DeleteLocal bool
+
+	// Timeout bounds the time spent uploading each file. If zero, the
+	// uploads are not bounded
+	Timeout time.Duration
+
+	// HTTPClient is used to send the requests. If nil,
+	// http.DefaultClient is used
+	HTTPClient *http.Client
+
+	// ErrorHandler is called with the errors that occur while uploading
+	// the files handed over by RotateHook. If nil, they are discarded
+	ErrorHandler func(error)
+}
+
+// Uploader uploads files to a container
+type Uploader struct {
+	container   *url.URL
+	prefix      string
+	blockSize   int
+	deleteLocal bool
+	timeout     time.Duration
+	client      *http.Client
+	onError     func(error)
+}
+
+// New creates a new Uploader that uploads files to the container at the
+// given URL, which must include the SAS token. If opts is nil, the
+// default options are used.
+func New(containerURL string, opts *Options) (*Uploader, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	u, err := url.Parse(containerURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, `azblobrotate: failed to parse container URL`)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf(`azblobrotate: container URL must be absolute`)
+	}
+
+	blockSize := opts.BlockSize
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Uploader{
+		container:   u,
+		prefix:      opts.Prefix,
+		blockSize:   blockSize,
+		deleteLocal: opts.DeleteLocal,
+		timeout:     opts.Timeout,
+		client:      client,
+		onError:     opts.ErrorHandler,
+	}, nil
+}
+
+// Blob returns the name of the blob that the given file is uploaded to
+func (u *Uploader) Blob(filename string) string {
+	return u.prefix + filepath.Base(filename)
+}
+
+// Upload uploads the given file, and removes it afterwards if
+// DeleteLocal was specified
+func (u *Uploader) Upload(ctx context.Context, filename string) error {
+	if u.timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, u.timeout)
+		defer cancel()
+	}
+
+	fh, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrapf(err, `azblobrotate: failed to open file %s`, filename)
+	}
+	defer fh.Close()
+
+	fi, err := fh.Stat()
+	if err != nil {
+		return errors.Wrapf(err, `azblobrotate: failed to stat file %s`, filename)
+	}
+
+	blob := u.Blob(filename)
+	if fi.Size() <= int64(u.blockSize) {
+		err = u.putBlob(ctx, blob, fh, fi.Size())
+	} else {
+		err = u.putBlocks(ctx, blob, fh, fi.Size())
+	}
+	if err != nil {
+		return errors.Wrapf(err, `azblobrotate: failed to upload file %s to blob %s`, filename, blob)
+	}
+
+	if u.deleteLocal {
+		if err := os.Remove(filename); err != nil {
+			return errors.Wrapf(err, `azblobrotate: failed to remove uploaded file %s`, filename)
+		}
+	}
+	return nil
+}
+
+// putBlob uploads the whole file with a single request
+func (u *Uploader) putBlob(ctx context.Context, blob string, body io.Reader, size int64) error {
+	req, err := u.newRequest(ctx, blob, nil, body, size)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(`x-ms-blob-type`, `BlockBlob`)
+	return u.do(req)
+}
+
+// putBlocks uploads the file in blocks, and commits them
+func (u *Uploader) putBlocks(ctx context.Context, blob string, r io.Reader, size int64) error {
+	count := (size + int64(u.blockSize) - 1) / int64(u.blockSize)
+	if count > maxBlocks {
+		return errors.Errorf(`file requires %d blocks of %d bytes, more than the maximum of %d`, count, u.blockSize, maxBlocks)
+	}
+
+	var list blockList
+	buf := make([]byte, u.blockSize)
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			// All the IDs of a blob must have the same length
+			id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(`%08d`, i)))
+			query := url.Values{"comp": {"block"}, "blockid": {id}}
+			req, rerr := u.newRequest(ctx, blob, query, bytes.NewReader(buf[:n]), int64(n))
+			if rerr != nil {
+				return rerr
+			}
+			if rerr := u.do(req); rerr != nil {
+				return errors.Wrapf(rerr, `failed to upload block %d`, i)
+			}
+			list.Latest = append(list.Latest, id)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, `failed to read file`)
+		}
+	}
+
+	body, err := xml.Marshal(list)
+	if err != nil {
+		return errors.Wrap(err, `failed to encode block list`)
+	}
+	body = append([]byte(xml.Header), body...)
+	req, err := u.newRequest(ctx, blob, url.Values{"comp": {"blocklist"}}, bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(`Content-Type`, `application/xml`)
+	if err := u.do(req); err != nil {
+		return errors.Wrap(err, `failed to commit block list`)
+	}
+	return nil
+}
+
+type blockList struct {
+	XMLName xml.Name `xml:"BlockList"`
+	Latest  []string `xml:"Latest"`
+}
+
+// newRequest creates a PUT request for the given blob. The query is
+// added to the SAS token of the container URL
+func (u *Uploader) newRequest(ctx context.Context, blob string, query url.Values, body io.Reader, size int64) (*http.Request, error) {
+	target := *u.container
+	target.Path = path.Join(target.Path, blob)
+	target.RawPath = ""
+	if len(query) > 0 {
+		values := target.Query()
+		for k, v := range query {
+			values[k] = v
+		}
+		target.RawQuery = values.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodPut, target.String(), body)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create request`)
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = size
+	req.Header.Set(`x-ms-version`, apiVersion)
+	req.Header.Set(`x-ms-date`, time.Now().UTC().Format(http.TimeFormat))
+	return req, nil
+}
+
+// do sends the request, and returns an error unless the blob service
+// responded with 201 Created
+func (u *Uploader) do(req *http.Request) error {
+	res, err := u.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, `failed to send request`)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+		return errors.Errorf(`unexpected response %s: %s`, res.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	return nil
+}
+
+// RotateHook uploads the file that has been rotated out. Pass it to
+// rotating.WithRotateHook to upload each file once it is complete:
+//
+//	f, err := rotating.NewFile(ctx, pattern, rotating.WithRotateHook(uploader.RotateHook))
+//
+// The upload is performed synchronously by the goroutine that calls the
+// hook, so the background tasks of the File that follow it (e.g. purging
+// old files) wait for it.
+func (u *Uploader) RotateHook(info rotating.RotationInfo) {
+	if err := u.Upload(context.Background(), info.Previous); err != nil && u.onError != nil {
+		u.onError(err)
+	}
+}
+
+// Archive uploads the given file. It implements rotating.Archiver, so the
+// Uploader can be passed to rotating.WithArchiver, which keeps the files
+// from being purged until they have been uploaded:
+//
+//	f, err := rotating.NewFile(ctx, pattern, rotating.WithArchiver(uploader))
+func (u *Uploader) Archive(ctx context.Context, filename string) error {
+	return u.Upload(ctx, filename)
+}
@@ -0,0 +1,193 @@
+package azblobrotate_test
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/lestrrat-go/rotating/azblobrotate"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeService implements the subset of the Blob service API that the
+// Uploader uses
+type fakeService struct {
+	mu       sync.Mutex
+	blobs    map[string]string
+	blocks   map[string]string
+	requests []string
+}
+
+func newFakeService() *fakeService {
+	return &fakeService{
+		blobs:  make(map[string]string),
+		blocks: make(map[string]string),
+	}
+}
+
+func (s *fakeService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	if r.Method != http.MethodPut || query.Get("sig") != "secret" || r.Header.Get("x-ms-version") == "" {
+		http.Error(w, "AuthenticationFailed", http.StatusForbidden)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comp := query.Get("comp")
+	s.requests = append(s.requests, comp)
+	switch comp {
+	case "":
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			http.Error(w, "MissingRequiredHeader", http.StatusBadRequest)
+			return
+		}
+		s.blobs[r.URL.Path] = string(body)
+	case "block":
+		s.blocks[r.URL.Path+"/"+query.Get("blockid")] = string(body)
+	case "blocklist":
+		var list struct {
+			Latest []string `xml:"Latest"`
+		}
+		if err := xml.Unmarshal(body, &list); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var sb strings.Builder
+		for _, id := range list.Latest {
+			block, ok := s.blocks[r.URL.Path+"/"+id]
+			if !ok {
+				http.Error(w, "InvalidBlockList", http.StatusBadRequest)
+				return
+			}
+			sb.WriteString(block)
+		}
+		s.blobs[r.URL.Path] = sb.String()
+	default:
+		http.Error(w, "UnsupportedQueryParameter", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+var _ rotating.Archiver = (*azblobrotate.Uploader)(nil)
+
+func TestUploader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "azblobrotate_test")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	service := newFakeService()
+	srv := httptest.NewServer(service)
+	defer srv.Close()
+
+	var errs []error
+	uploader, err := azblobrotate.New(srv.URL+"/logs?sv=2020-10-02&sig=secret", &azblobrotate.Options{
+		Prefix:       "app/",
+		BlockSize:    16,
+		DeleteLocal:  true,
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	if !assert.NoError(t, err, `azblobrotate.New should succeed`) {
+		return
+	}
+
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(rotating.ClockFn(func() time.Time {
+			return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		})),
+		rotating.WithRotateHook(uploader.RotateHook),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	// The first file fits in a single block, the second one does not
+	fmt.Fprintf(f, "Hello, World\n")
+	if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+		return
+	}
+	large := strings.Repeat("0123456789\n", 5)
+	fmt.Fprint(f, large)
+	if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+		return
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	if !assert.Empty(t, errs, `there should be no errors`) {
+		return
+	}
+	expected := map[string]string{
+		"/logs/app/20210101.log":   "Hello, World\n",
+		"/logs/app/20210101.log.1": large,
+	}
+	if !assert.Equal(t, expected, service.blobs, `uploaded blobs should match`) {
+		return
+	}
+	if !assert.Equal(t, []string{"", "block", "block", "block", "block", "blocklist"}, service.requests, `requests should match`) {
+		return
+	}
+	for _, name := range []string{"20210101.log", "20210101.log.1"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !assert.True(t, os.IsNotExist(err), `the uploaded file should have been removed`) {
+			return
+		}
+	}
+}
+
+func TestUploaderError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "azblobrotate_test-Error")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log")
+	if !assert.NoError(t, ioutil.WriteFile(filename, []byte("Hello, World\n"), 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	srv := httptest.NewServer(newFakeService())
+	defer srv.Close()
+
+	// The SAS token is missing
+	uploader, err := azblobrotate.New(srv.URL+"/logs", &azblobrotate.Options{DeleteLocal: true})
+	if !assert.NoError(t, err, `azblobrotate.New should succeed`) {
+		return
+	}
+	err = uploader.Upload(context.Background(), filename)
+	if !assert.Error(t, err, `uploader.Upload should fail`) {
+		return
+	}
+	if !assert.Contains(t, err.Error(), `AuthenticationFailed`, `the error should include the response`) {
+		return
+	}
+	if _, err := os.Stat(filename); !assert.NoError(t, err, `the file should be kept if the upload failed`) {
+		return
+	}
+}
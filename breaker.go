@@ -0,0 +1,67 @@
+package rotating
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// circuitBreaker keeps track of consecutive failures to write to the
+// primary file. Once the number of failures reaches the threshold, the
+// breaker opens, and writes fail immediately until the cool-down period
+// has elapsed. The next write after that is attempted normally, and
+// either closes the breaker, or opens it for another cool-down period.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+func (b *circuitBreaker) allow(now time.Time) bool {
+	return b.failures < b.threshold || !now.Before(b.openUntil)
+}
+
+// failure records a failure, and returns true if the breaker was opened
+func (b *circuitBreaker) failure(now time.Time) bool {
+	b.failures++
+	if b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.failures = 0
+}
+
+// writePrimary writes a single record to the primary file, going through
+// the circuit breaker if one has been configured.
+// It must be called while holding the lock
+func (f *File) writePrimary(ctx context.Context, bufs [][]byte, size int) (int64, error) {
+	b := f.breaker
+	if b == nil {
+		return f.writeDiskFull(ctx, bufs, size)
+	}
+
+	now := f.clock.Now()
+	if !b.allow(now) {
+		f.stats.CircuitOpen++
+		return 0, &CircuitOpenError{Until: b.openUntil}
+	}
+
+	n, err := f.writeDiskFull(ctx, bufs, size)
+	switch {
+	case err == nil:
+		b.success()
+	case ctx.Err() != nil:
+		// The caller gave up, which says nothing about the file system
+	default:
+		if b.failure(now) {
+			f.handleError(errors.Wrapf(err, `circuit breaker opened until %s`, b.openUntil.Format(time.RFC3339)))
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,120 @@
+package rotating
+
+import (
+	"bufio"
+	"io"
+)
+
+// bufferedWriter buffers writes to the underlying file. Flush only
+// flushes the buffer, whereas Sync and Close are delegated to the
+// underlying file after flushing the buffer.
+type bufferedWriter struct {
+	*bufio.Writer
+	dst io.Writer
+}
+
+func newBufferedWriter(dst io.Writer, size int) *bufferedWriter {
+	return &bufferedWriter{
+		Writer: bufio.NewWriterSize(dst, size),
+		dst:    dst,
+	}
+}
+
+// writeBuffers writes bufs as a single record. If the record does not
+// fit in the space available in the buffer, the buffer is flushed first
+// so that the record is not split across two writes to the underlying
+// file. Records that are larger than the buffer itself bypass the buffer.
+func (w *bufferedWriter) writeBuffers(bufs [][]byte) (int64, error) {
+	var size int
+	for _, buf := range bufs {
+		size += len(buf)
+	}
+
+	if size > w.Available() && w.Buffered() > 0 {
+		if err := w.Flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	if size > w.Available() {
+		return writeVec(w.dst, bufs)
+	}
+	return writeVecGeneric(w.Writer, bufs)
+}
+
+// Unwrap returns the underlying writer
+func (w *bufferedWriter) Unwrap() io.Writer {
+	return w.dst
+}
+
+func (w *bufferedWriter) Sync() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if v, ok := w.dst.(interface{ Sync() error }); ok {
+		return v.Sync()
+	}
+	return nil
+}
+
+func (w *bufferedWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		if v, ok := w.dst.(io.Closer); ok {
+			_ = v.Close()
+		}
+		return err
+	}
+	if v, ok := w.dst.(io.Closer); ok {
+		return v.Close()
+	}
+	return nil
+}
+
+// unwrapWriter returns the innermost writer by following the chain of
+// writers that provide an Unwrap method
+func unwrapWriter(w io.Writer) io.Writer {
+	for {
+		v, ok := w.(interface{ Unwrap() io.Writer })
+		if !ok {
+			return w
+		}
+		w = v.Unwrap()
+	}
+}
+
+// Buffered returns the number of bytes that have been written, but
+// are still sitting in the buffer (see WithBufferSize), waiting to be
+// flushed to the underlying file.
+func (f *File) Buffered() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if v, ok := f.file.(interface{ Buffered() int }); ok {
+		return v.Buffered()
+	}
+	return 0
+}
+
+// Flush writes any buffered data to the underlying file.
+func (f *File) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if v, ok := f.file.(interface{ Flush() error }); ok {
+		return v.Flush()
+	}
+	return nil
+}
+
+// Sync writes any buffered data to the underlying file, and commits the
+// contents of the file to stable storage (see os.File.Sync), e.g. at
+// checkpoints after which the data must survive a crash.
+func (f *File) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	return fileError(OpSync, f.filename, flushWriter(f.file))
+}
@@ -0,0 +1,225 @@
+// Command rotating reads from the standard input, and writes to a file
+// that is rotated using github.com/lestrrat-go/rotating. It can be used
+// much like Apache's rotatelogs or cronolog, so that processes that are
+// not written in Go can use the same rotation engine:
+//
+//	app | rotating -max-size 100MB -interval 24h -count 7 /var/log/app/%Y%m%d.log
+//
+// Lines can be routed to separate files using regular expressions, in
+// which case the pattern must contain {label}, which is replaced with the
+// label of each route. Lines that do not match any of the routes are
+// written to the file of the default label. The files are reopened when
+// SIGHUP is received, and those that are not written to can be closed
+// using -idle-timeout:
+//
+//	app | rotating -route '^ERROR=error' -default-label app /var/log/app/{label}-%Y%m%d.log
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+)
+
+func main() {
+	if err := _main(); err != nil {
+		fmt.Fprintf(os.Stderr, "rotating: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func _main() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-sigCh:
+			// Closing stdin makes run flush and close the file
+			os.Stdin.Close()
+		}
+	}()
+
+	return run(ctx, os.Args[1:], os.Stdin, os.Stderr)
+}
+
+// run parses the command line arguments, and copies everything read from
+// in to the rotating files
+func run(ctx context.Context, args []string, in io.Reader, stderr io.Writer) error {
+	fs := flag.NewFlagSet("rotating", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: rotating [options] pattern\n")
+		fs.PrintDefaults()
+	}
+
+	var maxSize string
+	var interval time.Duration
+	var count int
+	var maxAge time.Duration
+	var symlink string
+	var bufferSize int
+	var checkInterval time.Duration
+	var utc bool
+	var routes routeList
+	var dfltLabel string
+	var idleTimeout time.Duration
+	var maxOpenFiles int
+	fs.StringVar(&maxSize, "max-size", "", "rotate files when they reach the given size (e.g. 100MB)")
+	fs.DurationVar(&interval, "interval", 0, "rotate files at the given interval (e.g. 24h)")
+	fs.IntVar(&count, "count", 0, "number of files to retain")
+	fs.DurationVar(&maxAge, "max-age", 0, "maximum age of the files to retain")
+	fs.StringVar(&symlink, "symlink", "", "path of the symlink to the current file")
+	fs.IntVar(&bufferSize, "buffer", 0, "size of the write buffer in bytes")
+	fs.DurationVar(&checkInterval, "check-interval", 0, "interval between checks of the file size")
+	fs.BoolVar(&utc, "utc", false, "use UTC for the file names")
+	fs.Var(&routes, "route", "write lines matching REGEX to the file of LABEL, given as REGEX=LABEL (may be repeated)")
+	fs.StringVar(&dfltLabel, "default-label", "default", "label of the file for the lines that do not match any route")
+	fs.DurationVar(&idleTimeout, "idle-timeout", 0, "close the files of labels that have not been written to for the given duration")
+	fs.IntVar(&maxOpenFiles, "max-open-files", 0, "maximum number of files of labels to keep open at the same time")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New(`exactly one pattern is required`)
+	}
+
+	// Lines are never split across two files
+	options := []rotating.Option{rotating.WithRecordDelimiter('\n')}
+	if maxSize != "" {
+		size, err := parseSize(maxSize)
+		if err != nil {
+			return errors.Wrap(err, `invalid value for -max-size`)
+		}
+		options = append(options, rotating.WithMaxFileSize(size))
+	}
+	if interval > 0 {
+		options = append(options, rotating.WithMaxInterval(interval))
+	}
+	if count > 0 {
+		options = append(options, rotating.WithRotationCount(count))
+	}
+	if maxAge > 0 {
+		options = append(options, rotating.WithMaxAge(maxAge))
+	}
+	if bufferSize > 0 {
+		options = append(options, rotating.WithBufferSize(bufferSize))
+	}
+	if checkInterval > 0 {
+		options = append(options, rotating.WithCheckInterval(checkInterval))
+	}
+	if utc {
+		options = append(options, rotating.WithClock(rotating.UTC()))
+	}
+	options = append(options, rotating.WithErrorHandler(func(err error) {
+		fmt.Fprintf(stderr, "rotating: %s\n", err)
+	}))
+
+	pattern := fs.Arg(0)
+	if len(routes) == 0 && !strings.Contains(pattern, rotating.LabelPlaceholder) {
+		if symlink != "" {
+			options = append(options, rotating.WithSymlink(symlink))
+		}
+		f, err := rotating.NewFile(ctx, pattern, options...)
+		if err != nil {
+			return errors.Wrap(err, `failed to create file`)
+		}
+		if err := copyLines(f, in); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	if idleTimeout > 0 {
+		options = append(options, rotating.WithIdleEviction(idleTimeout))
+	}
+	if maxOpenFiles > 0 {
+		options = append(options, rotating.WithMaxOpenFiles(maxOpenFiles))
+	}
+	// The symlink only points to the default file
+	if symlink != "" {
+		options = append(options, rotating.WithLabelOptions(func(label string) []rotating.Option {
+			if label != dfltLabel {
+				return nil
+			}
+			return []rotating.Option{rotating.WithSymlink(symlink)}
+		}))
+	}
+	r, err := newRouter(ctx, pattern, routes, dfltLabel, options...)
+	if err != nil {
+		return err
+	}
+	r.reloadOnSignal()
+
+	if err := copyLines(r, in); err != nil {
+		r.Close()
+		return err
+	}
+	return r.Close()
+}
+
+// copyLines copies in to dst, writing one line at a time so that each
+// line is a separate record
+func copyLines(dst io.Writer, in io.Reader) error {
+	rdr := bufio.NewReader(in)
+	for {
+		line, err := rdr.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, werr := dst.Write(line); werr != nil {
+				return errors.Wrap(werr, `failed to write line`)
+			}
+		}
+		if err != nil {
+			if err == io.EOF || errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return errors.Wrap(err, `failed to read input`)
+		}
+	}
+}
+
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"B", 1},
+}
+
+// parseSize parses sizes such as "100MB". Units are powers of 1024
+func parseSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(v, unit.suffix) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, `invalid size %q`, s)
+	}
+	return n * multiplier, nil
+}
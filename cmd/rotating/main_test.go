@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating-cmd-")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Each line exceeds the max size, so every line goes to its own file
+	var stderr bytes.Buffer
+	in := strings.NewReader("hello\nworld\n")
+	args := []string{"-max-size", "1B", "-check-interval", "1ns", "-symlink", filepath.Join(dir, "current"), filepath.Join(dir, "app.log")}
+	if !assert.NoError(t, run(context.Background(), args, in, &stderr), `run should succeed`) {
+		return
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "app.log*"))
+	if !assert.NoError(t, err, `filepath.Glob should succeed`) {
+		return
+	}
+	if !assert.Len(t, matches, 2, `there should be 2 files`) {
+		return
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "current"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "world\n", string(content), `symlink should point to the last file`) {
+		return
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	testcases := [][]string{
+		{},
+		{"-max-size", "lots", "app.log"},
+		{"a.log", "b.log"},
+		{"-route", "no-pattern", "app.log"},
+		{"-route", "[=error.log", "app.log"},
+		{"-route", "^ERROR=error", "app.log"},
+		{"-route", "^ERROR=../error", "{label}.log"},
+	}
+	for _, args := range testcases {
+		var stderr bytes.Buffer
+		if !assert.Error(t, run(context.Background(), args, strings.NewReader(""), &stderr), `run should fail for %q`, args) {
+			return
+		}
+	}
+}
+
+func TestRunRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating-cmd-")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	var stderr bytes.Buffer
+	in := strings.NewReader("INFO started\nERROR failed\nWARN slow\nERROR failed again\n")
+	args := []string{
+		"-route", "^ERROR=error",
+		"-route", "^WARN=warn",
+		"-default-label", "app",
+		"-symlink", filepath.Join(dir, "current"),
+		filepath.Join(dir, "{label}.log"),
+	}
+	if !assert.NoError(t, run(context.Background(), args, in, &stderr), `run should succeed`) {
+		return
+	}
+
+	expected := map[string]string{
+		"app.log":   "INFO started\n",
+		"error.log": "ERROR failed\nERROR failed again\n",
+		"warn.log":  "WARN slow\n",
+		"current":   "INFO started\n",
+	}
+	for name, want := range expected {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, want, string(content), `content of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func TestRouterReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating-cmd-")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	var routes routeList
+	if !assert.NoError(t, routes.Set("^ERROR=error"), `routes.Set should succeed`) {
+		return
+	}
+	r, err := newRouter(context.Background(), filepath.Join(dir, "{label}.log"), routes, "app")
+	if !assert.NoError(t, err, `newRouter should succeed`) {
+		return
+	}
+	defer r.Close()
+
+	if _, err := r.Write([]byte("ERROR before\n")); !assert.NoError(t, err, `r.Write should succeed`) {
+		return
+	}
+
+	// Reloading the configuration reopens the file that has been moved away
+	if !assert.NoError(t, os.Rename(filepath.Join(dir, "error.log"), filepath.Join(dir, "error.log.1")), `os.Rename should succeed`) {
+		return
+	}
+	config := r.config()
+	if !assert.Len(t, config, 2, `there should be a label per route plus the default one`) {
+		return
+	}
+	if !assert.NoError(t, r.m.Reload(config), `r.m.Reload should succeed`) {
+		return
+	}
+
+	if _, err := r.Write([]byte("ERROR after\n")); !assert.NoError(t, err, `r.Write should succeed`) {
+		return
+	}
+	if !assert.NoError(t, r.Close(), `r.Close should succeed`) {
+		return
+	}
+
+	expected := map[string]string{
+		"error.log.1": "ERROR before\n",
+		"error.log":   "ERROR after\n",
+	}
+	for name, want := range expected {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, want, string(content), `content of %s should match`, name) {
+			return
+		}
+	}
+}
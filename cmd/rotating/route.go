@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+)
+
+// route sends the lines matching re to the file of label
+type route struct {
+	re    *regexp.Regexp
+	label string
+}
+
+// routeList is a flag.Value that accumulates the -route flags
+type routeList []route
+
+func (l *routeList) String() string {
+	var specs []string
+	for _, r := range *l {
+		specs = append(specs, r.re.String()+"="+r.label)
+	}
+	return strings.Join(specs, ",")
+}
+
+// Set parses a route given as "REGEX=LABEL". The label is separated at
+// the last "=", so that the regular expression may contain one
+func (l *routeList) Set(v string) error {
+	i := strings.LastIndexByte(v, '=')
+	if i <= 0 || i == len(v)-1 {
+		return errors.Errorf(`route must be in the form REGEX=LABEL: %q`, v)
+	}
+
+	re, err := regexp.Compile(v[:i])
+	if err != nil {
+		return errors.Wrapf(err, `invalid regular expression in route %q`, v)
+	}
+	*l = append(*l, route{re: re, label: v[i+1:]})
+	return nil
+}
+
+// router writes each line to the file of the first route that matches
+// it, or to the file of the default label if none of them do. The files
+// are owned by a Manager, so that they can be evicted when idle and
+// reopened on SIGHUP
+type router struct {
+	routes []route
+	dflt   string
+	m      *rotating.Manager
+}
+
+// newRouter creates a router that writes to the files generated from
+// pattern, which must contain rotating.LabelPlaceholder
+func newRouter(ctx context.Context, pattern string, routes []route, dflt string, options ...rotating.Option) (*router, error) {
+	m, err := rotating.NewManager(ctx, pattern, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create manager`)
+	}
+
+	r := &router{
+		routes: routes,
+		dflt:   dflt,
+		m:      m,
+	}
+	// Fail early on invalid labels, instead of on the first line
+	if err := m.Reload(r.config()); err != nil {
+		m.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// config returns the configuration of the Manager, which has one label
+// per route plus the default one. Reloading it reopens all of the files,
+// e.g. after they have been moved away by an external tool
+func (r *router) config() rotating.ManagerConfig {
+	config := rotating.ManagerConfig{r.dflt: nil}
+	for _, rt := range r.routes {
+		config[rt.label] = nil
+	}
+	return config
+}
+
+// reloadOnSignal reopens all of the files every time SIGHUP is received
+func (r *router) reloadOnSignal() {
+	r.m.ReloadOnSignal(func() (rotating.ManagerConfig, error) {
+		return r.config(), nil
+	})
+}
+
+func (r *router) Write(line []byte) (int, error) {
+	for _, rt := range r.routes {
+		if rt.re.Match(line) {
+			return r.m.WriteLabeled(rt.label, line)
+		}
+	}
+	return r.m.WriteLabeled(r.dflt, line)
+}
+
+// Close closes all of the files, including the default file
+func (r *router) Close() error {
+	return r.m.Close()
+}
@@ -0,0 +1,194 @@
+// Package lumberjack provides a replacement for the Logger type of
+// gopkg.in/natefinch/lumberjack.v2 that is backed by a *rotating.File,
+// so that projects configured through lumberjack's fields can migrate
+// by changing the import path.
+//
+// The layout of the files differs slightly from lumberjack. The data is
+// written to files named after Filename with the date inserted before
+// the extension (e.g. app-2021-01-01.log, app-2021-01-01.log.1, ...),
+// which are rotated when they reach MaxSize, and at least once a day.
+// Filename itself becomes a symlink to the file currently written to.
+// If Filename exists as a regular file (e.g. written by lumberjack), it
+// is renamed using lumberjack's naming scheme for backups, so that it is
+// subject to the same retention rules as the rest of the files.
+package lumberjack
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+)
+
+const (
+	megabyte       = 1024 * 1024
+	defaultMaxSize = 100
+
+	// backupTimeFormat is the format that lumberjack uses for the
+	// timestamps in the names of backup files
+	backupTimeFormat = `2006-01-02T15-04-05.000`
+)
+
+// Logger has the same fields as lumberjack.Logger, and writes to a
+// *rotating.File configured accordingly
+type Logger struct {
+	// Filename is the file to write logs to. It defaults to
+	// <processname>-lumberjack.log in os.TempDir()
+	Filename string `json:"filename" yaml:"filename"`
+
+	// MaxSize is the maximum size in megabytes of each file. It
+	// defaults to 100 megabytes
+	MaxSize int `json:"maxsize" yaml:"maxsize"`
+
+	// MaxAge is the maximum number of days to retain old files.
+	// Zero means that files are not removed based on their age
+	MaxAge int `json:"maxage" yaml:"maxage"`
+
+	// MaxBackups is the maximum number of old files to retain.
+	// Zero means that all old files are retained
+	MaxBackups int `json:"maxbackups" yaml:"maxbackups"`
+
+	// LocalTime specifies that the local time should be used for the
+	// file names, instead of UTC
+	LocalTime bool `json:"localtime" yaml:"localtime"`
+
+	// Compress determines if the rotated files should be compressed
+	// using gzip
+	Compress bool `json:"compress" yaml:"compress"`
+
+	mu   sync.Mutex
+	file *rotating.File
+}
+
+// Config returns the pattern and the options to be passed to
+// rotating.NewFile that correspond to the fields of the Logger
+func (l *Logger) Config() (string, []rotating.Option, error) {
+	filename := l.filename()
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	// The file name must not be interpreted as part of the pattern
+	pattern := strings.Replace(base, `%`, `%%`, -1) + `-%Y-%m-%d` + strings.Replace(ext, `%`, `%%`, -1)
+
+	maxSize := l.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+
+	clock := rotating.UTC()
+	if l.LocalTime {
+		clock = rotating.Local()
+	}
+
+	options := []rotating.Option{
+		rotating.WithClock(clock),
+		rotating.WithMaxFileSize(int64(maxSize) * megabyte),
+		// lumberjack enforces MaxSize on every write, whereas the size on
+		// disk is only checked at the check interval
+		rotating.WithMaxUncompressedSize(int64(maxSize) * megabyte),
+		rotating.WithMaxInterval(24 * time.Hour),
+		rotating.WithSymlink(filename),
+	}
+	if l.MaxBackups > 0 {
+		// The rotation count includes the current file
+		options = append(options, rotating.WithRotationCount(l.MaxBackups+1))
+	}
+	if l.MaxAge > 0 {
+		options = append(options, rotating.WithMaxAge(time.Duration(l.MaxAge)*24*time.Hour))
+	}
+	if l.Compress {
+		options = append(options, rotating.WithCompress(true))
+	}
+	return pattern, options, nil
+}
+
+// Write writes p to the current file, creating it if necessary
+func (l *Logger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			return 0, err
+		}
+	}
+	return l.file.Write(p)
+}
+
+// Rotate closes the current file and switches to a new one, as
+// lumberjack's Rotate does. The file is created if it has not been yet
+func (l *Logger) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			return err
+		}
+	}
+	return l.file.Rotate()
+}
+
+// Close closes the current file. A subsequent Write reopens it
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *Logger) open() error {
+	pattern, options, err := l.Config()
+	if err != nil {
+		return err
+	}
+
+	if err := l.migrate(); err != nil {
+		return err
+	}
+
+	f, err := rotating.NewFile(context.Background(), pattern, options...)
+	if err != nil {
+		return errors.Wrap(err, `lumberjack: failed to create file`)
+	}
+	l.file = f
+	return nil
+}
+
+// migrate renames a regular file at Filename, so that it does not get
+// replaced by the symlink to the current file
+func (l *Logger) migrate() error {
+	filename := l.filename()
+	fi, err := os.Lstat(filename)
+	if err != nil || !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	t := fi.ModTime()
+	if !l.LocalTime {
+		t = t.UTC()
+	}
+	ext := filepath.Ext(filename)
+	backup := strings.TrimSuffix(filename, ext) + `-` + t.Format(backupTimeFormat) + ext
+	if err := os.Rename(filename, backup); err != nil {
+		return errors.Wrapf(err, `lumberjack: failed to rename existing file %s`, filename)
+	}
+	return nil
+}
+
+func (l *Logger) filename() string {
+	if l.Filename != "" {
+		return l.Filename
+	}
+	name := filepath.Base(os.Args[0]) + `-lumberjack.log`
+	return filepath.Join(os.TempDir(), name)
+}
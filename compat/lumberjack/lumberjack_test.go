@@ -0,0 +1,166 @@
+package lumberjack_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating/compat/lumberjack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lumberjack_test")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// A file previously written by lumberjack
+	filename := filepath.Join(dir, "100%-app.log")
+	if !assert.NoError(t, ioutil.WriteFile(filename, []byte("old\n"), 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+	mtime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !assert.NoError(t, os.Chtimes(filename, mtime, mtime), `os.Chtimes should succeed`) {
+		return
+	}
+
+	l := &lumberjack.Logger{
+		Filename:   filename,
+		MaxSize:    1,
+		MaxBackups: 3,
+	}
+	defer l.Close()
+
+	const msg = "Hello, World\n"
+	if _, err := l.Write([]byte(msg)); !assert.NoError(t, err, `l.Write should succeed`) {
+		return
+	}
+	if !assert.NoError(t, l.Close(), `l.Close should succeed`) {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "100%-app-2021-01-01T00-00-00.000.log"))
+	if !assert.NoError(t, err, `the existing file should have been renamed`) {
+		return
+	}
+	if !assert.Equal(t, "old\n", string(buf), `contents of the renamed file should match`) {
+		return
+	}
+
+	buf, err = ioutil.ReadFile(filename)
+	if !assert.NoError(t, err, `ioutil.ReadFile via the symlink should succeed`) {
+		return
+	}
+	if !assert.Equal(t, msg, string(buf), `contents should match`) {
+		return
+	}
+
+	current := filepath.Join(dir, "100%-app-"+time.Now().UTC().Format("2006-01-02")+".log")
+	if _, err := os.Stat(current); !assert.NoError(t, err, `current file should exist`) {
+		return
+	}
+}
+
+func TestLoggerCompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lumberjack_test-compress")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	l := &lumberjack.Logger{
+		Filename: filepath.Join(dir, "app.log"),
+		Compress: true,
+	}
+	defer l.Close()
+
+	_, options, err := l.Config()
+	if !assert.NoError(t, err, `l.Config should succeed`) {
+		return
+	}
+	if !assert.Len(t, options, 6, `number of options should match`) {
+		return
+	}
+	if _, err := l.Write([]byte("Hello, World\n")); !assert.NoError(t, err, `l.Write should succeed`) {
+		return
+	}
+}
+
+func TestLoggerRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lumberjack_test-rotate")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log")
+	l := &lumberjack.Logger{Filename: filename}
+	defer l.Close()
+
+	if _, err := l.Write([]byte("first\n")); !assert.NoError(t, err, `l.Write should succeed`) {
+		return
+	}
+	if !assert.NoError(t, l.Rotate(), `l.Rotate should succeed`) {
+		return
+	}
+	if _, err := l.Write([]byte("second\n")); !assert.NoError(t, err, `l.Write should succeed`) {
+		return
+	}
+	if !assert.NoError(t, l.Close(), `l.Close should succeed`) {
+		return
+	}
+
+	// The data written after Rotate goes to a new file
+	prefix := filepath.Join(dir, "app-"+time.Now().UTC().Format("2006-01-02")+".log")
+	for name, expected := range map[string]string{prefix: "first\n", prefix + ".1": "second\n", filename: "second\n"} {
+		buf, err := ioutil.ReadFile(name)
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, expected, string(buf), `contents of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func TestLoggerMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lumberjack_test-maxsize")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	l := &lumberjack.Logger{
+		Filename: filepath.Join(dir, "app.log"),
+		MaxSize:  1,
+	}
+	defer l.Close()
+
+	// The file is rotated as soon as it reaches MaxSize, without waiting
+	// for the size on disk to be checked
+	chunk := bytes.Repeat([]byte("x"), 512*1024)
+	for i := 0; i < 3; i++ {
+		if _, err := l.Write(chunk); !assert.NoError(t, err, `l.Write should succeed`) {
+			return
+		}
+	}
+	if !assert.NoError(t, l.Close(), `l.Close should succeed`) {
+		return
+	}
+
+	prefix := filepath.Join(dir, "app-"+time.Now().UTC().Format("2006-01-02")+".log")
+	for name, expected := range map[string]int64{prefix: 1024 * 1024, prefix + ".1": 512 * 1024} {
+		fi, err := os.Stat(name)
+		if !assert.NoError(t, err, `os.Stat should succeed`) {
+			return
+		}
+		if !assert.Equal(t, expected, fi.Size(), `size of %s should match`, name) {
+			return
+		}
+	}
+}
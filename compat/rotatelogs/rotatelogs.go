@@ -0,0 +1,164 @@
+// Package rotatelogs provides a constructor and options with the same
+// names and semantics as github.com/lestrrat-go/file-rotatelogs, which
+// this package succeeds, so that existing users can switch imports with
+// minimal changes.
+//
+//	// before
+//	rl, err := rotatelogs.New("/var/log/app.%Y%m%d",
+//		rotatelogs.WithLinkName("/var/log/app"),
+//		rotatelogs.WithRotationTime(time.Hour),
+//	)
+//
+//	// after: only the import path changes
+//	import "github.com/lestrrat-go/rotating/compat/rotatelogs"
+//
+// Options that have no equivalent (WithHandler, ForceNewFile) are not
+// provided, so that their use is detected at compile time.
+package rotatelogs
+
+import (
+	"context"
+	"time"
+
+	"github.com/lestrrat-go/option"
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+)
+
+// Option is an option for New
+type Option = option.Interface
+
+type identClock struct{}
+type identLinkName struct{}
+type identMaxAge struct{}
+type identRotationCount struct{}
+type identRotationSize struct{}
+type identRotationTime struct{}
+
+const (
+	defaultMaxAge       = 7 * 24 * time.Hour
+	defaultRotationTime = 24 * time.Hour
+)
+
+// UTC and Local are the clocks of file-rotatelogs, to be passed to
+// WithClock
+var (
+	// UTC returns the current time in UTC
+	UTC = rotating.UTC()
+	// Local returns the current time in the local time zone
+	Local = rotating.Local()
+)
+
+// RotateLogs is the equivalent of rotatelogs.RotateLogs
+type RotateLogs struct {
+	*rotating.File
+}
+
+// New creates a new RotateLogs that writes to files generated from the
+// given strftime pattern.
+//
+// As with file-rotatelogs, files are retained for 7 days unless either
+// WithMaxAge or WithRotationCount is specified, and the two options may
+// not be specified together. Files are rotated every 24 hours unless
+// WithRotationTime is specified.
+func New(p string, options ...Option) (*RotateLogs, error) {
+	clock := rotating.Local()
+	rotationTime := defaultRotationTime
+	var linkName string
+	var maxAge time.Duration
+	var maxAgeSet bool
+	var rotationCount uint
+	var rotationSize int64
+	for _, option := range options {
+		switch option.Ident() {
+		case identClock{}:
+			clock = option.Value().(rotating.Clock)
+		case identLinkName{}:
+			linkName = option.Value().(string)
+		case identMaxAge{}:
+			maxAge = option.Value().(time.Duration)
+			maxAgeSet = true
+		case identRotationCount{}:
+			rotationCount = option.Value().(uint)
+		case identRotationSize{}:
+			rotationSize = option.Value().(int64)
+		case identRotationTime{}:
+			rotationTime = option.Value().(time.Duration)
+		}
+	}
+
+	if maxAge > 0 && rotationCount > 0 {
+		return nil, errors.New(`options MaxAge and RotationCount cannot be both set`)
+	}
+	if !maxAgeSet && rotationCount == 0 {
+		maxAge = defaultMaxAge
+	}
+
+	fopts := []rotating.Option{
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(rotationTime),
+	}
+	if linkName != "" {
+		fopts = append(fopts, rotating.WithSymlink(linkName))
+	}
+	if maxAge > 0 {
+		fopts = append(fopts, rotating.WithMaxAge(maxAge))
+	}
+	if rotationCount > 0 {
+		fopts = append(fopts, rotating.WithRotationCount(int(rotationCount)))
+	}
+	if rotationSize > 0 {
+		fopts = append(fopts, rotating.WithMaxFileSize(rotationSize))
+	}
+
+	f, err := rotating.NewFile(context.Background(), p, fopts...)
+	if err != nil {
+		return nil, err
+	}
+	return &RotateLogs{File: f}, nil
+}
+
+// CurrentFileName returns the name of the file that is currently being
+// written to, or an empty string if nothing has been written yet
+func (rl *RotateLogs) CurrentFileName() string {
+	return rl.File.Filename()
+}
+
+// WithClock specifies the clock used to determine the current time
+func WithClock(v rotating.Clock) Option {
+	return option.New(identClock{}, v)
+}
+
+// WithLocation specifies that the current time should be determined in
+// the given location
+func WithLocation(loc *time.Location) Option {
+	return WithClock(rotating.ClockFn(func() time.Time {
+		return time.Now().In(loc)
+	}))
+}
+
+// WithLinkName specifies the name of the symlink to the current file
+func WithLinkName(s string) Option {
+	return option.New(identLinkName{}, s)
+}
+
+// WithMaxAge specifies the maximum age of the files to retain. A
+// negative value disables the age based retention
+func WithMaxAge(d time.Duration) Option {
+	return option.New(identMaxAge{}, d)
+}
+
+// WithRotationTime specifies the interval between rotations
+func WithRotationTime(d time.Duration) Option {
+	return option.New(identRotationTime{}, d)
+}
+
+// WithRotationCount specifies the number of files to retain
+func WithRotationCount(n uint) Option {
+	return option.New(identRotationCount{}, n)
+}
+
+// WithRotationSize specifies the size at which files are rotated
+func WithRotationSize(s int64) Option {
+	return option.New(identRotationSize{}, s)
+}
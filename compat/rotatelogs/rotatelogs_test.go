@@ -0,0 +1,90 @@
+package rotatelogs_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/lestrrat-go/rotating/compat/rotatelogs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotatelogs_test")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	rl, err := rotatelogs.New(
+		filepath.Join(dir, "app.%Y%m%d%H%M"),
+		rotatelogs.WithClock(rotating.ClockFn(func() time.Time { return now })),
+		rotatelogs.WithLinkName(filepath.Join(dir, "app")),
+		rotatelogs.WithRotationTime(time.Hour),
+		rotatelogs.WithRotationCount(3),
+	)
+	if !assert.NoError(t, err, `rotatelogs.New should succeed`) {
+		return
+	}
+
+	if !assert.Empty(t, rl.CurrentFileName(), `there should be no current file before writing`) {
+		return
+	}
+	fmt.Fprintf(rl, "Hello, World\n")
+	if !assert.Equal(t, filepath.Join(dir, "app.202101011200"), rl.CurrentFileName(), `current file name should match`) {
+		return
+	}
+	rl.Close()
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "app"))
+	if !assert.NoError(t, err, `ioutil.ReadFile via the link should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "Hello, World\n", string(buf), `contents should match`) {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app.202101011200")); !assert.NoError(t, err, `file should exist`) {
+		return
+	}
+}
+
+func TestNewConflictingRetention(t *testing.T) {
+	_, err := rotatelogs.New(
+		filepath.Join(os.TempDir(), "rotatelogs_test.%Y%m%d"),
+		rotatelogs.WithMaxAge(time.Hour),
+		rotatelogs.WithRotationCount(3),
+	)
+	if !assert.Error(t, err, `rotatelogs.New should fail`) {
+		return
+	}
+}
+
+func TestClocks(t *testing.T) {
+	if !assert.Equal(t, time.UTC, rotatelogs.UTC.Now().Location(), `UTC should return the time in UTC`) {
+		return
+	}
+	if !assert.Equal(t, time.Local, rotatelogs.Local.Now().Location(), `Local should return the local time`) {
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "rotatelogs_test-clocks")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for _, clock := range []rotating.Clock{rotatelogs.UTC, rotatelogs.Local} {
+		rl, err := rotatelogs.New(filepath.Join(dir, "app.%Y%m%d"), rotatelogs.WithClock(clock))
+		if !assert.NoError(t, err, `rotatelogs.New should succeed`) {
+			return
+		}
+		if !assert.NoError(t, rl.Close(), `rl.Close should succeed`) {
+			return
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package rotating
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// gzipSuffix is appended to the names of the files compressed with gzip
+const gzipSuffix = `.gz`
+
+// Compressor compresses the files that have been rotated out, as
+// specified by WithCompressor. Compress writes the compressed contents of
+// src to dst, and Suffix returns the suffix (e.g. ".zst") that is appended
+// to the names of the compressed files.
+//
+// If the compressed file already exists (e.g. because the process was
+// restarted within the same time slot), the output of Compress is
+// appended to it, so the format must allow compressed streams to be
+// concatenated, as gzip, zstd, lz4, and bzip2 do. Note that ConcatReader
+// only decompresses gzip.
+type Compressor interface {
+	Compress(dst io.Writer, src io.Reader) error
+	Suffix() string
+}
+
+type gzipCompressor struct {
+	level int
+}
+
+// GzipCompressor returns a Compressor that compresses files with gzip at
+// the given level (see compress/gzip), and appends ".gz" to their names
+func GzipCompressor(level int) Compressor {
+	return gzipCompressor{level: level}
+}
+
+func defaultCompressor() Compressor {
+	return GzipCompressor(gzip.DefaultCompression)
+}
+
+func (c gzipCompressor) Compress(dst io.Writer, src io.Reader) error {
+	gz, err := gzip.NewWriterLevel(dst, c.level)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(gz, src); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (gzipCompressor) Suffix() string {
+	return gzipSuffix
+}
+
+// compressFile compresses the given file that has been rotated out, and
+// removes it. It returns the name of the compressed file, or "" if the
+// file has already been purged. The compressed data is written to a
+// temporary file that is renamed once it is complete, so the compressed
+// file never contains a partial stream.
+// It is run from the maintenance goroutine
+func (f *File) compressFile(filename string) (string, error) {
+	dst := filename + f.compressor.Suffix()
+	tmp := dst + `_compress`
+
+	src, err := f.fs.OpenFile(filename, os.O_RDONLY, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, `failed to open file %s`, filename)
+	}
+	defer src.Close()
+
+	w, err := createFile(f.fs, tmp, os.O_TRUNC|os.O_WRONLY, f.create)
+	if err != nil {
+		return "", err
+	}
+
+	err = f.writeCompressed(w, src, dst)
+	if cerr := w.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = f.fs.Remove(tmp)
+		return "", errors.Wrapf(err, `failed to compress file %s`, filename)
+	}
+
+	if err := f.fs.Rename(tmp, dst); err != nil {
+		_ = f.fs.Remove(tmp)
+		return "", errors.Wrapf(err, `failed to rename %s to %s`, tmp, dst)
+	}
+	if f.dirSync {
+		if err := f.syncDir(filepath.Dir(dst)); err != nil {
+			return "", err
+		}
+	}
+
+	// The file may have been purged while it was being compressed
+	if err := f.fs.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return dst, errors.Wrapf(err, `failed to remove compressed file %s`, filename)
+	}
+	return dst, nil
+}
+
+// writeCompressed writes the contents of the existing compressed file dst
+// (if any) to w, followed by the contents of src compressed as a separate
+// stream
+func (f *File) writeCompressed(w io.Writer, src io.Reader, dst string) error {
+	prev, err := f.fs.OpenFile(dst, os.O_RDONLY, 0)
+	switch {
+	case err == nil:
+		_, err = io.Copy(w, prev)
+		prev.Close()
+		if err != nil {
+			return errors.Wrapf(err, `failed to copy existing file %s`, dst)
+		}
+	case !os.IsNotExist(err):
+		return errors.Wrapf(err, `failed to open existing file %s`, dst)
+	}
+
+	return f.compressor.Compress(w, src)
+}
+
+// CompressionInfo describes the compression of a file that has been
+// rotated out, and is passed to the function specified by
+// WithCompressHook
+type CompressionInfo struct {
+	// Source is the name of the file that was compressed
+	Source string
+	// Filename is the name of the compressed file
+	Filename string
+	// Elapsed is the time it took to compress the file
+	Elapsed time.Duration
+	// Pending is the number of files that are waiting to be compressed
+	Pending int
+	// Err is the error that occurred, if any
+	Err error
+}
+
+// compress compresses the given file that has been rotated out, and
+// reports the result to the function specified by WithCompressHook.
+// It is run from the compression workers
+func (f *File) compress(filename string) (string, error) {
+	start := time.Now()
+	name, err := f.compressFile(filename)
+	if name == "" && err == nil {
+		// the file has already been purged
+		return "", nil
+	}
+
+	if hook := f.compressHook; hook != nil {
+		hook(CompressionInfo{
+			Source:   filename,
+			Filename: name,
+			Elapsed:  time.Since(start),
+			Pending:  f.compression.pending(),
+			Err:      err,
+		})
+	}
+	return name, err
+}
@@ -0,0 +1,331 @@
+package rotating
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ConcatReader reads the contents of the files generated from a pattern
+// as a single stream, oldest file first. Files that are gzip compressed
+// (e.g. by logrotate or by an archiving job) are detected by their
+// contents, and decompressed transparently.
+//
+// The list of files is taken when the ConcatReader is created: files
+// that appear afterwards are not read, but the data appended to the
+// listed files until they are reached is. Note that the data that is
+// still buffered in a *File is not visible to readers until it is
+// flushed.
+type ConcatReader struct {
+	fs    FileSystem
+	files []string
+	file  FileHandle
+	rdr   io.Reader
+}
+
+// NewConcatReader creates a new ConcatReader for the files generated from
+// the given strftime pattern, which should be the same pattern that was
+// passed to NewFile.
+//
+// Only the files that may contain data written between from (inclusive)
+// and to (exclusive) are read. The time at which a file was started is
+// taken from its name, and each file is assumed to last until the next
+// one was started. Either bound may be the zero time, which means that
+// the range is open on that side: pass two zero times to read all files.
+// The range can only be applied if the pattern contains at least one of
+// %Y, %y, %m, %d, %j, %H, %M, %S, %F or %T.
+//
+// The options that are honored are WithFileSystem, and WithClock, whose
+// location is used to interpret the times in the file names.
+func NewConcatReader(pattern string, from, to time.Time, options ...Option) (*ConcatReader, error) {
+	fs := OSFileSystem()
+	clock := Local()
+	for _, option := range options {
+		switch option.Ident() {
+		case identFileSystem{}:
+			fs = option.Value().(FileSystem)
+		case identClock{}:
+			clock = option.Value().(Clock)
+		}
+	}
+
+	parser := newNameParser(filepath.Clean(pattern), clock.Now().Location())
+	if !parser.hasTime && (!from.IsZero() || !to.IsZero()) {
+		return nil, errors.Errorf(`pattern %q does not contain the time of the files`, pattern)
+	}
+
+	matches, err := listFiles(fs, globFromPattern(pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]logFile, 0, len(matches))
+	for _, name := range matches {
+		e, ok := parser.parseFile(name)
+		if !ok {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sortLogFiles(entries)
+
+	var files []string
+	for i, e := range entries {
+		if !to.IsZero() && !e.t.Before(to) {
+			break
+		}
+		if !from.IsZero() {
+			// The file lasts until the next file with a later time was
+			// started, or indefinitely if there is none
+			var end time.Time
+			for _, next := range entries[i+1:] {
+				if next.t.After(e.t) {
+					end = next.t
+					break
+				}
+			}
+			if !end.IsZero() && !end.After(from) {
+				continue
+			}
+		}
+		files = append(files, e.name)
+	}
+
+	return &ConcatReader{
+		fs:    fs,
+		files: files,
+	}, nil
+}
+
+// Files returns the names of the files that have not been read yet,
+// including the file that is currently being read
+func (r *ConcatReader) Files() []string {
+	return append([]string(nil), r.files...)
+}
+
+// Read reads the next chunk of data. It returns io.EOF once all files
+// have been read
+func (r *ConcatReader) Read(p []byte) (int, error) {
+	for {
+		if r.rdr == nil {
+			if len(r.files) == 0 {
+				return 0, io.EOF
+			}
+			if err := r.openFile(r.files[0]); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.rdr.Read(p)
+		if err == io.EOF {
+			if err := r.closeFile(); err != nil {
+				return n, err
+			}
+			r.files = r.files[1:]
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		if err != nil {
+			return n, errors.Wrapf(err, `failed to read file %s`, r.files[0])
+		}
+		return n, nil
+	}
+}
+
+// Close closes the file that is currently being read. Subsequent calls
+// to Read return io.EOF
+func (r *ConcatReader) Close() error {
+	r.files = nil
+	return r.closeFile()
+}
+
+func (r *ConcatReader) openFile(filename string) error {
+	fh, err := r.fs.OpenFile(filename, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.Wrapf(err, `failed to open file %s`, filename)
+	}
+
+	br := bufio.NewReader(fh)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			fh.Close()
+			return errors.Wrapf(err, `failed to decompress file %s`, filename)
+		}
+		r.rdr = gz
+	} else {
+		r.rdr = br
+	}
+	r.file = fh
+	return nil
+}
+
+func (r *ConcatReader) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+
+	var err error
+	if gz, ok := r.rdr.(*gzip.Reader); ok {
+		err = gz.Close()
+	}
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file = nil
+	r.rdr = nil
+	return err
+}
+
+// nameParser extracts the time from the names of the files generated
+// from a strftime pattern
+type nameParser struct {
+	re      *regexp.Regexp
+	verbs   []byte
+	loc     *time.Location
+	hasTime bool
+}
+
+func newNameParser(pattern string, loc *time.Location) *nameParser {
+	var verbs []byte
+	var expr, literal strings.Builder
+	expr.WriteByte('^')
+	group := func(re string, vs ...byte) {
+		expr.WriteString(regexp.QuoteMeta(literal.String()))
+		literal.Reset()
+		expr.WriteString(re)
+		verbs = append(verbs, vs...)
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '*' {
+			// Same as in the glob pattern
+			group(`.*?`)
+			continue
+		}
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			literal.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch c := pattern[i]; c {
+		case '%':
+			literal.WriteByte('%')
+		case 'Y':
+			group(`(\d{4})`, c)
+		case 'y', 'm', 'd', 'H', 'M', 'S':
+			group(`(\d{2})`, c)
+		case 'j':
+			group(`(\d{3})`, c)
+		case 'F':
+			group(`(\d{4})-(\d{2})-(\d{2})`, 'Y', 'm', 'd')
+		case 'T':
+			group(`(\d{2}):(\d{2}):(\d{2})`, 'H', 'M', 'S')
+		default:
+			// Anything that does not contribute to the time
+			group(`.*?`)
+		}
+	}
+	group(`(?:\.(\d+))?(.*)$`)
+
+	return &nameParser{
+		re:      regexp.MustCompile(expr.String()),
+		verbs:   verbs,
+		loc:     loc,
+		hasTime: len(verbs) > 0,
+	}
+}
+
+// parse returns the time encoded in the file name, and its generation
+// (the numeric suffix added when the file name is reused)
+func (p *nameParser) parse(name string) (time.Time, int, bool) {
+	e, ok := p.parseFile(name)
+	return e.t, e.generation, ok
+}
+
+// parseFile parses the name of a file generated from the pattern
+func (p *nameParser) parseFile(name string) (logFile, bool) {
+	m := p.re.FindStringSubmatch(filepath.Clean(name))
+	if m == nil {
+		return logFile{}, false
+	}
+
+	year, month, day := 1, 1, 1
+	var hour, min, sec, yday int
+	for i, verb := range p.verbs {
+		n, _ := strconv.Atoi(m[i+1])
+		switch verb {
+		case 'Y':
+			year = n
+		case 'y':
+			// Same convention as time.Parse
+			if n < 69 {
+				year = 2000 + n
+			} else {
+				year = 1900 + n
+			}
+		case 'm':
+			month = n
+		case 'd':
+			day = n
+		case 'j':
+			yday = n
+		case 'H':
+			hour = n
+		case 'M':
+			min = n
+		case 'S':
+			sec = n
+		}
+	}
+	if yday > 0 {
+		month, day = 1, yday
+	}
+
+	var generation int
+	if s := m[len(m)-2]; s != "" {
+		generation, _ = strconv.Atoi(s)
+	}
+	return logFile{
+		name:       name,
+		t:          time.Date(year, time.Month(month), day, hour, min, sec, 0, p.loc),
+		generation: generation,
+		suffix:     m[len(m)-1],
+	}, true
+}
+
+// logFile is a file generated from a pattern, along with the time and
+// the generation parsed from its name, and whatever follows them (e.g.
+// the suffix of a compressed file)
+type logFile struct {
+	name       string
+	t          time.Time
+	generation int
+	suffix     string
+}
+
+// before returns true if the file was started before the other file
+func (e logFile) before(other logFile) bool {
+	if !e.t.Equal(other.t) {
+		return e.t.Before(other.t)
+	}
+	return e.generation < other.generation
+}
+
+// sortLogFiles sorts the files in the order that they were started
+func sortLogFiles(files []logFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].before(files[j])
+	})
+}
@@ -0,0 +1,87 @@
+package rotating_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcatReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ConcatReader")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("a\n"))
+	gz.Close()
+
+	files := map[string][]byte{
+		"20210101-00.log.gz": compressed.Bytes(),
+		"20210101-01.log":    []byte("b\n"),
+		"20210101-01.log.1":  []byte("c\n"),
+		"20210101-02.log":    []byte("d\n"),
+		"unrelated.txt":      []byte("x\n"),
+		// Temporary files and markers are not log data
+		"20210101-01.log_snapshot":   []byte("SNAP\n"),
+		"20210101-01.log.1_compress": []byte("TMP\n"),
+		"20210101-02.log_archive":    []byte("MARK\n"),
+		"20210101-02.log_lock":       []byte("LOCK\n"),
+	}
+	for name, data := range files {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), data, 0644), `ioutil.WriteFile should succeed`) {
+			return
+		}
+	}
+	if !assert.NoError(t, os.Symlink("20210101-02.log", filepath.Join(dir, "20210101-99.log")), `os.Symlink should succeed`) {
+		return
+	}
+
+	pattern := filepath.Join(dir, "%Y%m%d-%H.log")
+	at := func(hour, min int) time.Time {
+		return time.Date(2021, 1, 1, hour, min, 0, 0, time.UTC)
+	}
+	testcases := []struct {
+		Name     string
+		From, To time.Time
+		Expected string
+	}{
+		{Name: "all", Expected: "a\nb\nc\nd\n"},
+		{Name: "middle", From: at(1, 30), To: at(2, 0), Expected: "b\nc\n"},
+		{Name: "from", From: at(2, 0), Expected: "d\n"},
+		{Name: "to", To: at(1, 0), Expected: "a\n"},
+		{Name: "across", From: at(0, 30), To: at(1, 30), Expected: "a\nb\nc\n"},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			r, err := rotating.NewConcatReader(pattern, tc.From, tc.To, rotating.WithClock(rotating.UTC()))
+			if !assert.NoError(t, err, `rotating.NewConcatReader should succeed`) {
+				return
+			}
+			defer r.Close()
+
+			data, err := ioutil.ReadAll(r)
+			if !assert.NoError(t, err, `ioutil.ReadAll should succeed`) {
+				return
+			}
+			if !assert.Equal(t, tc.Expected, string(data), `contents should match`) {
+				return
+			}
+		})
+	}
+
+	_, err = rotating.NewConcatReader(filepath.Join(dir, "app.log"), at(0, 0), time.Time{})
+	if !assert.Error(t, err, `rotating.NewConcatReader should fail for patterns without time`) {
+		return
+	}
+}
@@ -0,0 +1,158 @@
+package rotating
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// createOptions specifies the permissions and the ownership of the files
+// and directories that are created
+type createOptions struct {
+	dirMode  os.FileMode
+	fileMode os.FileMode
+	exact    bool // chmod after creation, ignoring the umask
+	uid      int  // -1 to leave unchanged
+	gid      int  // -1 to leave unchanged
+	onError  func(error)
+}
+
+type ownerValue struct {
+	uid int
+	gid int
+}
+
+// createFile creates a new file in the given path, creating parent directories
+// as necessary
+func createFile(fs FileSystem, filename string, flag int, opts createOptions) (FileHandle, error) {
+	// make sure the dir is existed, eg:
+	// ./foo/bar/baz/hello.log must make sure ./foo/bar/baz is existed
+	if err := mkdirAll(fs, filepath.Dir(filename), opts); err != nil {
+		return nil, err
+	}
+
+	_, err := fs.Stat(filename)
+	created := os.IsNotExist(err)
+
+	// if we got here, then we need to create a file
+	fh, err := fs.OpenFile(filename, os.O_CREATE|flag, opts.fileMode)
+	if err != nil {
+		return nil, fileError(OpOpen, filename, err)
+	}
+
+	if created {
+		if err := opts.chmod(fs, filename, opts.fileMode); err != nil {
+			fh.Close()
+			return nil, err
+		}
+		opts.chown(fs, filename)
+	}
+	return fh, nil
+}
+
+// mkdirAll creates the directory along with any missing parents
+func mkdirAll(fs FileSystem, dir string, opts createOptions) error {
+	// Remember which directories are missing, so that only the ones
+	// that we create are chown'ed
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := fs.Stat(d); err == nil || !os.IsNotExist(err) {
+			break
+		}
+		missing = append(missing, d)
+		if parent := filepath.Dir(d); parent == d {
+			break
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if err := fs.MkdirAll(dir, opts.dirMode); err != nil {
+		return errors.Wrapf(err, "failed to create directory %s", dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := opts.chmod(fs, missing[i], opts.dirMode); err != nil {
+			return err
+		}
+		opts.chown(fs, missing[i])
+	}
+	return nil
+}
+
+// chmod sets the permissions of a file or directory that has been created
+// to exactly the given mode when WithExactPermissions is enabled, as the
+// mode passed when creating it is subject to the umask. Unlike chown, a
+// failure is an error, as the permissions would otherwise be looser or
+// stricter than requested
+func (opts createOptions) chmod(fs FileSystem, name string, mode os.FileMode) error {
+	if !opts.exact {
+		return nil
+	}
+
+	c, ok := fs.(interface {
+		Chmod(name string, mode os.FileMode) error
+	})
+	if !ok {
+		return errors.Errorf(`failed to change permissions of %s: file system does not support changing permissions`, name)
+	}
+	if err := c.Chmod(name, mode); err != nil {
+		return errors.Wrapf(err, `failed to change permissions of %s`, name)
+	}
+	return nil
+}
+
+// chown changes the owner of a file or directory that has been created,
+// as specified by WithOwner. As this is not possible on all platforms and
+// file systems, nor for all users, failures are only reported to the
+// error handler
+func (opts createOptions) chown(fs FileSystem, name string) {
+	if opts.uid < 0 && opts.gid < 0 {
+		return
+	}
+
+	var err error
+	if c, ok := fs.(interface {
+		Chown(name string, uid, gid int) error
+	}); ok {
+		err = c.Chown(name, opts.uid, opts.gid)
+	} else {
+		err = errors.New(`file system does not support changing owners`)
+	}
+
+	if err != nil && opts.onError != nil {
+		opts.onError(errors.Wrapf(err, `failed to change owner of %s`, name))
+	}
+}
+
+// patternDir returns the part of the directory of the pattern p that
+// does not depend on the time, i.e. the directory that all files are
+// created in or below
+func patternDir(p string) string {
+	if i := strings.IndexByte(p, '%'); i >= 0 {
+		p = p[:i]
+	}
+	return filepath.Dir(p)
+}
+
+// verifyDirectory creates the directory if necessary, and checks that
+// files can be created in it by creating and removing a temporary file
+func verifyDirectory(fs FileSystem, dir string, opts createOptions) error {
+	if err := mkdirAll(fs, dir, opts); err != nil {
+		return err
+	}
+
+	probe := filepath.Join(dir, fmt.Sprintf(".rotating-probe-%d-%d", os.Getpid(), time.Now().UnixNano()))
+	fh, err := fs.OpenFile(probe, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, `directory %s is not writable`, dir)
+	}
+	if err := fh.Close(); err != nil {
+		return errors.Wrapf(err, `failed to close file %s`, probe)
+	}
+	return errors.Wrapf(fs.Remove(probe), `failed to remove file %s`, probe)
+}
@@ -0,0 +1,145 @@
+package rotating
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OpenCurrent opens the file that is currently being written to for
+// reading, e.g. so that a diagnostics endpoint can show the last lines
+// that were logged without having to know the name of the file.
+//
+// Buffered data is flushed before the file is opened. The returned handle
+// refers to the file that was current at the time of the call, and
+// remains valid after the File rotates to another file, but it is
+// subject to the same retention as any other file (see WithRotationCount
+// and WithMaxAge). The caller is responsible for closing it.
+//
+// An error is returned if nothing has been written yet, and when the
+// File does not write to files that it can read back, i.e. with
+// WithFIFO, WithFileOpener, or WithPassthrough.
+func (f *File) OpenCurrent() (io.ReadSeekCloser, error) {
+	fh, _, err := f.openCurrent()
+	if err != nil {
+		return nil, err
+	}
+	return fh, nil
+}
+
+// Snapshot copies the file that is currently being written to to dst,
+// e.g. for support bundles, without interrupting the writes. Buffered data
+// is flushed first, and the copy contains exactly the data that had been
+// written at the time of the call, even if more is written (or the file
+// is rotated) while it is being copied. The copy is written to a
+// temporary file that is renamed to dst, so dst never contains a partial
+// copy. It returns the number of bytes copied.
+//
+// The same restrictions as for OpenCurrent apply.
+func (f *File) Snapshot(dst string) (int64, error) {
+	fh, size, err := f.openCurrent()
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+
+	tmp := dst + `_snapshot`
+	w, err := createFile(f.fs, tmp, os.O_TRUNC|os.O_WRONLY, f.create)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.CopyN(w, fh, size)
+	if cerr := w.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = f.fs.Remove(tmp)
+		return n, errors.Wrapf(err, `failed to copy file to %s`, tmp)
+	}
+
+	if err := f.fs.Rename(tmp, dst); err != nil {
+		_ = f.fs.Remove(tmp)
+		return n, errors.Wrapf(err, `failed to rename %s to %s`, tmp, dst)
+	}
+	return n, nil
+}
+
+// openCurrent flushes the current file, and opens it for reading. It
+// also returns the size of the data that had been written at that time
+func (f *File) openCurrent() (FileHandle, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case f.passthrough != nil:
+		return nil, 0, errors.New(`output is passed through, and not written to a file`)
+	case f.fifo:
+		return nil, 0, errors.New(`named pipes cannot be read back`)
+	case f.opener != nil:
+		return nil, 0, errors.New(`files opened by a FileOpener cannot be read back`)
+	case f.filename == "":
+		return nil, 0, errors.New(`no file is being written to`)
+	}
+
+	if v, ok := f.file.(interface{ Flush() error }); ok {
+		if err := v.Flush(); err != nil {
+			return nil, 0, errors.Wrapf(err, `failed to flush file %s`, f.filename)
+		}
+	}
+
+	fh, err := f.fs.OpenFile(f.filename, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, `failed to open file %s`, f.filename)
+	}
+
+	// Some writers (e.g. the mmap-backed writer) preallocate space in the
+	// file, so prefer the size that they report
+	if v, ok := unwrapWriter(f.file).(interface{ Size() int64 }); ok {
+		return fh, v.Size(), nil
+	}
+	fi, err := f.fs.Stat(f.filename)
+	if err != nil {
+		fh.Close()
+		return nil, 0, errors.Wrapf(err, `failed to stat file %s`, f.filename)
+	}
+	return fh, fi.Size(), nil
+}
+
+// Filename returns the name of the file that is currently being written
+// to, or an empty string if no file is being written to.
+func (f *File) Filename() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.filename
+}
+
+// BaseTime returns the beginning of the time slot of the file that is
+// currently being written to, i.e. the time that its name was generated
+// from. The zero time is returned if no file is being written to.
+func (f *File) BaseTime() time.Time {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.filename == "" {
+		return time.Time{}
+	}
+	return f.fileBaseTime
+}
+
+// Generation returns the generation of the file that is currently being
+// written to: 0 for the first file in a time slot, and incremented each
+// time that the file is rotated within the same slot because it reached
+// the size given by WithMaxFileSize. The generation is appended to the
+// name of the file, e.g. "20210101.log.1" for generation 1.
+func (f *File) Generation() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.filename == "" {
+		return 0
+	}
+	return f.fileGeneration
+}
@@ -0,0 +1,49 @@
+package rotating
+
+import "github.com/pkg/errors"
+
+// KeyFunc extracts the key of a record, e.g. the tenant or the category
+// that the record belongs to
+type KeyFunc func(p []byte) string
+
+// KeyedWriter routes each record to the File of a Manager that
+// corresponds to the key of the record
+type KeyedWriter struct {
+	manager *Manager
+	keyFunc KeyFunc
+}
+
+// NewKeyedWriter creates a new KeyedWriter that writes to the Files of m.
+// keyFunc is used by Write to extract the key of each record, and may be
+// nil if only WriteKeyed is used.
+func NewKeyedWriter(m *Manager, keyFunc KeyFunc) *KeyedWriter {
+	return &KeyedWriter{
+		manager: m,
+		keyFunc: keyFunc,
+	}
+}
+
+// Write writes p to the File for the key returned by the KeyFunc. p is
+// expected to be a single record, as the whole of p is written to the
+// same File
+func (w *KeyedWriter) Write(p []byte) (int, error) {
+	if w.keyFunc == nil {
+		return 0, errors.New(`no KeyFunc specified`)
+	}
+	return w.WriteKeyed(w.keyFunc(p), p)
+}
+
+// WriteKeyed writes p to the File for the given key
+func (w *KeyedWriter) WriteKeyed(key string, p []byte) (int, error) {
+	return w.manager.WriteLabeled(key, p)
+}
+
+// Flush flushes all Files of the Manager
+func (w *KeyedWriter) Flush() error {
+	return w.manager.Flush()
+}
+
+// Close closes the Manager, and therefore all of its Files
+func (w *KeyedWriter) Close() error {
+	return w.manager.Close()
+}
@@ -0,0 +1,65 @@
+package rotating
+
+import (
+	"errors"
+)
+
+// errDiskSpaceUnsupported is returned by diskSpace on platforms where the
+// free disk space cannot be queried
+var errDiskSpaceUnsupported = errors.New(`querying the free disk space is not supported on this platform`)
+
+// DiskFree specifies an amount of free disk space, either in bytes or as a
+// percentage of the size of the file system, for WithMinDiskFree
+type DiskFree struct {
+	bytes   uint64
+	percent float64
+}
+
+// DiskFreeBytes specifies an amount of free disk space in bytes
+func DiskFreeBytes(v int64) DiskFree {
+	if v < 0 {
+		v = 0
+	}
+	return DiskFree{bytes: uint64(v)}
+}
+
+// DiskFreePercent specifies an amount of free disk space as a percentage
+// (0 to 100) of the size of the file system
+func DiskFreePercent(v float64) DiskFree {
+	return DiskFree{percent: v}
+}
+
+func (d DiskFree) isZero() bool {
+	return d.bytes == 0 && d.percent <= 0
+}
+
+// below returns true if free bytes out of total are less than d
+func (d DiskFree) below(free, total uint64) bool {
+	if d.percent > 0 {
+		return float64(free) < float64(total)*d.percent/100
+	}
+	return free < d.bytes
+}
+
+// lowDiskSpace returns a function that reports whether the free space of
+// the file system that dir is on is below the minimum specified by
+// WithMinDiskFree, or nil if there is no minimum. The space is only
+// checked for regular files, and is never considered low on platforms
+// where it cannot be queried.
+func (f *File) lowDiskSpace(dir string) func() (bool, error) {
+	if f.minDiskFree.isZero() || !isOSFileSystem(f.fs) {
+		return nil
+	}
+
+	min := f.minDiskFree
+	return func() (bool, error) {
+		free, total, err := diskSpace(dir)
+		if err != nil {
+			if errors.Is(err, errDiskSpaceUnsupported) {
+				return false, nil
+			}
+			return false, err
+		}
+		return min.below(free, total), nil
+	}
+}
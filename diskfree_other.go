@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !windows
+// +build !linux,!darwin,!dragonfly,!freebsd,!windows
+
+package rotating
+
+func diskSpace(_ string) (uint64, uint64, error) {
+	return 0, 0, errDiskSpaceUnsupported
+}
@@ -0,0 +1,20 @@
+//go:build linux || darwin || dragonfly || freebsd
+// +build linux darwin dragonfly freebsd
+
+package rotating
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// diskSpace returns the number of bytes available to unprivileged users,
+// and the total number of bytes, of the file system that dir is on
+func diskSpace(dir string) (uint64, uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, 0, errors.Wrapf(err, `failed to statfs %s`, dir)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,34 @@
+//go:build windows
+// +build windows
+
+package rotating
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+var procGetDiskFreeSpaceExW = syscall.NewLazyDLL(`kernel32.dll`).NewProc(`GetDiskFreeSpaceExW`)
+
+// diskSpace returns the number of bytes available to the user, and the
+// total number of bytes, of the volume that dir is on
+func diskSpace(dir string) (uint64, uint64, error) {
+	p, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, `invalid directory name %s`, dir)
+	}
+
+	var free, total uint64
+	r, _, err := procGetDiskFreeSpaceExW.Call(
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&free)),
+		uintptr(unsafe.Pointer(&total)),
+		0,
+	)
+	if r == 0 {
+		return 0, 0, errors.Wrapf(err, `failed to get the free disk space of %s`, dir)
+	}
+	return free, total, nil
+}
@@ -0,0 +1,98 @@
+package rotating
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultDiskFullRetry is the interval between attempts to resume writing
+// after the disk became full, if none was specified
+const defaultDiskFullRetry = 30 * time.Second
+
+// writeDiskFull writes bufs to the file. If WithDropOnDiskFull was
+// specified and the disk is full, the data is dropped instead, and
+// writing is resumed once the disk has space again.
+// It must be called while holding the lock
+func (f *File) writeDiskFull(ctx context.Context, bufs [][]byte, size int) (int64, error) {
+	if f.diskFullRetry <= 0 {
+		return f.writeLocked(ctx, bufs, size)
+	}
+
+	now := f.clock.Now()
+	if f.dropping {
+		if now.Before(f.dropUntil) {
+			f.drop(int64(size))
+			return int64(size), nil
+		}
+		if err := f.resume(ctx); err != nil {
+			if !isDiskFull(err) {
+				return 0, err
+			}
+			f.dropUntil = now.Add(f.diskFullRetry)
+			f.drop(int64(size))
+			return int64(size), nil
+		}
+	}
+
+	n, err := f.writeLocked(ctx, bufs, size)
+	if err == nil || !isDiskFull(err) {
+		return n, err
+	}
+
+	f.dropping = true
+	f.dropUntil = now.Add(f.diskFullRetry)
+	f.dropped = 0
+	f.stats.DiskFullEpisodes++
+	f.handleError(&DiskFullError{Path: f.filename, Err: err})
+
+	// The writer may have buffered data that it will never be able to
+	// write, and may refuse to be written to from now on (e.g. bufio.Writer),
+	// so start over with a new handle when resuming
+	f.releaseWriter()
+	f.drop(int64(size) - n)
+	return int64(size), nil
+}
+
+// drop discards n bytes of data.
+// It must be called while holding the lock
+func (f *File) drop(n int64) {
+	f.dropped += n
+	f.stats.DiskFullDropped += n
+}
+
+// resume attempts to write the marker that records the amount of data
+// that has been dropped. The marker is flushed right away, so that a disk
+// that is still full is detected before the next record is written.
+// It must be called while holding the lock
+func (f *File) resume(ctx context.Context) error {
+	w, err := f.getWriter(ctx)
+	if err != nil {
+		return err
+	}
+
+	marker := f.encodeFrame([]byte(fmt.Sprintf("-- resumed after dropping %d bytes --\n", f.dropped)))
+	if _, err := w.Write(marker); err != nil {
+		f.releaseWriter()
+		return errors.Wrapf(err, `failed to write to file %s`, f.filename)
+	}
+	if err := flushWriter(w); err != nil {
+		f.releaseWriter()
+		return err
+	}
+	f.mirrorWrite(f.filename, [][]byte{marker})
+	f.dropping = false
+	return nil
+}
+
+// releaseWriter closes the current writer, ignoring errors, so that the
+// file is reopened upon the next write.
+// It must be called while holding the lock
+func (f *File) releaseWriter() {
+	if f.file != nil {
+		_ = finalizeWriter(f.file)
+		f.file = nil
+	}
+}
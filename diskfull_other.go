@@ -0,0 +1,15 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package rotating
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isDiskFull returns true if err was caused by the lack of space on the
+// device
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
@@ -0,0 +1,103 @@
+//go:build !plan9
+// +build !plan9
+
+package rotating_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// fullDisk is a sink that fails with ENOSPC while full is set
+type fullDisk struct {
+	full bool
+	buf  bytes.Buffer
+}
+
+func (d *fullDisk) Write(p []byte) (int, error) {
+	if d.full {
+		return 0, &os.PathError{Op: "write", Path: "disk", Err: syscall.ENOSPC}
+	}
+	return d.buf.Write(p)
+}
+
+func (d *fullDisk) Close() error {
+	return nil
+}
+
+func TestDropOnDiskFull(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	disk := &fullDisk{}
+	var errs []error
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		"%Y%m%d.log",
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(24*time.Hour),
+		rotating.WithFileOpener(func(string) (io.WriteCloser, error) {
+			return disk, nil
+		}),
+		rotating.WithDropOnDiskFull(10*time.Second),
+		rotating.WithErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	write := func(s string) bool {
+		_, err := f.Write([]byte(s))
+		return assert.NoError(t, err, `f.Write should succeed`)
+	}
+
+	if !write("first\n") {
+		return
+	}
+	disk.full = true
+	if !write("second\n") || !write("third\n") {
+		return
+	}
+
+	// Space is freed, but writing is not retried until the retry
+	// interval elapses
+	disk.full = false
+	if !write("fourth\n") {
+		return
+	}
+	clock.Advance(10 * time.Second)
+	if !write("fifth\n") {
+		return
+	}
+
+	if !assert.Equal(t, "first\n-- resumed after dropping 20 bytes --\nfifth\n", disk.buf.String(), `contents should match`) {
+		return
+	}
+	if !assert.Len(t, errs, 1, `the episode should be reported once`) {
+		return
+	}
+	var dferr *rotating.DiskFullError
+	if !assert.True(t, errors.As(errs[0], &dferr), `error should be a *rotating.DiskFullError`) {
+		return
+	}
+	stats := f.Stats()
+	if !assert.Equal(t, int64(20), stats.DiskFullDropped, `stats.DiskFullDropped should match`) {
+		return
+	}
+	if !assert.Equal(t, int64(1), stats.DiskFullEpisodes, `stats.DiskFullEpisodes should match`) {
+		return
+	}
+}
@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package rotating
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	errorHandleDiskFull syscall.Errno = 39
+	errorDiskFull       syscall.Errno = 112
+)
+
+// isDiskFull returns true if err was caused by the lack of space on the
+// device
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, errorHandleDiskFull) || errors.Is(err, errorDiskFull)
+}
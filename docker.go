@@ -0,0 +1,43 @@
+package rotating
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// dockerJSONEntry is a single entry in Docker's json-file log format
+type dockerJSONEntry struct {
+	Log    string `json:"log"`
+	Stream string `json:"stream"`
+	Time   string `json:"time"`
+}
+
+// dockerJSON returns a Transformer that encodes each line of a record as
+// an entry in Docker's json-file log format
+func dockerJSON(stream string, clock Clock) Transformer {
+	return func(rec []byte) []byte {
+		ts := clock.Now().UTC().Format(time.RFC3339Nano)
+
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for len(rec) > 0 {
+			// Like Docker, each line becomes a separate entry, which
+			// includes the newline
+			line := rec
+			if i := bytes.IndexByte(rec, '\n'); i >= 0 {
+				line = rec[:i+1]
+			}
+			rec = rec[len(line):]
+
+			// Encode appends a newline after each entry. Encoding a
+			// struct of strings cannot fail
+			_ = enc.Encode(dockerJSONEntry{
+				Log:    string(line),
+				Stream: stream,
+				Time:   ts,
+			})
+		}
+		return buf.Bytes()
+	}
+}
@@ -0,0 +1,174 @@
+package rotating
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Errors that can be tested for with errors.Is. ErrRotationFailed and
+// ErrPurgeFailed match a *FileError for OpRotate and OpPurge respectively
+var (
+	// ErrClosed is returned when writing to, or rotating a File that has
+	// been closed
+	ErrClosed = errors.New(`file already closed`)
+	// ErrRotationFailed means that the next file could not be created
+	ErrRotationFailed = errors.New(`rotation failed`)
+	// ErrPurgeFailed means that old files could not be removed
+	ErrPurgeFailed = errors.New(`purge failed`)
+)
+
+// TimeoutError is returned when a file system operation does not
+// complete within the duration specified by WithOperationTimeout
+type TimeoutError struct {
+	Op       string
+	Path     string
+	Duration time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf(`%s %s: operation timed out after %s`, e.Op, e.Path, e.Duration)
+}
+
+// Timeout always returns true. It allows TimeoutError to be
+// detected the same way as net.Error
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// TruncationError is reported to the error handler when the active file
+// is found to be smaller than the amount of data that has been written
+// to it, which means that it has been truncated by another process
+type TruncationError struct {
+	Path     string
+	Expected int64
+	Actual   int64
+}
+
+func (e *TruncationError) Error() string {
+	return fmt.Sprintf(`%s: file was truncated (expected at least %d bytes, found %d)`, e.Path, e.Expected, e.Actual)
+}
+
+// CircuitOpenError is returned when a write is rejected without being
+// attempted, because the circuit breaker specified by WithCircuitBreaker
+// is open
+type CircuitOpenError struct {
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf(`circuit breaker is open until %s`, e.Until.Format(time.RFC3339))
+}
+
+// LabelError is an error that occurred with the File for a label of
+// a Manager
+type LabelError struct {
+	Label string
+	Err   error
+}
+
+func (e *LabelError) Error() string {
+	return fmt.Sprintf(`label %q: %s`, e.Label, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *LabelError) Unwrap() error {
+	return e.Err
+}
+
+// ManagerError is returned by Manager.Flush and Manager.Close when the
+// operation failed for some of the Files. Errors lists the failures in
+// lexical order of the labels
+type ManagerError struct {
+	Op     string
+	Total  int
+	Errors []*LabelError
+}
+
+func (e *ManagerError) Error() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, `failed to %s %d of %d files`, e.Op, len(e.Errors), e.Total)
+	for i, err := range e.Errors {
+		if i == 0 {
+			buf.WriteString(`: `)
+		} else {
+			buf.WriteString(`; `)
+		}
+		buf.WriteString(err.Error())
+	}
+	return buf.String()
+}
+
+// DiskFullError is reported to the error handler when a write fails
+// because the disk is full, and the File starts dropping data as
+// specified by WithDropOnDiskFull
+type DiskFullError struct {
+	Path string
+	Err  error
+}
+
+func (e *DiskFullError) Error() string {
+	return fmt.Sprintf(`%s: disk full, dropping data: %s`, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *DiskFullError) Unwrap() error {
+	return e.Err
+}
+
+// Operations recorded in FileError
+const (
+	OpOpen     = `open`
+	OpRotate   = `rotate`
+	OpSymlink  = `symlink`
+	OpPurge    = `purge`
+	OpFinalize = `finalize`
+	OpSync     = `sync`
+	OpCompress = `compress`
+	OpArchive  = `archive`
+)
+
+// FileError records the operation that failed (one of the Op constants),
+// and the file that it failed for. It is returned by Write and reported
+// to the error handler, so that callers can tell what went wrong with
+// errors.As instead of inspecting error messages
+type FileError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf(`%s %s: %s`, e.Op, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the category of the failed operation,
+// i.e. ErrRotationFailed for OpRotate, or ErrPurgeFailed for OpPurge
+func (e *FileError) Is(target error) bool {
+	switch target {
+	case ErrRotationFailed:
+		return e.Op == OpRotate
+	case ErrPurgeFailed:
+		return e.Op == OpPurge
+	}
+	return false
+}
+
+// fileError returns a *FileError for err, or nil if err is nil. The
+// path is not repeated if err is an *os.PathError for the same path
+func fileError(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if pe, ok := err.(*os.PathError); ok && pe.Path == path {
+		err = pe.Err
+	}
+	return &FileError{Op: op, Path: path, Err: err}
+}
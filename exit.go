@@ -0,0 +1,73 @@
+package rotating
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// CloseOnExit closes c (e.g. a *File or a *Manager, which flush their
+// buffers when closed) when the process receives one of the given
+// signals, so that the last records are not lost when the process is
+// terminated. SIGINT and SIGTERM are used if no signals are given.
+//
+// Once c has been closed the signal is delivered again, so that the
+// process terminates as it would have without CloseOnExit. c is also
+// closed when ctx is canceled, in which case the process is left alone.
+//
+// Errors from closing are written to os.Stderr, as there is usually
+// nothing else left to report them to. The returned function stops
+// watching for the signals and ctx without closing c.
+func CloseOnExit(ctx context.Context, c io.Closer, signals ...os.Signal) func() {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+
+	done := make(chan struct{})
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			stop()
+			closeOnExit(c)
+		case sig := <-ch:
+			stop()
+			closeOnExit(c)
+			raise(sig)
+		}
+	}()
+	return stop
+}
+
+func closeOnExit(c io.Closer) {
+	if err := c.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "rotating: failed to close on exit: %s\n", err)
+	}
+}
+
+// raise delivers sig to the current process, now that it is no longer
+// being caught. If that is not possible, the process exits directly
+func raise(sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,95 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package rotating_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloseOnExit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-CloseOnExit")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	newFile := func(t *testing.T, name string) (*rotating.File, bool) {
+		f, err := rotating.NewFile(
+			context.Background(),
+			filepath.Join(dir, name),
+			rotating.WithBufferSize(4096),
+		)
+		if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+			return nil, false
+		}
+		if _, err := f.Write([]byte("last words\n")); !assert.NoError(t, err, `f.Write should succeed`) {
+			return nil, false
+		}
+		return f, true
+	}
+
+	waitForContents := func(t *testing.T, name string) bool {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			buf, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err == nil && string(buf) == "last words\n" {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return assert.Fail(t, `buffered data should have been flushed`)
+	}
+
+	t.Run("context", func(t *testing.T) {
+		f, ok := newFile(t, "context.log")
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer rotating.CloseOnExit(ctx, f)()
+		cancel()
+
+		waitForContents(t, "context.log")
+	})
+	t.Run("signal", func(t *testing.T) {
+		f, ok := newFile(t, "signal.log")
+		if !ok {
+			return
+		}
+
+		// Catch the signal here as well, so that the signal that is
+		// delivered again after closing does not terminate the test
+		ch := make(chan os.Signal, 2)
+		signal.Notify(ch, syscall.SIGUSR1)
+		defer signal.Stop(ch)
+
+		defer rotating.CloseOnExit(context.Background(), f, syscall.SIGUSR1)()
+		if !assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1), `syscall.Kill should succeed`) {
+			return
+		}
+
+		if !waitForContents(t, "signal.log") {
+			return
+		}
+		for i := 0; i < 2; i++ {
+			select {
+			case <-ch:
+			case <-time.After(5 * time.Second):
+				assert.Fail(t, `the signal should have been delivered again`)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package rotating
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultFallbackRetry is the interval between attempts to switch back
+// to the primary file, if none was specified
+const defaultFallbackRetry = 30 * time.Second
+
+// writeWithFallback writes bufs to the primary file, switching to the
+// fallback writer if that fails. While the fallback writer is in use,
+// the primary file is retried periodically.
+// It must be called while holding the lock
+func (f *File) writeWithFallback(ctx context.Context, bufs [][]byte, size int) (int64, error) {
+	now := f.clock.Now()
+	if f.fallbackActive && now.Before(f.fallbackUntil) {
+		return f.writeFallback(bufs)
+	}
+
+	n, err := f.writePrimary(ctx, bufs, size)
+	if err == nil {
+		f.fallbackActive = false
+		return n, nil
+	}
+
+	// The caller has given up on this write, so don't bother
+	if ctx.Err() != nil {
+		return n, err
+	}
+
+	if !f.fallbackActive {
+		f.handleError(errors.Wrap(err, `switching to fallback writer`))
+	}
+	f.fallbackActive = true
+	f.fallbackUntil = now.Add(f.fallbackRetry)
+
+	m, err := f.writeFallback(skipBytes(bufs, n))
+	return n + m, err
+}
+
+// writeFallback must be called while holding the lock
+func (f *File) writeFallback(bufs [][]byte) (int64, error) {
+	n, err := writeBuffers(f.fallback, bufs)
+	if err != nil {
+		return n, errors.Wrap(err, `failed to write to fallback writer`)
+	}
+	f.stats.Fallback++
+	return n, nil
+}
+
+// skipBytes returns the remainder of bufs after skipping the first n bytes
+func skipBytes(bufs [][]byte, n int64) [][]byte {
+	for len(bufs) > 0 && n >= int64(len(bufs[0])) {
+		n -= int64(len(bufs[0]))
+		bufs = bufs[1:]
+	}
+	if n > 0 && len(bufs) > 0 {
+		rest := make([][]byte, len(bufs))
+		copy(rest, bufs)
+		rest[0] = rest[0][n:]
+		return rest
+	}
+	return bufs
+}
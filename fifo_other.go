@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package rotating
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// openFIFO always fails on platforms that do not support named pipes
+func openFIFO(filename string, _ createOptions) (*os.File, error) {
+	return nil, errors.Errorf(`failed to open FIFO %s: named pipes are not supported on this platform`, filename)
+}
@@ -0,0 +1,142 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package rotating_test
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFIFO(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-FIFO")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "app.fifo"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithFIFO(true),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	// Without a reader, the write fails immediately
+	_, err = f.Write([]byte("Hello, World\n"))
+	if !assert.True(t, errors.Is(err, syscall.ENXIO), `error should be ENXIO`) {
+		return
+	}
+
+	fn := filepath.Join(dir, "app.fifo")
+	fi, err := os.Stat(fn)
+	if !assert.NoError(t, err, `os.Stat should succeed`) {
+		return
+	}
+	if !assert.True(t, fi.Mode()&os.ModeNamedPipe != 0, `file should be a named pipe`) {
+		return
+	}
+
+	rdr, err := os.OpenFile(fn, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if !assert.NoError(t, err, `os.OpenFile should succeed`) {
+		return
+	}
+	defer rdr.Close()
+
+	// Rotation reopens the same pipe, which the reader keeps reading from
+	const msg = "Hello, World\n"
+	if _, err := f.Write([]byte(msg)); !assert.NoError(t, err, `f.Write should succeed`) {
+		return
+	}
+	clock.Advance(6 * time.Second)
+	if _, err := f.Write([]byte(msg)); !assert.NoError(t, err, `f.Write should succeed`) {
+		return
+	}
+
+	scanner := bufio.NewScanner(rdr)
+	for i := 0; i < 2; i++ {
+		if !assert.True(t, scanner.Scan(), `scanner.Scan should succeed`) {
+			return
+		}
+		if !assert.Equal(t, "Hello, World", scanner.Text(), `line should match`) {
+			return
+		}
+	}
+}
+
+func TestFIFOPermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-FIFOPermissions")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var mu sync.Mutex
+	var errs []error
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "pipes", "app.fifo"),
+		rotating.WithFIFO(true),
+		rotating.WithFileMode(0620),
+		rotating.WithExactPermissions(true),
+		rotating.WithOwner(os.Getuid(), os.Getgid()),
+		rotating.WithErrorHandler(func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	// The pipe is created even though there is no reader
+	_, err = f.Write([]byte("Hello, World\n"))
+	if !assert.True(t, errors.Is(err, syscall.ENXIO), `error should be ENXIO`) {
+		return
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, "pipes", "app.fifo"))
+	if !assert.NoError(t, err, `os.Stat should succeed`) {
+		return
+	}
+	if !assert.True(t, fi.Mode()&os.ModeNamedPipe != 0, `file should be a named pipe`) {
+		return
+	}
+	if !assert.Equal(t, os.FileMode(0620), fi.Mode().Perm(), `pipe should have the configured mode`) {
+		return
+	}
+	if !assert.Equal(t, uint32(os.Getuid()), fi.Sys().(*syscall.Stat_t).Uid, `pipe should have the configured owner`) {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Empty(t, errs, `changing the owner should succeed`) {
+		return
+	}
+}
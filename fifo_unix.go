@@ -0,0 +1,45 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package rotating
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// openFIFO opens the named pipe in the given path for writing, creating
+// it with the same permissions and owner as a regular file if necessary.
+// The pipe is opened in non-blocking mode, so that the open fails
+// immediately with ENXIO instead of blocking until a reader shows up.
+func openFIFO(filename string, opts createOptions) (*os.File, error) {
+	fs := osFileSystem{}
+	if err := mkdirAll(fs, filepath.Dir(filename), opts); err != nil {
+		return nil, err
+	}
+
+	if err := unix.Mkfifo(filename, uint32(opts.fileMode.Perm())); err != nil {
+		if err != unix.EEXIST {
+			return nil, errors.Wrapf(err, `failed to create FIFO %s`, filename)
+		}
+	} else {
+		if err := opts.chmod(fs, filename, opts.fileMode); err != nil {
+			return nil, err
+		}
+		opts.chown(fs, filename)
+	}
+
+	// Writes to the pipe are handled by the runtime poller, so they
+	// still block the calling goroutine when the pipe is full
+	fh, err := os.OpenFile(filename, os.O_WRONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		if errors.Is(err, unix.ENXIO) {
+			return nil, errors.Wrapf(err, `no reader is attached to FIFO %s`, filename)
+		}
+		return nil, errors.Wrapf(err, `failed to open FIFO %s`, filename)
+	}
+	return fh, nil
+}
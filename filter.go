@@ -0,0 +1,17 @@
+package rotating
+
+// Filter is a function that decides if a record should be written. It
+// receives the complete record, and returns false if the record should
+// be dropped. The input must not be modified nor retained after the
+// function returns.
+type Filter func([]byte) bool
+
+// accept returns true if rec passes all of the filters
+func (f *File) accept(rec []byte) bool {
+	for _, filter := range f.filters {
+		if !filter(rec) {
+			return false
+		}
+	}
+	return true
+}
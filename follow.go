@@ -0,0 +1,188 @@
+package rotating
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultFollowInterval is the interval at which a Follower checks for
+// new data, if none was specified
+const defaultFollowInterval = 250 * time.Millisecond
+
+// Follower reads the data written to the files generated from a pattern,
+// much like `tail -F`: it reads the newest file, and when a newer file
+// appears (i.e. the File has been rotated), it finishes reading the
+// current file and switches to the new one. It is meant to be used by
+// in-process log forwarders, and by tests.
+//
+// Read blocks until data is available, or the context passed to Follow
+// is canceled. Changes are detected by polling the file system.
+type Follower struct {
+	ctx         context.Context
+	fs          FileSystem
+	globPattern string
+	parser      *nameParser
+	interval    time.Duration
+	filename    string
+	file        FileHandle
+	offset      int64
+	draining    bool
+}
+
+// Follow creates a Follower for the files generated from the given
+// strftime pattern, which should be the same pattern that was passed to
+// NewFile. Reading starts at the beginning of the newest file.
+//
+// The options that are honored are WithFileSystem, and WithCheckInterval,
+// which specifies the polling interval (250 milliseconds by default).
+func Follow(ctx context.Context, pattern string, options ...Option) *Follower {
+	fs := OSFileSystem()
+	interval := defaultFollowInterval
+	for _, option := range options {
+		switch option.Ident() {
+		case identFileSystem{}:
+			fs = option.Value().(FileSystem)
+		case identCheckInterval{}:
+			interval = option.Value().(time.Duration)
+		}
+	}
+
+	// Only the order of the files matters, so any location will do
+	parser := newNameParser(filepath.Clean(pattern), time.UTC)
+	return &Follower{
+		ctx:         ctx,
+		fs:          fs,
+		globPattern: globFromPattern(pattern),
+		parser:      parser,
+		interval:    interval,
+	}
+}
+
+// Position returns the name of the file that is currently being read,
+// and the offset of the next byte to be read
+func (r *Follower) Position() (string, int64) {
+	return r.filename, r.offset
+}
+
+// Read reads the next chunk of data
+func (r *Follower) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for {
+		n, err := r.read(p)
+		if n > 0 || err != nil {
+			return n, err
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// read attempts to read from the current file, switching files as
+// necessary. It returns 0 and no error if there is no data available
+func (r *Follower) read(p []byte) (int, error) {
+	if r.file == nil {
+		files, err := listLogFiles(r.fs, r.globPattern, r.parser)
+		if err != nil {
+			return 0, err
+		}
+		next := r.pick(files)
+		if next == "" {
+			return 0, nil
+		}
+		if err := r.open(next); err != nil {
+			return 0, err
+		}
+	}
+
+	for {
+		n, err := r.file.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, errors.Wrapf(err, `failed to read file %s`, r.filename)
+		}
+
+		if r.draining {
+			// The current file has been rotated out, and all of the
+			// data written to it has been read
+			r.draining = false
+			r.close()
+			return r.read(p)
+		}
+
+		if fi, err := r.fs.Stat(r.filename); err == nil && fi.Size() < r.offset {
+			// The file has been truncated. Start over from the beginning
+			if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+				return 0, errors.Wrapf(err, `failed to seek file %s`, r.filename)
+			}
+			r.offset = 0
+			continue
+		}
+
+		files, err := listLogFiles(r.fs, r.globPattern, r.parser)
+		if err != nil {
+			return 0, err
+		}
+		if nextLogFile(files, r.parser, r.filename) == "" {
+			return 0, nil
+		}
+
+		// A newer file exists. Read the current file once more, in
+		// case data was written to it right before the rotation
+		r.draining = true
+	}
+}
+
+// pick returns the file to read next: the newest file when starting,
+// or the first file after the one that was last read
+func (r *Follower) pick(files []logFile) string {
+	if r.filename == "" {
+		if len(files) == 0 {
+			return ""
+		}
+		return files[len(files)-1].name
+	}
+	return nextLogFile(files, r.parser, r.filename)
+}
+
+func (r *Follower) open(filename string) error {
+	fh, err := r.fs.OpenFile(filename, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.Wrapf(err, `failed to open file %s`, filename)
+	}
+	r.file = fh
+	r.filename = filename
+	r.offset = 0
+	return nil
+}
+
+func (r *Follower) close() {
+	if r.file != nil {
+		_ = r.file.Close()
+		r.file = nil
+	}
+}
+
+// Close closes the file that is currently being read
+func (r *Follower) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,167 @@
+package rotating_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFollow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Follow")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pattern := filepath.Join(dir, "%Y%m%d-%H%M%S.log")
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		pattern,
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithSynchronousRotation(true),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	// Data written before the follower starts is read from the
+	// beginning of the newest file
+	fmt.Fprintf(f, "line 0\n")
+
+	r := rotating.Follow(ctx, pattern, rotating.WithCheckInterval(10*time.Millisecond))
+	defer r.Close()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		if i > 0 {
+			if i%2 == 0 {
+				clock.Advance(6 * time.Second)
+			}
+			fmt.Fprintf(f, "line %d\n", i)
+		}
+
+		select {
+		case line := <-lines:
+			if !assert.Equal(t, fmt.Sprintf("line %d", i), line, `line should match`) {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, `timed out waiting for line %d`, i)
+			return
+		}
+	}
+
+	// Canceling the context stops the follower
+	cancel()
+	select {
+	case _, ok := <-lines:
+		assert.False(t, ok, `no more lines should be read`)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, `timed out waiting for the follower to stop`)
+		return
+	}
+
+	filename, offset := r.Position()
+	if !assert.Equal(t, filepath.Join(dir, "20210101-000010.log"), filename, `filename should match`) {
+		return
+	}
+	if !assert.Equal(t, int64(len("line 4\n")), offset, `offset should match`) {
+		return
+	}
+}
+
+func TestFollowGenerations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-FollowGenerations")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Compressed and overflow files are not followed
+	for _, name := range []string{"20210101.log.99.gz", "20210101.log.overflow"} {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("garbage\n"), 0644), `ioutil.WriteFile should succeed`) {
+			return
+		}
+	}
+
+	pattern := filepath.Join(dir, "%Y%m%d.log")
+	f, err := rotating.NewFile(
+		ctx,
+		pattern,
+		rotating.WithClock(NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))),
+		rotating.WithSynchronousRotation(true),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "line 0\n")
+
+	r := rotating.Follow(ctx, pattern, rotating.WithCheckInterval(10*time.Millisecond))
+	defer r.Close()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	// The generations are followed in numeric order, i.e. .log.10
+	// comes after .log.9
+	for i := 0; i < 12; i++ {
+		if i > 0 {
+			if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+				return
+			}
+			fmt.Fprintf(f, "line %d\n", i)
+		}
+
+		select {
+		case line := <-lines:
+			if !assert.Equal(t, fmt.Sprintf("line %d", i), line, `line should match`) {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, `timed out waiting for line %d`, i)
+			return
+		}
+	}
+
+	cancel()
+	for range lines {
+	}
+
+	filename, _ := r.Position()
+	if !assert.Equal(t, filepath.Join(dir, "20210101.log.11"), filename, `filename should match`) {
+		return
+	}
+}
@@ -0,0 +1,71 @@
+package rotating
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FooterInfo describes the file that a footer is about to be written to
+type FooterInfo struct {
+	// Filename is the name of the file that is being finalized
+	Filename string
+	// Next is the name of the file that succeeds this file. It is empty
+	// when the file is being finalized because the File is being closed
+	Next string
+	// BaseTime is the base time of the time slot that the file belongs to
+	BaseTime time.Time
+	// Records is the number of writes made to the file by this process
+	Records int64
+	// Bytes is the number of bytes written to the file by this process,
+	// excluding headers and footers
+	Bytes int64
+}
+
+// FooterFunc generates the footer that is written at the end of each
+// file, right before it is finalized
+type FooterFunc func(FooterInfo) []byte
+
+// writeFooter writes the continuation marker (see WithContinuationMarkers)
+// and the footer to the current file. Errors are reported to the error
+// handler, as they should not prevent the rotation.
+// It must be called while holding the lock
+func (f *File) writeFooter(next string) {
+	if f.filename == "" || f.sealed {
+		return
+	}
+
+	var tail []byte
+	if f.continuation && next != "" && next != f.filename {
+		tail = f.encodeFrame([]byte(fmt.Sprintf("-- continued in %s --\n", next)))
+	}
+	if f.footer != nil {
+		tail = append(tail, f.encodeFrame(f.footer(FooterInfo{
+			Filename: f.filename,
+			Next:     next,
+			BaseTime: f.fileBaseTime,
+			Records:  f.fileRecords,
+			Bytes:    f.fileBytes,
+		}))...)
+	}
+	if len(tail) == 0 {
+		return
+	}
+
+	if f.file == nil {
+		// The file handle may have been released because it was idle
+		w, err := f.openFileWithTimeout(f.filename, 0)
+		if err != nil {
+			f.handleError(errors.Wrapf(err, `failed to reopen file %s to write footer`, f.filename))
+			return
+		}
+		f.file = w
+	}
+
+	if _, err := f.file.Write(tail); err != nil {
+		f.handleError(errors.Wrapf(err, `failed to write footer to file %s`, f.filename))
+		return
+	}
+	f.mirrorWrite(f.filename, [][]byte{tail})
+}
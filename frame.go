@@ -0,0 +1,457 @@
+package rotating
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Each frame is preceded by a header containing the length of the payload
+// as a big-endian uint32. When the most significant bit of the length is
+// set, the header is followed by the CRC32 (Castagnoli) checksum of the
+// payload
+const (
+	frameHeaderSize   = 4
+	frameChecksumSize = 4
+	frameChecksumFlag = 1 << 31
+)
+
+// defaultMaxFrameSize bounds the size of the frames accepted by a
+// FrameReader, unless specified otherwise by WithMaxFrameSize
+const defaultMaxFrameSize = 64 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// frameBuffers prepends the frame header to the record composed of bufs
+func frameBuffers(bufs [][]byte, checksum bool) [][]byte {
+	var size int
+	for _, buf := range bufs {
+		size += len(buf)
+	}
+
+	var hdr []byte
+	if checksum {
+		var crc uint32
+		for _, buf := range bufs {
+			crc = crc32.Update(crc, crcTable, buf)
+		}
+		hdr = make([]byte, frameHeaderSize+frameChecksumSize)
+		binary.BigEndian.PutUint32(hdr, uint32(size)|frameChecksumFlag)
+		binary.BigEndian.PutUint32(hdr[frameHeaderSize:], crc)
+	} else {
+		hdr = make([]byte, frameHeaderSize)
+		binary.BigEndian.PutUint32(hdr, uint32(size))
+	}
+
+	framed := make([][]byte, 0, len(bufs)+1)
+	framed = append(framed, hdr)
+	return append(framed, bufs...)
+}
+
+// encodeFrame encodes data that is written outside of the regular write
+// path (e.g. headers and footers), so that the file can still be read
+// using a FrameReader when framing is enabled
+func (f *File) encodeFrame(b []byte) []byte {
+	if !f.framing {
+		return b
+	}
+	return joinBuffers(frameBuffers([][]byte{b}, f.frameChecksum))
+}
+
+// FrameReader reads the frames written by a File with framing enabled,
+// across all of the files generated from the same pattern. Files are
+// read in the order that they were started, as told by the time and the
+// generation in their names, and compressed files are skipped.
+//
+// When all of the available frames have been read, Next returns io.EOF.
+// Next may be called again after more data has been written, which
+// allows the FrameReader to be used as a simple durable queue.
+// Use Position and Seek to resume reading from where a previous
+// reader left off.
+//
+// Frames that fail the checksum verification (see WithFrameChecksum) or
+// that are larger than the maximum size (see WithMaxFrameSize) are
+// skipped, as are truncated frames at the end of files that have been
+// rotated out, e.g. because of a crash. The number of such frames is
+// reported by Unrecoverable. As the size of a corrupted frame cannot be
+// trusted, the reader resynchronizes by scanning forward for the next
+// frame whose checksum is valid. Without checksums, there is no way to
+// tell where the next frame starts, so the rest of the file is skipped.
+type FrameReader struct {
+	fs            FileSystem
+	globPattern   string
+	parser        *nameParser
+	filename      string
+	file          FileHandle
+	rdr           *bufio.Reader
+	offset        int64
+	unrecoverable int64
+	maxFrameSize  int64
+	resyncing     bool
+}
+
+// NewFrameReader creates a new FrameReader that reads the files generated
+// from the given strftime pattern, which should be the same pattern
+// that was passed to NewFile. The options that are honored are
+// WithFileSystem and WithMaxFrameSize
+func NewFrameReader(pattern string, options ...Option) *FrameReader {
+	fs := OSFileSystem()
+	var maxFrameSize int64 = defaultMaxFrameSize
+	for _, option := range options {
+		switch option.Ident() {
+		case identFileSystem{}:
+			fs = option.Value().(FileSystem)
+		case identMaxFrameSize{}:
+			maxFrameSize = option.Value().(int64)
+		}
+	}
+
+	// Only the order of the files matters, so any location will do
+	parser := newNameParser(filepath.Clean(pattern), time.UTC)
+	return &FrameReader{
+		fs:           fs,
+		globPattern:  globFromPattern(pattern),
+		parser:       parser,
+		maxFrameSize: maxFrameSize,
+	}
+}
+
+// Position returns the name of the file that is currently being read,
+// and the offset of the next frame in that file
+func (r *FrameReader) Position() (string, int64) {
+	return r.filename, r.offset
+}
+
+// Unrecoverable returns the number of frames that have been skipped
+// because they were corrupted or truncated
+func (r *FrameReader) Unrecoverable() int64 {
+	return r.unrecoverable
+}
+
+// Seek moves the reader to the given offset of the given file, which
+// should be a position previously returned by Position
+func (r *FrameReader) Seek(filename string, offset int64) error {
+	r.closeFile()
+	if err := r.openFile(filename); err != nil {
+		return err
+	}
+
+	if _, err := r.file.Seek(offset, io.SeekStart); err != nil {
+		r.closeFile()
+		return errors.Wrapf(err, `failed to seek file %s`, filename)
+	}
+	r.offset = offset
+	return nil
+}
+
+// Next returns the payload of the next frame. It returns io.EOF if there
+// are no more frames to be read at the moment
+func (r *FrameReader) Next() ([]byte, error) {
+	for {
+		if r.file == nil {
+			next, err := r.nextFile()
+			if err != nil {
+				return nil, err
+			}
+			if next == "" {
+				return nil, io.EOF
+			}
+			if err := r.openFile(next); err != nil {
+				return nil, err
+			}
+		}
+
+		var payload []byte
+		var err error
+		if r.resyncing {
+			err = r.resync()
+		}
+		if err == nil {
+			payload, err = r.readFrame()
+			if err == nil {
+				return payload, nil
+			}
+		}
+		if err == errChecksumMismatch || err == errFrameTooLarge {
+			// The size of the frame cannot be trusted, so look for the
+			// next frame starting from the following byte
+			r.unrecoverable++
+			r.offset++
+			r.resyncing = true
+			continue
+		}
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, errors.Wrapf(err, `failed to read frame from file %s`, r.filename)
+		}
+
+		// We have reached the end of the current file. If there are
+		// no newer files, the file may still be written to, so
+		// rewind to the beginning of the incomplete frame and wait
+		next, lerr := r.nextFile()
+		if lerr != nil {
+			return nil, lerr
+		}
+		if next == "" {
+			if _, serr := r.file.Seek(r.offset, io.SeekStart); serr != nil {
+				return nil, errors.Wrapf(serr, `failed to seek file %s`, r.filename)
+			}
+			r.rdr.Reset(r.file)
+			return nil, io.EOF
+		}
+
+		if r.resyncing {
+			if err == io.ErrUnexpectedEOF {
+				// The candidate frame will never be completed, so keep
+				// looking past it
+				r.offset++
+				continue
+			}
+		} else if err == io.ErrUnexpectedEOF {
+			// The file will never be completed, so the rest of the
+			// file cannot be recovered
+			r.unrecoverable++
+		}
+		r.closeFile()
+	}
+}
+
+// Close closes the file that is currently being read
+func (r *FrameReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	r.rdr = nil
+	return err
+}
+
+var errChecksumMismatch = errors.New(`frame checksum mismatch`)
+var errFrameTooLarge = errors.New(`frame size exceeds the maximum`)
+
+func (r *FrameReader) readFrame() ([]byte, error) {
+	var hdr [frameHeaderSize + frameChecksumSize]byte
+	if _, err := io.ReadFull(r.rdr, hdr[:frameHeaderSize]); err != nil {
+		return nil, err
+	}
+
+	hdrSize := frameHeaderSize
+	size := binary.BigEndian.Uint32(hdr[:])
+	checksum := size&frameChecksumFlag != 0
+	if checksum {
+		size &^= frameChecksumFlag
+		hdrSize += frameChecksumSize
+		if _, err := io.ReadFull(r.rdr, hdr[frameHeaderSize:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	if int64(size) > r.maxFrameSize {
+		return nil, errFrameTooLarge
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r.rdr, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if checksum && crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(hdr[frameHeaderSize:]) {
+		return nil, errChecksumMismatch
+	}
+	r.offset += int64(hdrSize + len(payload))
+	return payload, nil
+}
+
+// resync scans the current file forward from the current offset for a
+// frame whose checksum is valid, and positions the reader at its
+// beginning. It returns io.EOF if the end of the file was reached, and
+// io.ErrUnexpectedEOF if a candidate frame extends past the end of the
+// file, in which case r.offset is the offset of the candidate
+func (r *FrameReader) resync() error {
+	if _, err := r.file.Seek(r.offset, io.SeekStart); err != nil {
+		return errors.Wrapf(err, `failed to seek file %s`, r.filename)
+	}
+	r.rdr.Reset(r.file)
+
+	for {
+		hdr, err := r.rdr.Peek(frameHeaderSize + frameChecksumSize)
+		if err != nil {
+			return err
+		}
+		ok, err := r.validFrame(hdr)
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.resyncing = false
+			return nil
+		}
+		if _, err := r.rdr.Discard(1); err != nil {
+			return err
+		}
+		r.offset++
+	}
+}
+
+// validFrame returns true if a frame with the given header, whose
+// checksum matches its payload, starts at the current offset
+func (r *FrameReader) validFrame(hdr []byte) (bool, error) {
+	size := binary.BigEndian.Uint32(hdr)
+	if size&frameChecksumFlag == 0 {
+		return false, nil
+	}
+	size &^= frameChecksumFlag
+	if int64(size) > r.maxFrameSize {
+		return false, nil
+	}
+	checksum := binary.BigEndian.Uint32(hdr[frameHeaderSize:])
+
+	total := frameHeaderSize + frameChecksumSize + int(size)
+	if total <= r.rdr.Size() {
+		buf, err := r.rdr.Peek(total)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return false, err
+		}
+		return crc32.Checksum(buf[frameHeaderSize+frameChecksumSize:], crcTable) == checksum, nil
+	}
+
+	// The frame does not fit in the buffer, so read it from the file,
+	// and rewind afterwards
+	if _, err := r.file.Seek(r.offset+int64(frameHeaderSize+frameChecksumSize), io.SeekStart); err != nil {
+		return false, errors.Wrapf(err, `failed to seek file %s`, r.filename)
+	}
+	h := crc32.New(crcTable)
+	_, err := io.CopyN(h, r.file, int64(size))
+	if _, serr := r.file.Seek(r.offset, io.SeekStart); serr != nil {
+		return false, errors.Wrapf(serr, `failed to seek file %s`, r.filename)
+	}
+	r.rdr.Reset(r.file)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return false, err
+	}
+	return h.Sum32() == checksum, nil
+}
+
+// nextFile returns the name of the first file that comes after the
+// current file, or an empty string if there is none
+func (r *FrameReader) nextFile() (string, error) {
+	files, err := listLogFiles(r.fs, r.globPattern, r.parser)
+	if err != nil {
+		return "", err
+	}
+	if r.filename == "" {
+		if len(files) == 0 {
+			return "", nil
+		}
+		return files[0].name, nil
+	}
+	return nextLogFile(files, r.parser, r.filename), nil
+}
+
+// listFiles returns the regular files that match the glob pattern, in
+// file name order, excluding temporary files and the files that have
+// been opened ahead of time (see WithPreopen)
+func listFiles(fs FileSystem, globPattern string) ([]string, error) {
+	matches, err := fs.Glob(globPattern)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to apply glob pattern`)
+	}
+	sort.Strings(matches)
+
+	preopened := make(map[string]struct{})
+	for _, path := range matches {
+		if strings.HasSuffix(path, preopenMarkerSuffix) {
+			preopened[strings.TrimSuffix(path, preopenMarkerSuffix)] = struct{}{}
+		}
+	}
+
+	files := matches[:0]
+	for _, path := range matches {
+		if isTemporaryFile(path) {
+			continue
+		}
+		if _, ok := preopened[path]; ok {
+			continue
+		}
+		if fi, err := fs.Lstat(path); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// listLogFiles returns the files generated from the pattern parsed by
+// parser that are being written to, or have been rotated out as they
+// are, in the order that they were started. Compressed, overflow and
+// temporary files, whose names have a suffix after the generation, are
+// excluded
+func listLogFiles(fs FileSystem, globPattern string, parser *nameParser) ([]logFile, error) {
+	matches, err := listFiles(fs, globPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]logFile, 0, len(matches))
+	for _, name := range matches {
+		if e, ok := parser.parseFile(name); ok && e.suffix == "" {
+			files = append(files, e)
+		}
+	}
+	sortLogFiles(files)
+	return files, nil
+}
+
+// nextLogFile returns the name of the first of files that was started
+// after the given file, or an empty string if there is none
+func nextLogFile(files []logFile, parser *nameParser, filename string) string {
+	current, ok := parser.parseFile(filename)
+	if !ok {
+		return ""
+	}
+	for _, e := range files {
+		if current.before(e) {
+			return e.name
+		}
+	}
+	return ""
+}
+
+func (r *FrameReader) openFile(filename string) error {
+	fh, err := r.fs.OpenFile(filename, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.Wrapf(err, `failed to open file %s`, filename)
+	}
+	r.file = fh
+	r.rdr = bufio.NewReader(fh)
+	r.filename = filename
+	r.offset = 0
+	r.resyncing = false
+	return nil
+}
+
+func (r *FrameReader) closeFile() {
+	if r.file != nil {
+		_ = r.file.Close()
+		r.file = nil
+		r.rdr = nil
+	}
+}
@@ -0,0 +1,109 @@
+package rotating
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FileHandle is a file opened through a FileSystem. *os.File satisfies
+// this interface
+type FileHandle interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+}
+
+// FileSystem is the interface through which File and FrameReader access
+// the file system. The default implementation, returned by OSFileSystem,
+// uses the os package. Other implementations may target chroots, virtual
+// file systems such as afero (through a small adapter), or in-memory file
+// systems for tests.
+//
+// Errors should be compatible with the os package, so that os.IsNotExist
+// can be used to detect missing files.
+//
+// To support WithOwner and WithExactPermissions, implementations may also
+// provide `Chown(name string, uid, gid int) error` and
+// `Chmod(name string, mode os.FileMode) error` methods, and to support
+// WithDirSync, a `SyncDir(name string) error` method.
+type FileSystem interface {
+	OpenFile(name string, flag int, perm os.FileMode) (FileHandle, error)
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	Glob(pattern string) ([]string, error)
+	Remove(name string) error
+	Rename(oldpath, newpath string) error
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+	MkdirAll(path string, perm os.FileMode) error
+}
+
+type osFileSystem struct{}
+
+// OSFileSystem returns the FileSystem that uses the os package
+func OSFileSystem() FileSystem {
+	return osFileSystem{}
+}
+
+func (osFileSystem) OpenFile(name string, flag int, perm os.FileMode) (FileHandle, error) {
+	fh, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return fh, nil
+}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osFileSystem) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+func (osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFileSystem) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFileSystem) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (osFileSystem) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (osFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFileSystem) Chown(name string, uid, gid int) error {
+	return os.Chown(name, uid, gid)
+}
+
+func (osFileSystem) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (osFileSystem) SyncDir(name string) error {
+	return syncDir(name)
+}
+
+// isOSFileSystem reports whether the files are regular files accessed
+// through the os package. Features that depend on *os.File (memory
+// mapping, preallocation, and named pipes) are only available in that
+// case
+func isOSFileSystem(fs FileSystem) bool {
+	_, ok := fs.(osFileSystem)
+	return ok
+}
@@ -0,0 +1,408 @@
+package rotating_test
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+// chrootFS is a FileSystem that confines all paths to a directory,
+// and records the operations that were performed through it
+type chrootFS struct {
+	root string
+
+	mu  sync.Mutex
+	ops map[string]int
+}
+
+func (fs *chrootFS) path(name string) string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return filepath.Join(fs.root, name)
+}
+
+func (fs *chrootFS) record(op string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.ops == nil {
+		fs.ops = make(map[string]int)
+	}
+	fs.ops[op]++
+}
+
+func (fs *chrootFS) count(op string) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.ops[op]
+}
+
+func (fs *chrootFS) OpenFile(name string, flag int, perm os.FileMode) (rotating.FileHandle, error) {
+	fs.record("open")
+	fh, err := os.OpenFile(fs.path(name), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return fh, nil
+}
+
+func (fs *chrootFS) Stat(name string) (os.FileInfo, error) {
+	fs.record("stat")
+	return os.Stat(fs.path(name))
+}
+
+func (fs *chrootFS) Lstat(name string) (os.FileInfo, error) {
+	fs.record("lstat")
+	return os.Lstat(fs.path(name))
+}
+
+func (fs *chrootFS) Glob(pattern string) ([]string, error) {
+	fs.record("glob")
+	matches, err := filepath.Glob(fs.path(pattern))
+	if err != nil {
+		return nil, err
+	}
+	for i, match := range matches {
+		matches[i] = strings.TrimPrefix(match, fs.root)
+	}
+	return matches, nil
+}
+
+func (fs *chrootFS) Remove(name string) error {
+	fs.record("remove")
+	return os.Remove(fs.path(name))
+}
+
+func (fs *chrootFS) Rename(oldpath, newpath string) error {
+	fs.record("rename")
+	return os.Rename(fs.path(oldpath), fs.path(newpath))
+}
+
+func (fs *chrootFS) Symlink(oldname, newname string) error {
+	fs.record("symlink")
+	return os.Symlink(oldname, fs.path(newname))
+}
+
+func (fs *chrootFS) Readlink(name string) (string, error) {
+	fs.record("readlink")
+	return os.Readlink(fs.path(name))
+}
+
+func (fs *chrootFS) MkdirAll(path string, perm os.FileMode) error {
+	fs.record("mkdir")
+	return os.MkdirAll(fs.path(path), perm)
+}
+
+func TestFileSystem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-FileSystem")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	fs := &chrootFS{root: dir}
+	pattern := "/logs/%Y%m%d-%H%M%S.log"
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		pattern,
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithRotationCount(3),
+		rotating.WithSymlink("/logs/current"),
+		rotating.WithFraming(true),
+		rotating.WithFileSystem(fs),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(f, "record %d", i)
+		clock.Advance(6 * time.Second)
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	// All of the files are created inside the root
+	entries, err := ioutil.ReadDir(filepath.Join(dir, "logs"))
+	if !assert.NoError(t, err, `ioutil.ReadDir should succeed`) {
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	if !assert.Equal(t, []string{"20210101-000000.log", "20210101-000005.log", "20210101-000010.log", "current"}, names, `files should match`) {
+		return
+	}
+
+	for _, op := range []string{"open", "stat", "glob", "remove", "rename", "symlink", "readlink", "mkdir"} {
+		if !assert.NotZero(t, fs.count(op), `%s should go through the file system`, op) {
+			return
+		}
+	}
+
+	r := rotating.NewFrameReader(pattern, rotating.WithFileSystem(fs))
+	defer r.Close()
+	for _, expected := range []string{"record 0", "record 1", "record 2"} {
+		payload, err := r.Next()
+		if !assert.NoError(t, err, `r.Next should succeed`) {
+			return
+		}
+		if !assert.Equal(t, expected, string(payload), `payload should match`) {
+			return
+		}
+	}
+}
+
+// removeFS adds Remove to fstest.MapFS
+type removeFS struct {
+	fstest.MapFS
+}
+
+func (fsys removeFS) Remove(name string) error {
+	if _, ok := fsys.MapFS[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(fsys.MapFS, name)
+	return nil
+}
+
+func TestPurge(t *testing.T) {
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	fsys := removeFS{MapFS: fstest.MapFS{
+		"logs/20210101.log": {ModTime: now.Add(-9 * 24 * time.Hour)},
+		"logs/20210107.log": {ModTime: now.Add(-3 * 24 * time.Hour)},
+		"logs/20210108.log": {ModTime: now.Add(-2 * 24 * time.Hour)},
+		"logs/20210109.log": {ModTime: now.Add(-1 * 24 * time.Hour)},
+		"logs/20210110.log": {ModTime: now},
+		"other/app.log":     {ModTime: now.Add(-9 * 24 * time.Hour)},
+	}}
+
+	err := rotating.Purge(
+		fsys,
+		"logs/%Y%m%d.log",
+		rotating.WithClock(NewFakeClock(now)),
+		rotating.WithMaxAge(7*24*time.Hour),
+		rotating.WithRotationCount(3),
+	)
+	if !assert.NoError(t, err, `rotating.Purge should succeed`) {
+		return
+	}
+
+	var names []string
+	for name := range fsys.MapFS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !assert.Equal(t, []string{"logs/20210108.log", "logs/20210109.log", "logs/20210110.log", "other/app.log"}, names, `remaining files should match`) {
+		return
+	}
+}
+
+func TestPurgeRetainSlots(t *testing.T) {
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	fsys := removeFS{MapFS: fstest.MapFS{
+		"logs/20210108.log":   {ModTime: now},
+		"logs/20210108.log.1": {ModTime: now},
+		"logs/20210109.log":   {ModTime: now},
+		"logs/20210109.log.1": {ModTime: now},
+		"logs/20210109.log.2": {ModTime: now},
+		"logs/20210110.log":   {ModTime: now},
+	}}
+
+	err := rotating.Purge(
+		fsys,
+		"logs/%Y%m%d.log",
+		rotating.WithClock(NewFakeClock(now)),
+		rotating.WithRetainSlots(2),
+	)
+	if !assert.NoError(t, err, `rotating.Purge should succeed`) {
+		return
+	}
+
+	var names []string
+	for name := range fsys.MapFS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !assert.Equal(t, []string{"logs/20210109.log", "logs/20210109.log.1", "logs/20210109.log.2", "logs/20210110.log"}, names, `remaining files should match`) {
+		return
+	}
+
+	err = rotating.Purge(fsys, "logs/app.log", rotating.WithRetainSlots(2))
+	if !assert.Error(t, err, `rotating.Purge should fail if the pattern does not contain the time`) {
+		return
+	}
+}
+
+func TestPurgeCompressed(t *testing.T) {
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	fsys := removeFS{MapFS: fstest.MapFS{
+		"logs/20210109.log.gz":   {ModTime: now},
+		"logs/20210110.log.gz":   {ModTime: now},
+		"logs/20210110.log.1.gz": {ModTime: now},
+		"logs/20210110.log.2":    {ModTime: now},
+	}}
+
+	err := rotating.Purge(
+		fsys,
+		"logs/%Y%m%d.log",
+		rotating.WithClock(NewFakeClock(now)),
+		rotating.WithRotationCount(2),
+	)
+	if !assert.NoError(t, err, `rotating.Purge should succeed`) {
+		return
+	}
+
+	var names []string
+	for name := range fsys.MapFS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !assert.Equal(t, []string{"logs/20210110.log.1.gz", "logs/20210110.log.2"}, names, `remaining files should match`) {
+		return
+	}
+}
+
+func TestPurgeCompressor(t *testing.T) {
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	fsys := removeFS{MapFS: fstest.MapFS{
+		"logs/20210110.log.up":   {ModTime: now},
+		"logs/20210110.log.1.up": {ModTime: now},
+		"logs/20210110.log.2":    {ModTime: now},
+	}}
+
+	err := rotating.Purge(
+		fsys,
+		"logs/%Y%m%d.log",
+		rotating.WithClock(NewFakeClock(now)),
+		rotating.WithCompressor(upperCompressor{}),
+		rotating.WithRotationCount(2),
+	)
+	if !assert.NoError(t, err, `rotating.Purge should succeed`) {
+		return
+	}
+
+	var names []string
+	for name := range fsys.MapFS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !assert.Equal(t, []string{"logs/20210110.log.1.up", "logs/20210110.log.2"}, names, `remaining files should match`) {
+		return
+	}
+}
+
+func TestPurgeMaxTotalSize(t *testing.T) {
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	fsys := removeFS{MapFS: fstest.MapFS{
+		"logs/20210106.log": {ModTime: now, Data: make([]byte, 40)},
+		"logs/20210107.log": {ModTime: now, Data: make([]byte, 30)},
+		"logs/20210108.log": {ModTime: now, Data: make([]byte, 20)},
+		"logs/20210109.log": {ModTime: now, Data: make([]byte, 10)},
+		"logs/20210110.log": {ModTime: now, Data: make([]byte, 100)},
+	}}
+
+	// The current file does not count towards the total size
+	err := rotating.Purge(
+		fsys,
+		"logs/%Y%m%d.log",
+		rotating.WithClock(NewFakeClock(now)),
+		rotating.WithMaxTotalSize(55),
+	)
+	if !assert.NoError(t, err, `rotating.Purge should succeed`) {
+		return
+	}
+
+	var names []string
+	for name := range fsys.MapFS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !assert.Equal(t, []string{"logs/20210108.log", "logs/20210109.log", "logs/20210110.log"}, names, `remaining files should match`) {
+		return
+	}
+}
+
+func TestPurgePreopened(t *testing.T) {
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	fsys := removeFS{MapFS: fstest.MapFS{
+		"logs/20210108.log":         {ModTime: now},
+		"logs/20210109.log":         {ModTime: now},
+		"logs/20210110.log":         {ModTime: now},
+		"logs/20210111.log":         {ModTime: now},
+		"logs/20210111.log_preopen": {ModTime: now},
+	}}
+
+	// The file opened ahead of time does not count towards the rotation
+	// count, and is not removed
+	err := rotating.Purge(
+		fsys,
+		"logs/%Y%m%d.log",
+		rotating.WithClock(NewFakeClock(now)),
+		rotating.WithRotationCount(2),
+	)
+	if !assert.NoError(t, err, `rotating.Purge should succeed`) {
+		return
+	}
+
+	var names []string
+	for name := range fsys.MapFS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !assert.Equal(t, []string{"logs/20210109.log", "logs/20210110.log", "logs/20210111.log", "logs/20210111.log_preopen"}, names, `remaining files should match`) {
+		return
+	}
+}
+
+func TestPurgeOverflow(t *testing.T) {
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	fsys := removeFS{MapFS: fstest.MapFS{
+		"logs/20210101.log":          {ModTime: now.Add(-9 * 24 * time.Hour)},
+		"logs/20210101.log.overflow": {ModTime: now.Add(-9 * 24 * time.Hour)},
+		"logs/20210109.log":          {ModTime: now.Add(-1 * 24 * time.Hour)},
+		"logs/20210109.log.overflow": {ModTime: now.Add(-1 * 24 * time.Hour)},
+		"logs/20210110.log":          {ModTime: now},
+	}}
+
+	// Overflow files do not count towards the rotation count, and are
+	// only removed because of their age
+	err := rotating.Purge(
+		fsys,
+		"logs/%Y%m%d.log",
+		rotating.WithClock(NewFakeClock(now)),
+		rotating.WithMaxAge(7*24*time.Hour),
+		rotating.WithRotationCount(2),
+	)
+	if !assert.NoError(t, err, `rotating.Purge should succeed`) {
+		return
+	}
+
+	var names []string
+	for name := range fsys.MapFS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !assert.Equal(t, []string{"logs/20210109.log", "logs/20210109.log.overflow", "logs/20210110.log"}, names, `remaining files should match`) {
+		return
+	}
+}
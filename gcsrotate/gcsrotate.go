@@ -0,0 +1,182 @@
+// Package gcsrotate uploads the files that have been rotated out by a
+// *rotating.File to Google Cloud Storage.
+//
+// The package does not depend on the Cloud Storage client library.
+// Instead, the Uploader uses the small Client interface, which
+// *storage.Client can be adapted to:
+//
+//	type client struct {
+//		*storage.Client
+//	}
+//
+//	func (c client) Upload(ctx context.Context, bucket, object string, body io.Reader) error {
+//		w := c.Client.Bucket(bucket).Object(object).NewWriter(ctx)
+//		if _, err := io.Copy(w, body); err != nil {
+//			w.Close()
+//			return err
+//		}
+//		return w.Close()
+//	}
+package gcsrotate
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lestrrat-go/backoff"
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+)
+
+// Client uploads objects to Cloud Storage. The object must only be
+// visible once Upload has returned successfully
+type Client interface {
+	Upload(ctx context.Context, bucket, object string, body io.Reader) error
+}
+
+// Options configures the Uploader
+type Options struct {
+	// Prefix is prepended to the base names of the files to form the
+	// names of the objects, e.g. "logs/app/"
+	Prefix string
+
+	// Backoff specifies how failed uploads are retried. By default each
+	// upload is attempted only once
+	Backoff backoff.Policy
+
+	// OnComplete is called after a file has been uploaded, e.g. to verify
+	// the object before the file is removed. If it returns an error, the
+	// upload is considered to have failed, and the file is kept
+	OnComplete func(ctx context.Context, filename, object string) error
+
+	// DeleteLocal specifies that files are removed once they have been
+	// uploaded (and verified by OnComplete) successfully
+	DeleteLocal bool
+
+	// Timeout bounds the time spent on each attempt to upload a file. If
+	// zero, the attempts are not bounded
+	Timeout time.Duration
+
+	// ErrorHandler is called with the errors that occur while uploading
+	// the files handed over by RotateHook. If nil, they are discarded
+	ErrorHandler func(error)
+}
+
+// Uploader uploads files to a bucket
+type Uploader struct {
+	client      Client
+	bucket      string
+	prefix      string
+	backoff     backoff.Policy
+	onComplete  func(context.Context, string, string) error
+	deleteLocal bool
+	timeout     time.Duration
+	onError     func(error)
+}
+
+// New creates a new Uploader that uploads files to the given bucket
+// using client. If opts is nil, the default options are used.
+func New(client Client, bucket string, opts *Options) *Uploader {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	bo := opts.Backoff
+	if bo == nil {
+		bo = backoff.Null()
+	}
+
+	return &Uploader{
+		client:      client,
+		bucket:      bucket,
+		prefix:      opts.Prefix,
+		backoff:     bo,
+		onComplete:  opts.OnComplete,
+		deleteLocal: opts.DeleteLocal,
+		timeout:     opts.Timeout,
+		onError:     opts.ErrorHandler,
+	}
+}
+
+// Object returns the name of the object that the given file is uploaded to
+func (u *Uploader) Object(filename string) string {
+	return u.prefix + filepath.Base(filename)
+}
+
+// Upload uploads the given file, retrying as specified by the Backoff
+// option, and removes it afterwards if DeleteLocal was specified. The
+// error of the last attempt is returned if all of them failed.
+func (u *Uploader) Upload(ctx context.Context, filename string) error {
+	object := u.Object(filename)
+
+	var lastError error
+	b := u.backoff.Start(ctx)
+	for backoff.Continue(b) {
+		if lastError = u.upload(ctx, filename, object); lastError == nil {
+			break
+		}
+	}
+	if lastError == nil {
+		// No attempt was made, or the last one succeeded
+		lastError = ctx.Err()
+	}
+	if lastError != nil {
+		return errors.Wrapf(lastError, `gcsrotate: failed to upload file %s to gs://%s/%s`, filename, u.bucket, object)
+	}
+
+	if u.onComplete != nil {
+		if err := u.onComplete(ctx, filename, object); err != nil {
+			return errors.Wrapf(err, `gcsrotate: failed to complete upload of file %s to gs://%s/%s`, filename, u.bucket, object)
+		}
+	}
+
+	if u.deleteLocal {
+		if err := os.Remove(filename); err != nil {
+			return errors.Wrapf(err, `gcsrotate: failed to remove uploaded file %s`, filename)
+		}
+	}
+	return nil
+}
+
+// upload makes a single attempt to upload the file
+func (u *Uploader) upload(ctx context.Context, filename, object string) error {
+	if u.timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, u.timeout)
+		defer cancel()
+	}
+
+	fh, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrap(err, `failed to open file`)
+	}
+	defer fh.Close()
+
+	return u.client.Upload(ctx, u.bucket, object, fh)
+}
+
+// RotateHook uploads the file that has been rotated out. Pass it to
+// rotating.WithRotateHook to upload each file once it is complete:
+//
+//	f, err := rotating.NewFile(ctx, pattern, rotating.WithRotateHook(uploader.RotateHook))
+//
+// The upload (including the retries) is performed synchronously by the
+// goroutine that calls the hook, so the background tasks of the File that
+// follow it (e.g. purging old files) wait for it.
+func (u *Uploader) RotateHook(info rotating.RotationInfo) {
+	if err := u.Upload(context.Background(), info.Previous); err != nil && u.onError != nil {
+		u.onError(err)
+	}
+}
+
+// Archive uploads the given file. It implements rotating.Archiver, so the
+// Uploader can be passed to rotating.WithArchiver, which keeps the files
+// from being purged until they have been uploaded:
+//
+//	f, err := rotating.NewFile(ctx, pattern, rotating.WithArchiver(uploader))
+func (u *Uploader) Archive(ctx context.Context, filename string) error {
+	return u.Upload(ctx, filename)
+}
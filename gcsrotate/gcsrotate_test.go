@@ -0,0 +1,170 @@
+package gcsrotate_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/backoff"
+	"github.com/lestrrat-go/rotating"
+	"github.com/lestrrat-go/rotating/gcsrotate"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClient struct {
+	mu       sync.Mutex
+	objects  map[string]string
+	failures int
+	attempts int
+}
+
+func (c *fakeClient) Upload(ctx context.Context, bucket, object string, body io.Reader) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.attempts++
+	if c.failures > 0 {
+		c.failures--
+		return errors.New(`service unavailable`)
+	}
+
+	buf, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	c.objects[bucket+"/"+object] = string(buf)
+	return nil
+}
+
+func (c *fakeClient) object(name string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.objects[name]
+	return v, ok
+}
+
+var _ rotating.Archiver = (*gcsrotate.Uploader)(nil)
+
+func TestUploader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcsrotate_test")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	client := &fakeClient{objects: make(map[string]string), failures: 2}
+	var errs []error
+	var completed []string
+	uploader := gcsrotate.New(client, "bucket", &gcsrotate.Options{
+		Prefix:      "logs/",
+		Backoff:     backoff.Constant(backoff.WithInterval(time.Millisecond), backoff.WithMaxRetries(3)),
+		DeleteLocal: true,
+		OnComplete: func(ctx context.Context, filename, object string) error {
+			// the file must still be there while the upload is verified
+			buf, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return err
+			}
+			if v, _ := client.object("bucket/" + object); v != string(buf) {
+				return errors.Errorf(`object %s does not match file %s`, object, filename)
+			}
+			completed = append(completed, object)
+			return nil
+		},
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(rotating.ClockFn(func() time.Time {
+			return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		})),
+		rotating.WithRotateHook(uploader.RotateHook),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	fmt.Fprintf(f, "Hello, World\n")
+	if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+		return
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	if !assert.Empty(t, errs, `there should be no errors`) {
+		return
+	}
+	if !assert.Equal(t, 3, client.attempts, `the upload should have been retried`) {
+		return
+	}
+	if !assert.Equal(t, []string{"logs/20210101.log"}, completed, `the upload should have been completed`) {
+		return
+	}
+	expected := map[string]string{
+		"bucket/logs/20210101.log": "Hello, World\n",
+	}
+	if !assert.Equal(t, expected, client.objects, `uploaded objects should match`) {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20210101.log")); !assert.True(t, os.IsNotExist(err), `the uploaded file should have been removed`) {
+		return
+	}
+}
+
+func TestUploaderError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcsrotate_test-Error")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log")
+	if !assert.NoError(t, ioutil.WriteFile(filename, []byte("Hello, World\n"), 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	t.Run("Retries exhausted", func(t *testing.T) {
+		client := &fakeClient{objects: make(map[string]string), failures: 10}
+		uploader := gcsrotate.New(client, "bucket", &gcsrotate.Options{
+			Backoff:     backoff.Constant(backoff.WithInterval(time.Millisecond), backoff.WithMaxRetries(2)),
+			DeleteLocal: true,
+		})
+		if !assert.Error(t, uploader.Upload(context.Background(), filename), `uploader.Upload should fail`) {
+			return
+		}
+		if !assert.Equal(t, 3, client.attempts, `the upload should have been attempted 3 times`) {
+			return
+		}
+		if _, err := os.Stat(filename); !assert.NoError(t, err, `the file should be kept if the upload failed`) {
+			return
+		}
+	})
+	t.Run("Verification failed", func(t *testing.T) {
+		client := &fakeClient{objects: make(map[string]string)}
+		uploader := gcsrotate.New(client, "bucket", &gcsrotate.Options{
+			DeleteLocal: true,
+			OnComplete: func(context.Context, string, string) error {
+				return errors.New(`checksum mismatch`)
+			},
+		})
+		if !assert.Error(t, uploader.Upload(context.Background(), filename), `uploader.Upload should fail`) {
+			return
+		}
+		if _, err := os.Stat(filename); !assert.NoError(t, err, `the file should be kept if the verification failed`) {
+			return
+		}
+	})
+}
@@ -0,0 +1,11 @@
+module github.com/lestrrat-go/rotating/grpcrotate
+
+go 1.16
+
+require (
+	github.com/lestrrat-go/rotating v0.0.0-00010101000000-000000000000
+	github.com/stretchr/testify v1.7.0
+	google.golang.org/grpc v1.46.2
+)
+
+replace github.com/lestrrat-go/rotating => ../
@@ -0,0 +1,136 @@
+// Package grpcrotate provides a grpclog.LoggerV2 and gRPC server
+// interceptors that write to a *rotating.File:
+//
+//	grpclog.SetLoggerV2(grpcrotate.NewLogger(internalLog, 0))
+//	srv := grpc.NewServer(
+//		grpc.UnaryInterceptor(grpcrotate.UnaryServerInterceptor(requestLog)),
+//		grpc.StreamInterceptor(grpcrotate.StreamServerInterceptor(requestLog)),
+//	)
+package grpcrotate
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Logger is a grpclog.LoggerV2 that writes to a *rotating.File, in the
+// same format as grpc's default logger
+type Logger struct {
+	file      *rotating.File
+	verbosity int
+	info      *log.Logger
+	warning   *log.Logger
+	error     *log.Logger
+	fatal     *log.Logger
+}
+
+var _ grpclog.LoggerV2 = (*Logger)(nil)
+
+// NewLogger creates a new Logger. V(l) reports true for levels up to
+// the given verbosity
+func NewLogger(f *rotating.File, verbosity int) *Logger {
+	return &Logger{
+		file:      f,
+		verbosity: verbosity,
+		info:      log.New(f, "INFO: ", log.LstdFlags),
+		warning:   log.New(f, "WARNING: ", log.LstdFlags),
+		error:     log.New(f, "ERROR: ", log.LstdFlags),
+		fatal:     log.New(f, "FATAL: ", log.LstdFlags),
+	}
+}
+
+func (l *Logger) Info(args ...interface{})                 { l.info.Print(args...) }
+func (l *Logger) Infoln(args ...interface{})               { l.info.Println(args...) }
+func (l *Logger) Infof(format string, args ...interface{}) { l.info.Printf(format, args...) }
+
+func (l *Logger) Warning(args ...interface{})                 { l.warning.Print(args...) }
+func (l *Logger) Warningln(args ...interface{})               { l.warning.Println(args...) }
+func (l *Logger) Warningf(format string, args ...interface{}) { l.warning.Printf(format, args...) }
+
+func (l *Logger) Error(args ...interface{})                 { l.error.Print(args...) }
+func (l *Logger) Errorln(args ...interface{})               { l.error.Println(args...) }
+func (l *Logger) Errorf(format string, args ...interface{}) { l.error.Printf(format, args...) }
+
+// Fatal, Fatalln, and Fatalf write the message, close the file, and
+// exit the process, as required by grpclog.LoggerV2
+func (l *Logger) Fatal(args ...interface{}) {
+	l.fatal.Print(args...)
+	l.exit()
+}
+
+func (l *Logger) Fatalln(args ...interface{}) {
+	l.fatal.Println(args...)
+	l.exit()
+}
+
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.fatal.Printf(format, args...)
+	l.exit()
+}
+
+func (l *Logger) exit() {
+	l.file.Close()
+	os.Exit(1)
+}
+
+// V reports whether the verbosity level l is enabled
+func (l *Logger) V(level int) bool {
+	return level <= l.verbosity
+}
+
+// UnaryServerInterceptor returns an interceptor that writes a line to f
+// for each unary call. See StreamServerInterceptor for the format
+func UnaryServerInterceptor(f *rotating.File) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		writeEntry(f, ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that writes a line to
+// f for each streaming call, once the call has completed. The line
+// consists of the start time, the address of the peer, the method, the
+// status code, and the duration, separated by spaces:
+//
+//	2021-01-01T00:00:00Z 192.0.2.1:1234 /pkg.Service/Method OK 0.001234
+func StreamServerInterceptor(f *rotating.File) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		writeEntry(f, ss.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+// writeEntry writes a single request log entry. Errors writing to f
+// are ignored, as they cannot be reported to the client
+func writeEntry(f *rotating.File, ctx context.Context, method string, start time.Time, err error) {
+	addr := "-"
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+
+	buf := make([]byte, 0, 128)
+	buf = start.AppendFormat(buf, time.RFC3339)
+	buf = append(buf, ' ')
+	buf = append(buf, addr...)
+	buf = append(buf, ' ')
+	buf = append(buf, method...)
+	buf = append(buf, ' ')
+	buf = append(buf, status.Code(err).String()...)
+	buf = append(buf, ' ')
+	buf = strconv.AppendFloat(buf, time.Since(start).Seconds(), 'f', 6, 64)
+	buf = append(buf, '\n')
+	_, _ = f.Write(buf)
+}
@@ -0,0 +1,129 @@
+package grpcrotate_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/lestrrat-go/rotating/grpcrotate"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestInterceptors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grpcrotate-")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := rotating.NewFile(context.Background(), filepath.Join(dir, "requests.log"))
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1234},
+	})
+
+	unary := grpcrotate.UnaryServerInterceptor(f)
+	resp, err := unary(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/test.Service/Unary"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "resp", nil
+	})
+	if !assert.NoError(t, err, `unary call should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "resp", resp, `response should be passed through`) {
+		return
+	}
+
+	stream := grpcrotate.StreamServerInterceptor(f)
+	err = stream(nil, &serverStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}, func(srv interface{}, ss grpc.ServerStream) error {
+		return status.Error(codes.NotFound, "not found")
+	})
+	if !assert.Equal(t, codes.NotFound, status.Code(err), `error should be passed through`) {
+		return
+	}
+
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "requests.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if !assert.Len(t, lines, 2, `there should be 2 entries`) {
+		return
+	}
+	if !assert.Regexp(t, regexp.MustCompile(`^\S+ 192\.0\.2\.1:1234 /test\.Service/Unary OK \d+\.\d{6}$`), lines[0], `first line should match`) {
+		return
+	}
+	if !assert.Regexp(t, regexp.MustCompile(`^\S+ 192\.0\.2\.1:1234 /test\.Service/Stream NotFound \d+\.\d{6}$`), lines[1], `second line should match`) {
+		return
+	}
+}
+
+func TestLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grpcrotate-")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := rotating.NewFile(context.Background(), filepath.Join(dir, "grpc.log"))
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	l := grpcrotate.NewLogger(f, 1)
+	l.Infof("hello %s", "world")
+	l.Warningln("careful")
+	l.Error("oops")
+	if !assert.True(t, l.V(1), `verbosity 1 should be enabled`) {
+		return
+	}
+	if !assert.False(t, l.V(2), `verbosity 2 should be disabled`) {
+		return
+	}
+
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "grpc.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if !assert.Len(t, lines, 3, `there should be 3 lines`) {
+		return
+	}
+	for i, prefix := range []string{"INFO: ", "WARNING: ", "ERROR: "} {
+		if !assert.True(t, strings.HasPrefix(lines[i], prefix), `line %d should start with %q`, i, prefix) {
+			return
+		}
+	}
+	if !assert.True(t, strings.HasSuffix(lines[0], "hello world"), `message should match`) {
+		return
+	}
+}
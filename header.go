@@ -0,0 +1,73 @@
+package rotating
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HeaderFunc generates the header that is written at the beginning of
+// each newly created file. It receives the name of the file, and the
+// base time of the time slot that the file belongs to.
+type HeaderFunc func(filename string, t time.Time) []byte
+
+// StaticHeader creates a HeaderFunc that always returns the given string
+func StaticHeader(s string) HeaderFunc {
+	return func(string, time.Time) []byte {
+		return []byte(s)
+	}
+}
+
+// writeHeader writes the header to w, if the file is empty.
+// It must be called while holding the lock
+func (f *File) writeHeader(w io.Writer, filename string) error {
+	if f.header == nil {
+		return nil
+	}
+
+	var size int64
+	if v, ok := unwrapWriter(w).(interface{ Size() int64 }); ok {
+		size = v.Size()
+	} else if f.opener != nil {
+		// Sinks created by a custom opener may not exist in the file
+		// system. Assume that they have been newly created
+		size = 0
+	} else {
+		fi, err := f.fs.Stat(filename)
+		if err != nil {
+			return errors.Wrapf(err, `failed to stat file %s`, filename)
+		}
+		size = fi.Size()
+	}
+
+	// Do not write the header when appending to an existing file
+	if size > 0 {
+		return nil
+	}
+
+	header := f.encodeFrame(f.header(filename, f.baseTime))
+	if _, err := w.Write(header); err != nil {
+		return errors.Wrapf(err, `failed to write header to file %s`, filename)
+	}
+	f.mirrorWrite(filename, [][]byte{header})
+	return nil
+}
+
+// writeContinuedFrom writes the marker that refers to the file that is
+// being rotated out to w, as specified by WithContinuationMarkers.
+// It must be called while holding the lock
+func (f *File) writeContinuedFrom(w io.Writer, filename string) error {
+	prev := f.filename
+	if !f.continuation || prev == "" || prev == filename {
+		return nil
+	}
+
+	marker := f.encodeFrame([]byte(fmt.Sprintf("-- continued from %s --\n", prev)))
+	if _, err := w.Write(marker); err != nil {
+		return errors.Wrapf(err, `failed to write continuation marker to file %s`, filename)
+	}
+	f.mirrorWrite(filename, [][]byte{marker})
+	return nil
+}
@@ -0,0 +1,210 @@
+// Package httprotate provides a net/http middleware that writes access
+// logs to a *rotating.File:
+//
+//	http.ListenAndServe(":8080", httprotate.Handler(f, httprotate.FormatCombined, mux))
+//
+// Each access log entry is assembled in memory and written to the file as
+// a single record after the request has been handled.
+package httprotate
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+)
+
+// Format is the format of the access log entries
+type Format int
+
+const (
+	// FormatCommon is the NCSA Common Log Format
+	FormatCommon Format = iota
+	// FormatCombined is the Apache Combined Log Format, which adds the
+	// referer and the user agent to FormatCommon
+	FormatCombined
+	// FormatJSON writes each entry as a JSON object
+	FormatJSON
+)
+
+const clfTimeLayout = `02/Jan/2006:15:04:05 -0700`
+
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 256)
+		return &buf
+	},
+}
+
+// Middleware returns a function that wraps handlers with Handler
+func Middleware(f *rotating.File, format Format) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return Handler(f, format, h)
+	}
+}
+
+// Handler returns a handler that calls h, and writes an access log entry
+// for each request to f. Errors writing to f are ignored, as they cannot
+// be reported to the client; use rotating.WithErrorHandler and
+// rotating.WithFallback to handle them
+func Handler(f *rotating.File, format Format, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			buf := bufPool.Get().(*[]byte)
+			*buf = appendEntry((*buf)[:0], format, r, rw, start, time.Since(start))
+			_, _ = f.Write(*buf)
+			bufPool.Put(buf)
+		}()
+		h.ServeHTTP(rw, r)
+	})
+}
+
+type jsonEntry struct {
+	Time      string  `json:"time"`
+	Remote    string  `json:"remote_addr"`
+	User      string  `json:"user,omitempty"`
+	Method    string  `json:"method"`
+	URI       string  `json:"uri"`
+	Proto     string  `json:"proto"`
+	Status    int     `json:"status"`
+	Bytes     int64   `json:"bytes"`
+	Duration  float64 `json:"duration"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+}
+
+func appendEntry(buf []byte, format Format, r *http.Request, rw *responseWriter, start time.Time, elapsed time.Duration) []byte {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	user := username(r)
+	status := rw.Status()
+
+	if format == FormatJSON {
+		b, err := json.Marshal(jsonEntry{
+			Time:      start.Format(time.RFC3339Nano),
+			Remote:    host,
+			User:      user,
+			Method:    r.Method,
+			URI:       r.RequestURI,
+			Proto:     r.Proto,
+			Status:    status,
+			Bytes:     rw.size,
+			Duration:  elapsed.Seconds(),
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		})
+		if err != nil {
+			// Cannot happen, as the entry only contains strings and numbers
+			return buf
+		}
+		buf = append(buf, b...)
+		return append(buf, '\n')
+	}
+
+	buf = append(buf, dash(host)...)
+	buf = append(buf, " - "...)
+	buf = append(buf, dash(user)...)
+	buf = append(buf, " ["...)
+	buf = start.AppendFormat(buf, clfTimeLayout)
+	buf = append(buf, "] "...)
+	buf = strconv.AppendQuote(buf, r.Method+" "+r.RequestURI+" "+r.Proto)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(status), 10)
+	buf = append(buf, ' ')
+	if rw.size > 0 {
+		buf = strconv.AppendInt(buf, rw.size, 10)
+	} else {
+		buf = append(buf, '-')
+	}
+	if format == FormatCombined {
+		buf = append(buf, ' ')
+		buf = strconv.AppendQuote(buf, r.Referer())
+		buf = append(buf, ' ')
+		buf = strconv.AppendQuote(buf, r.UserAgent())
+	}
+	return append(buf, '\n')
+}
+
+func username(r *http.Request) string {
+	if r.URL != nil && r.URL.User != nil {
+		return r.URL.User.Username()
+	}
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	return ""
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// responseWriter records the status and the size of the response. It
+// passes Flush and Hijack through to the original ResponseWriter, so that
+// streaming responses and websockets keep working
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *responseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		fl.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New(`httprotate: the ResponseWriter does not support hijacking`)
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return hj.Hijack()
+}
+
+// Unwrap returns the original ResponseWriter, for http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,111 @@
+package httprotate_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/lestrrat-go/rotating/httprotate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	hello := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("Hello, World!"))
+		w.(http.Flusher).Flush()
+	})
+
+	testcases := []struct {
+		Name   string
+		Format httprotate.Format
+		Check  func(*testing.T, []string)
+	}{
+		{
+			Name:   "Common",
+			Format: httprotate.FormatCommon,
+			Check: func(t *testing.T, lines []string) {
+				re := regexp.MustCompile(`^192\.0\.2\.1 - alice \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /hello\?a=b HTTP/1\.1" 200 13$`)
+				assert.Regexp(t, re, lines[0], `first line should match`)
+				assert.True(t, strings.HasSuffix(lines[1], `"GET /missing HTTP/1.1" 404 19`), `second line should match`)
+			},
+		},
+		{
+			Name:   "Combined",
+			Format: httprotate.FormatCombined,
+			Check: func(t *testing.T, lines []string) {
+				assert.True(t, strings.HasSuffix(lines[0], `200 13 "http://example.com/" "test-agent"`), `first line should match`)
+				assert.True(t, strings.HasSuffix(lines[1], `404 19 "" "test-agent"`), `second line should match`)
+			},
+		},
+		{
+			Name:   "JSON",
+			Format: httprotate.FormatJSON,
+			Check: func(t *testing.T, lines []string) {
+				var entry map[string]interface{}
+				if !assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry), `json.Unmarshal should succeed`) {
+					return
+				}
+				assert.Equal(t, "alice", entry["user"], `user should match`)
+				assert.Equal(t, "/hello?a=b", entry["uri"], `uri should match`)
+				assert.Equal(t, float64(200), entry["status"], `status should match`)
+				assert.Equal(t, float64(13), entry["bytes"], `bytes should match`)
+				assert.Equal(t, "test-agent", entry["user_agent"], `user agent should match`)
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "httprotate-")
+			if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+				return
+			}
+			defer os.RemoveAll(dir)
+
+			f, err := rotating.NewFile(context.Background(), filepath.Join(dir, "access.log"))
+			if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+				return
+			}
+
+			h := httprotate.Middleware(f, tc.Format)(hello)
+
+			req := httptest.NewRequest(http.MethodGet, "/hello?a=b", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.SetBasicAuth("alice", "secret")
+			req.Header.Set("Referer", "http://example.com/")
+			req.Header.Set("User-Agent", "test-agent")
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			req = httptest.NewRequest(http.MethodGet, "/missing", nil)
+			req.Header.Set("User-Agent", "test-agent")
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+				return
+			}
+
+			content, err := ioutil.ReadFile(filepath.Join(dir, "access.log"))
+			if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+				return
+			}
+			lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+			if !assert.Len(t, lines, 2, `there should be 2 entries`) {
+				return
+			}
+			tc.Check(t, lines)
+		})
+	}
+}
@@ -1,7 +1,18 @@
 package rotating
 
-import "time"
+import (
+	"io"
+	"time"
+)
 
 type Clock interface {
 	Now() time.Time
 }
+
+// Writer is the common interface of the writers returned by NewWriter,
+// which may or may not be a *File
+type Writer interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
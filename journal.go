@@ -0,0 +1,112 @@
+package rotating
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultJournalSocket is the path of the socket that systemd-journald
+// accepts native protocol messages on
+const DefaultJournalSocket = "/run/systemd/journal/socket"
+
+// JournalWriter writes each record as a message to systemd-journald,
+// using its native protocol. It is meant to be used as the fallback
+// writer when the log directory is not available (e.g. a read-only
+// root file system, or a missing volume), so that records are not lost:
+//
+//	f, err := rotating.NewFile(ctx, pattern,
+//		rotating.WithFallback(rotating.NewJournalWriter("myapp"), time.Minute),
+//	)
+//
+// The connection to the socket is established upon the first write.
+type JournalWriter struct {
+	// Identifier is sent as the SYSLOG_IDENTIFIER field of each message
+	Identifier string
+	// Priority is sent as the PRIORITY field of each message. The zero
+	// value means "emerg", so NewJournalWriter sets it to 6 ("info")
+	Priority int
+	// Socket is the path of the socket to write to. DefaultJournalSocket
+	// is used if it is empty
+	Socket string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewJournalWriter creates a new JournalWriter that sends messages with
+// the given identifier and the "info" priority
+func NewJournalWriter(identifier string) *JournalWriter {
+	return &JournalWriter{
+		Identifier: identifier,
+		Priority:   6,
+	}
+}
+
+// Write sends p as a single message. A trailing newline is removed
+func (w *JournalWriter) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	appendJournalField(&buf, "MESSAGE", bytes.TrimSuffix(p, []byte{'\n'}))
+	appendJournalField(&buf, "PRIORITY", []byte(strconv.Itoa(w.Priority)))
+	if w.Identifier != "" {
+		appendJournalField(&buf, "SYSLOG_IDENTIFIER", []byte(w.Identifier))
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		socket := w.Socket
+		if socket == "" {
+			socket = DefaultJournalSocket
+		}
+		conn, err := net.Dial("unixgram", socket)
+		if err != nil {
+			return 0, errors.Wrap(err, `failed to connect to journald`)
+		}
+		w.conn = conn
+	}
+
+	if _, err := w.conn.Write(buf.Bytes()); err != nil {
+		// Reconnect upon the next write, in case journald was restarted
+		w.conn.Close()
+		w.conn = nil
+		return 0, errors.Wrap(err, `failed to write to journald`)
+	}
+	return len(p), nil
+}
+
+// Close closes the connection to journald, if any
+func (w *JournalWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// appendJournalField appends a field in the native journal protocol.
+// Values that contain newlines are written as a little endian 64 bit
+// length followed by the raw value
+func appendJournalField(buf *bytes.Buffer, name string, value []byte) {
+	buf.WriteString(name)
+	if bytes.IndexByte(value, '\n') < 0 {
+		buf.WriteByte('=')
+		buf.Write(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.WriteByte('\n')
+	buf.Write(size[:])
+	buf.Write(value)
+	buf.WriteByte('\n')
+}
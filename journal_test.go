@@ -0,0 +1,84 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package rotating_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Journal")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "journal.sock")
+	conn, err := net.ListenPacket("unixgram", socket)
+	if !assert.NoError(t, err, `net.ListenPacket should succeed`) {
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Files can not be created in a "directory" that is a regular file
+	blocker := filepath.Join(dir, "logs")
+	if !assert.NoError(t, ioutil.WriteFile(blocker, nil, 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	journal := rotating.NewJournalWriter("rotating_test")
+	journal.Socket = socket
+	defer journal.Close()
+
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(blocker, "app.log"),
+		rotating.WithFallback(journal, time.Minute),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "hello\n")
+	fmt.Fprintf(f, "multi\nline\n")
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len("multi\nline")))
+	expected := []string{
+		"MESSAGE=hello\nPRIORITY=6\nSYSLOG_IDENTIFIER=rotating_test\n",
+		"MESSAGE\n" + string(size[:]) + "multi\nline\nPRIORITY=6\nSYSLOG_IDENTIFIER=rotating_test\n",
+	}
+	buf := make([]byte, 1024)
+	for _, want := range expected {
+		if !assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)), `conn.SetReadDeadline should succeed`) {
+			return
+		}
+		n, _, err := conn.ReadFrom(buf)
+		if !assert.NoError(t, err, `conn.ReadFrom should succeed`) {
+			return
+		}
+		if !assert.Equal(t, want, string(buf[:n]), `message should match`) {
+			return
+		}
+	}
+
+	if !assert.Equal(t, int64(2), f.Stats().Fallback, `records should be written to the fallback writer`) {
+		return
+	}
+}
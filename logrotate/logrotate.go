@@ -0,0 +1,265 @@
+// Package logrotate parses a subset of the logrotate(8) configuration
+// file format into options for rotating.NewFile, so that existing
+// retention definitions can be reused.
+//
+// The following directives are recognized: size, rotate, maxage,
+// compress, nocompress, dateext, nodateext, olddir, noolddir, hourly,
+// daily, and weekly. Directives that appear outside of a block apply to
+// all of the blocks that follow them. Other directives are ignored, as
+// are scripts such as postrotate ... endscript.
+//
+// The monthly and yearly directives are rejected, because files are
+// rotated at fixed intervals, which cannot follow the calendar months
+// and years.
+package logrotate
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+)
+
+// Config is the configuration for a single log file
+type Config struct {
+	// Path is the path of the log file
+	Path string
+	// Size is the size in bytes at which the file is rotated
+	Size int64
+	// Rotate is the number of old files to retain. As in logrotate, 0
+	// (the default) removes all of them, and a negative value retains
+	// all of them
+	Rotate int
+	// MaxAge is the maximum number of days to retain old files
+	MaxAge int
+	// Compress specifies that old files should be compressed with gzip
+	Compress bool
+	// DateExt specifies that the date should be added to the file names
+	DateExt bool
+	// OldDir is the directory where the files are written to. The file
+	// at Path is then a symlink to the current file
+	OldDir string
+	// Interval is the interval between rotations
+	Interval time.Duration
+}
+
+// Pattern returns the strftime pattern to be passed to rotating.NewFile.
+// Without dateext, no time components are added to the file names, so
+// the file is only rotated by size.
+func (c *Config) Pattern() string {
+	dir, base := filepath.Split(c.Path)
+	if c.OldDir != "" {
+		dir = c.OldDir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(c.Path), dir)
+		}
+	}
+
+	pattern := strings.Replace(base, `%`, `%%`, -1)
+	if c.DateExt {
+		// logrotate's default dateformat
+		pattern += `-%Y%m%d`
+	}
+	return filepath.Join(dir, pattern)
+}
+
+// Options returns the options to be passed to rotating.NewFile
+func (c *Config) Options() []rotating.Option {
+	var options []rotating.Option
+	if c.Size > 0 {
+		options = append(options, rotating.WithMaxFileSize(c.Size))
+	}
+	if c.Rotate >= 0 {
+		// The rotation count includes the current file
+		options = append(options, rotating.WithRotationCount(c.Rotate+1))
+	}
+	if c.MaxAge > 0 {
+		options = append(options, rotating.WithMaxAge(time.Duration(c.MaxAge)*24*time.Hour))
+	}
+	if c.Interval > 0 {
+		options = append(options, rotating.WithMaxInterval(c.Interval))
+	}
+	if c.OldDir != "" {
+		options = append(options, rotating.WithSymlink(c.Path))
+	}
+	if c.Compress {
+		options = append(options, rotating.WithCompress(true))
+	}
+	return options
+}
+
+// ParseFile parses the logrotate configuration file in the given path
+func ParseFile(path string) ([]*Config, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to open file %s`, path)
+	}
+	defer fh.Close()
+
+	configs, err := Parse(fh)
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to parse file %s`, path)
+	}
+	return configs, nil
+}
+
+// Parse parses the logrotate configuration read from r. A Config is
+// returned for each path that appears in the configuration
+func Parse(r io.Reader) ([]*Config, error) {
+	var configs []*Config
+	var global Config
+	var current []*Config // configs for the block being parsed
+	var inScript bool
+
+	scanner := bufio.NewScanner(r)
+	var lineno int
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if inScript {
+			if fields[0] == "endscript" {
+				inScript = false
+			}
+			continue
+		}
+
+		switch {
+		case line == "}":
+			if current == nil {
+				return nil, errors.Errorf(`line %d: unexpected "}"`, lineno)
+			}
+			configs = append(configs, current...)
+			current = nil
+			continue
+		case strings.HasSuffix(line, "{"):
+			if current != nil {
+				return nil, errors.Errorf(`line %d: nested blocks are not allowed`, lineno)
+			}
+			paths := strings.Fields(strings.TrimSuffix(line, "{"))
+			if len(paths) == 0 {
+				return nil, errors.Errorf(`line %d: missing path`, lineno)
+			}
+			current = make([]*Config, 0, len(paths))
+			for _, path := range paths {
+				c := global
+				c.Path = strings.Trim(path, `"'`)
+				current = append(current, &c)
+			}
+			continue
+		}
+
+		targets := current
+		if targets == nil {
+			targets = []*Config{&global}
+		}
+		for _, c := range targets {
+			var err error
+			inScript, err = apply(c, fields)
+			if err != nil {
+				return nil, errors.Wrapf(err, `line %d`, lineno)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, `failed to read configuration`)
+	}
+	if current != nil {
+		return nil, errors.New(`unterminated block`)
+	}
+	return configs, nil
+}
+
+// apply applies a single directive to c. It returns true if the
+// directive starts a script
+func apply(c *Config, fields []string) (bool, error) {
+	// Some directives also accept "key=value"
+	if len(fields) == 1 && strings.Contains(fields[0], "=") {
+		fields = strings.SplitN(fields[0], "=", 2)
+	}
+
+	directive := fields[0]
+	args := fields[1:]
+	switch directive {
+	case "size":
+		if len(args) != 1 {
+			return false, errors.Errorf(`%s requires an argument`, directive)
+		}
+		size, err := parseSize(args[0])
+		if err != nil {
+			return false, err
+		}
+		c.Size = size
+	case "rotate", "maxage":
+		if len(args) != 1 {
+			return false, errors.Errorf(`%s requires an argument`, directive)
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return false, errors.Wrapf(err, `invalid value for %s`, directive)
+		}
+		if directive == "rotate" {
+			c.Rotate = n
+		} else {
+			c.MaxAge = n
+		}
+	case "compress":
+		c.Compress = true
+	case "nocompress":
+		c.Compress = false
+	case "dateext":
+		c.DateExt = true
+	case "nodateext":
+		c.DateExt = false
+	case "olddir":
+		if len(args) != 1 {
+			return false, errors.Errorf(`%s requires an argument`, directive)
+		}
+		c.OldDir = strings.Trim(args[0], `"'`)
+	case "noolddir":
+		c.OldDir = ""
+	case "hourly":
+		c.Interval = time.Hour
+	case "daily":
+		c.Interval = 24 * time.Hour
+	case "weekly":
+		c.Interval = 7 * 24 * time.Hour
+	case "monthly", "yearly":
+		return false, errors.Errorf(`%s is not supported: files can only be rotated at fixed intervals, use daily or weekly instead`, directive)
+	case "prerotate", "postrotate", "firstaction", "lastaction", "preremove":
+		return true, nil
+	}
+	return false, nil
+}
+
+// parseSize parses sizes such as "100k", "10M", and "1G"
+func parseSize(s string) (int64, error) {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, `invalid size %q`, s)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,125 @@
+package logrotate_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/lestrrat-go/rotating/logrotate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	const src = `
+# global settings
+weekly
+rotate 4
+
+/var/log/app/access.log /var/log/app/error.log {
+    daily
+    size 100M
+    maxage 30
+    compress
+    dateext
+    olddir archive
+    postrotate
+        /usr/bin/killall -HUP app
+    endscript
+}
+
+"/var/log/other.log" {
+    size=10k
+}
+`
+
+	configs, err := logrotate.Parse(strings.NewReader(src))
+	if !assert.NoError(t, err, `logrotate.Parse should succeed`) {
+		return
+	}
+
+	expected := []*logrotate.Config{
+		{
+			Path:     "/var/log/app/access.log",
+			Size:     100 << 20,
+			Rotate:   4,
+			MaxAge:   30,
+			Compress: true,
+			DateExt:  true,
+			OldDir:   "archive",
+			Interval: 24 * time.Hour,
+		},
+		{
+			Path:     "/var/log/app/error.log",
+			Size:     100 << 20,
+			Rotate:   4,
+			MaxAge:   30,
+			Compress: true,
+			DateExt:  true,
+			OldDir:   "archive",
+			Interval: 24 * time.Hour,
+		},
+		{
+			Path:     "/var/log/other.log",
+			Size:     10 << 10,
+			Rotate:   4,
+			Interval: 7 * 24 * time.Hour,
+		},
+	}
+	if !assert.Equal(t, expected, configs, `configs should match`) {
+		return
+	}
+
+	if !assert.Equal(t, "/var/log/app/archive/access.log-%Y%m%d", configs[0].Pattern(), `pattern should match`) {
+		return
+	}
+	if !assert.Equal(t, "/var/log/other.log", configs[2].Pattern(), `pattern should match`) {
+		return
+	}
+	if !assert.Len(t, configs[0].Options(), 6, `number of options should match`) {
+		return
+	}
+}
+
+func TestRotateCount(t *testing.T) {
+	const src = `
+/var/log/none.log {
+    rotate 0
+}
+
+/var/log/all.log {
+    rotate -1
+}
+`
+
+	configs, err := logrotate.Parse(strings.NewReader(src))
+	if !assert.NoError(t, err, `logrotate.Parse should succeed`) {
+		return
+	}
+	if !assert.Len(t, configs, 2, `number of configs should match`) {
+		return
+	}
+
+	// Only the current file is retained
+	if !assert.Equal(t, []rotating.Option{rotating.WithRotationCount(1)}, configs[0].Options(), `options should match`) {
+		return
+	}
+	if !assert.Empty(t, configs[1].Options(), `old files should be retained`) {
+		return
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testcases := []string{
+		"/var/log/app.log {\n",
+		"}\n",
+		"/var/log/app.log {\nrotate many\n}\n",
+		"/var/log/app.log {\nmonthly\n}\n",
+		"yearly\n/var/log/app.log {\n}\n",
+	}
+	for _, src := range testcases {
+		if _, err := logrotate.Parse(strings.NewReader(src)); !assert.Error(t, err, `logrotate.Parse should fail for %q`, src) {
+			return
+		}
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/lestrrat-go/rotating/logrusrotate
+
+go 1.16
+
+require (
+	github.com/lestrrat-go/rotating v0.0.0-00010101000000-000000000000
+	github.com/pkg/errors v0.9.1
+	github.com/sirupsen/logrus v1.9.3
+	github.com/stretchr/testify v1.7.0
+)
+
+replace github.com/lestrrat-go/rotating => ../
@@ -0,0 +1,93 @@
+// Package logrusrotate provides a logrus hook that writes log entries
+// to rotating files, optionally using a separate file for each level.
+package logrusrotate
+
+import (
+	"sync"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Hook is a logrus.Hook that writes log entries to rotating files.
+//
+// Each entry is formatted and written using a single call to Write, so
+// entries are never split across files. Adopting rotation only takes
+// one line:
+//
+//	logger.AddHook(logrusrotate.NewHook(f, nil))
+//
+// (if you do not need per-level files, `logger.SetOutput(f)` works too)
+type Hook struct {
+	files     map[logrus.Level]*rotating.File
+	formatter logrus.Formatter
+	levels    []logrus.Level
+	mu        sync.Mutex
+}
+
+// NewHook creates a Hook that writes entries of all levels to f. If
+// formatter is nil, the formatter of the logger that the entry belongs
+// to is used.
+func NewHook(f *rotating.File, formatter logrus.Formatter) *Hook {
+	files := make(map[logrus.Level]*rotating.File, len(logrus.AllLevels))
+	for _, level := range logrus.AllLevels {
+		files[level] = f
+	}
+	return NewLevelHook(files, formatter)
+}
+
+// NewLevelHook creates a Hook that writes entries of each level to the
+// corresponding file. Entries of levels that are not in files are not
+// written. If formatter is nil, the formatter of the logger that the
+// entry belongs to is used.
+func NewLevelHook(files map[logrus.Level]*rotating.File, formatter logrus.Formatter) *Hook {
+	m := make(map[logrus.Level]*rotating.File, len(files))
+	levels := make([]logrus.Level, 0, len(files))
+	for _, level := range logrus.AllLevels {
+		if f, ok := files[level]; ok {
+			m[level] = f
+			levels = append(levels, level)
+		}
+	}
+
+	return &Hook{
+		files:     m,
+		formatter: formatter,
+		levels:    levels,
+	}
+}
+
+// Levels returns the levels that the hook fires for
+func (h *Hook) Levels() []logrus.Level {
+	return h.levels
+}
+
+// Fire formats the entry and writes it to the file for its level
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	f, ok := h.files[entry.Level]
+	if !ok {
+		return nil
+	}
+
+	formatter := h.formatter
+	if formatter == nil {
+		if entry.Logger == nil || entry.Logger.Formatter == nil {
+			return errors.New(`logrusrotate: no formatter available`)
+		}
+		formatter = entry.Logger.Formatter
+	}
+
+	// Formatters are not required to be safe for concurrent use
+	h.mu.Lock()
+	buf, err := formatter.Format(entry)
+	h.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, `logrusrotate: failed to format entry`)
+	}
+
+	if _, err := f.Write(buf); err != nil {
+		return errors.Wrap(err, `logrusrotate: failed to write entry`)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package logrusrotate_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/lestrrat-go/rotating/logrusrotate"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logrusrotate_test")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	info, err := rotating.NewFile(ctx, filepath.Join(dir, "info.log"))
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer info.Close()
+
+	errs, err := rotating.NewFile(ctx, filepath.Join(dir, "error.log"))
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer errs.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	logger.AddHook(logrusrotate.NewLevelHook(map[logrus.Level]*rotating.File{
+		logrus.InfoLevel:  info,
+		logrus.ErrorLevel: errs,
+	}, &logrus.TextFormatter{DisableTimestamp: true}))
+
+	logger.Info("Hello, World")
+	logger.Warn("not written")
+	logger.WithField("code", 42).Error("Goodbye, World")
+
+	expected := map[string]string{
+		"info.log":  "level=info msg=\"Hello, World\"\n",
+		"error.log": "level=error msg=\"Goodbye, World\" code=42\n",
+	}
+	for name, content := range expected {
+		buf, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(buf), `contents of %s should match`, name) {
+			return
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package rotating
+
+import "sync"
+
+// maintenanceQueueSize is the number of maintenance tasks that can be
+// pending before the write path blocks waiting for them to be processed
+const maintenanceQueueSize = 64
+
+// startMaintenance starts the maintenance goroutine. Maintenance tasks,
+// such as finalizing rotated files, updating the symlink, and purging
+// old files are executed by this single goroutine in the order they were
+// scheduled, which keeps the write path minimal.
+//
+// If a Scheduler was specified, the tasks are executed by the goroutines
+// of the Scheduler instead, still in the order they were scheduled.
+//
+// Maintenance tasks MUST NOT acquire the lock on the File, as Close
+// waits for the pending tasks while holding it.
+func (f *File) startMaintenance() {
+	if f.scheduler != nil {
+		f.queue = &taskQueue{
+			scheduler: f.scheduler,
+			onError:   f.handleError,
+		}
+		f.queue.cond = sync.NewCond(&f.queue.mu)
+		return
+	}
+
+	tasks := make(chan func() error, maintenanceQueueSize)
+	done := make(chan struct{})
+	f.tasks = tasks
+	f.maintenanceDone = done
+
+	go func() {
+		defer close(done)
+		for task := range tasks {
+			if err := task(); err != nil {
+				f.handleError(err)
+			}
+		}
+	}()
+}
+
+// stopMaintenance stops accepting new maintenance tasks, and waits for
+// the pending tasks to complete. It must be called while holding the lock
+func (f *File) stopMaintenance() {
+	if f.queue != nil {
+		f.queue.wait()
+		f.queue = nil
+		return
+	}
+
+	if f.tasks == nil {
+		return
+	}
+	close(f.tasks)
+	f.tasks = nil
+	<-f.maintenanceDone
+}
+
+// schedule enqueues a maintenance task. If the maintenance goroutine has
+// already been stopped, the task is executed synchronously.
+// It must be called while holding the lock
+func (f *File) schedule(task func() error) {
+	if f.queue != nil {
+		f.queue.push(task)
+		return
+	}
+
+	if f.tasks == nil {
+		if err := task(); err != nil {
+			f.handleError(err)
+		}
+		return
+	}
+	f.tasks <- task
+}
+
+// handleError reports errors that cannot be returned to the caller
+// to the error handler specified by WithErrorHandler
+func (f *File) handleError(err error) {
+	if h := f.errorHandler; h != nil {
+		h(err)
+	}
+}
@@ -0,0 +1,567 @@
+package rotating
+
+import (
+	"container/list"
+	"context"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// LabelPlaceholder is replaced with the label of each File in the
+// pattern passed to NewManager
+const LabelPlaceholder = "{label}"
+
+// managerConcurrency is the maximum number of Files that Manager.Flush
+// and Manager.Close operate on at the same time
+const managerConcurrency = 16
+
+// LabelOptionsFunc returns the options that are specific to the File for
+// the given label. See WithLabelOptions
+type LabelOptionsFunc func(label string) []Option
+
+// ManagerConfig maps the labels of a Manager to the options that are
+// specific to them (which may be nil). See Manager.Reload
+type ManagerConfig map[string][]Option
+
+// ConfigLoader loads the configuration of a Manager, e.g. from a file.
+// See Manager.ReloadOnSignal
+type ConfigLoader func() (ManagerConfig, error)
+
+// Manager owns a set of Files that are identified by labels, such as log
+// levels, tenants, or topics. The Files are created lazily from a pattern
+// template when a label is first used, and they all share the same
+// options (clock, check interval, retention, etc).
+//
+// The Files share a Scheduler, which is created by the Manager unless
+// one is specified using WithScheduler. The number of file handles that
+// are kept open at the same time can be limited using WithMaxOpenFiles,
+// and Files that are no longer used can be evicted using WithIdleEviction.
+// The set of labels and their options can be changed at runtime using
+// Reload.
+type Manager struct {
+	ctx        context.Context
+	pattern    string
+	options    []Option
+	maxOpen    int
+	evictAfter time.Duration
+	labelOpts  LabelOptionsFunc
+	symlink    string
+	labelDirs  bool
+	config     ManagerConfig
+	errHandler func(error)
+	scheduler  *Scheduler // owned by the Manager, if non-nil
+	mu         sync.Mutex
+	files      map[string]*managedFile
+	open       *list.List // labels of the files whose handles may be open, most recently used first
+	openElem   map[string]*list.Element
+	evicted    Stats // statistics of the evicted and retired files
+	closed     bool
+	done       chan struct{}
+}
+
+type managedFile struct {
+	file     *File
+	lastUsed time.Time
+	writing  int  // number of writes in progress through WriteLabeled
+	retired  bool // the file is to be closed once the writes in progress are done
+}
+
+// NewManager creates a new Manager. The pattern is a strftime pattern
+// which should contain LabelPlaceholder, e.g. "/var/log/app/{label}-%Y%m%d.log".
+//
+// The options are passed to NewFile for every File, except for
+// WithMaxOpenFiles, WithIdleEviction, WithLabelOptions, WithLabelSymlink,
+// and WithLabelDirectories, which are honored by the Manager itself. If the
+// Manager creates its own Scheduler, it is stopped by Close.
+func NewManager(ctx context.Context, pattern string, options ...Option) (*Manager, error) {
+	if !strings.Contains(pattern, LabelPlaceholder) {
+		return nil, errors.Errorf(`pattern %q does not contain %s`, pattern, LabelPlaceholder)
+	}
+
+	var maxOpen int
+	var evictAfter time.Duration
+	var labelOpts LabelOptionsFunc
+	var symlink string
+	var labelDirs bool
+	var errHandler func(error)
+	var hasScheduler bool
+	for _, option := range options {
+		switch option.Ident() {
+		case identMaxOpenFiles{}:
+			maxOpen = option.Value().(int)
+		case identIdleEviction{}:
+			evictAfter = option.Value().(time.Duration)
+		case identLabelOptions{}:
+			labelOpts = option.Value().(LabelOptionsFunc)
+		case identLabelSymlink{}:
+			symlink = option.Value().(string)
+		case identLabelDirectories{}:
+			labelDirs = option.Value().(bool)
+		case identScheduler{}:
+			hasScheduler = true
+		case identErrorHandler{}:
+			errHandler = option.Value().(func(error))
+		}
+	}
+
+	if symlink != "" && !strings.Contains(symlink, LabelPlaceholder) {
+		return nil, errors.Errorf(`symlink %q does not contain %s`, symlink, LabelPlaceholder)
+	}
+
+	options = append([]Option(nil), options...)
+	var scheduler *Scheduler
+	if !hasScheduler {
+		scheduler = NewScheduler(0, 0)
+		options = append(options, WithScheduler(scheduler))
+	}
+
+	m := &Manager{
+		ctx:        ctx,
+		pattern:    pattern,
+		options:    options,
+		maxOpen:    maxOpen,
+		evictAfter: evictAfter,
+		labelOpts:  labelOpts,
+		symlink:    symlink,
+		labelDirs:  labelDirs,
+		errHandler: errHandler,
+		scheduler:  scheduler,
+		files:      make(map[string]*managedFile),
+		open:       list.New(),
+		openElem:   make(map[string]*list.Element),
+		done:       make(chan struct{}),
+	}
+	if evictAfter > 0 {
+		go m.evictLoop()
+	}
+	return m, nil
+}
+
+// File returns the File for the given label, creating it if necessary.
+// Labels may not be empty, "." or "..", nor contain path separators or
+// the glob metacharacters "*", "?" and "[", unless WithLabelDirectories
+// is used.
+//
+// If WithMaxOpenFiles or WithIdleEviction are used, the File should be
+// obtained for every write (or WriteLabeled should be used instead), as
+// they rely on the Manager knowing which Files are in use.
+func (m *Manager) File(label string) (*File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, err := m.get(label)
+	if err != nil {
+		return nil, err
+	}
+	return e.file, nil
+}
+
+// WriteLabeled writes p to the File for the given label, creating it if
+// necessary. Unlike writing to the File returned by File, it guarantees
+// that the File is not evicted while it is being written to
+func (m *Manager) WriteLabeled(label string, p []byte) (int, error) {
+	m.mu.Lock()
+	e, err := m.get(label)
+	if err != nil {
+		m.mu.Unlock()
+		return 0, err
+	}
+	e.writing++
+	m.mu.Unlock()
+
+	n, err := e.file.Write(p)
+
+	m.mu.Lock()
+	e.writing--
+	if e.retired && e.writing == 0 {
+		m.retire(e)
+	}
+	m.mu.Unlock()
+	return n, err
+}
+
+// get returns the file for the given label, creating it if necessary,
+// and marks it as used.
+// This method must be called while holding the lock
+func (m *Manager) get(label string) (*managedFile, error) {
+	if m.closed {
+		return nil, errors.New(`manager closed`)
+	}
+
+	if m.labelDirs {
+		label = sanitizeLabel(label)
+	}
+
+	e, ok := m.files[label]
+	if !ok {
+		if !m.labelDirs {
+			if err := validateLabel(label); err != nil {
+				return nil, err
+			}
+		}
+		f, err := m.newFile(label, m.config[label])
+		if err != nil {
+			return nil, err
+		}
+		e = &managedFile{file: f}
+		m.files[label] = e
+	}
+
+	if m.evictAfter > 0 {
+		e.lastUsed = time.Now()
+	}
+	m.touch(label)
+	return e, nil
+}
+
+// newFile creates the File for the given label, which must have been
+// validated or sanitized
+func (m *Manager) newFile(label string, extra []Option) (*File, error) {
+	pattern := strings.Replace(m.pattern, LabelPlaceholder, strings.Replace(label, `%`, `%%`, -1), -1)
+	options := m.options[:len(m.options):len(m.options)]
+	if m.symlink != "" {
+		options = append(options, WithSymlink(strings.Replace(m.symlink, LabelPlaceholder, label, -1)))
+	}
+	if m.labelOpts != nil {
+		options = append(options, m.labelOpts(label)...)
+	}
+	options = append(options, extra...)
+
+	f, err := NewFile(m.ctx, pattern, options...)
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to create file for label %q`, label)
+	}
+	return f, nil
+}
+
+func validateLabel(label string) error {
+	if label == "" || label == "." || label == ".." || strings.ContainsAny(label, `/\*?[`) {
+		return errors.Errorf(`invalid label %q`, label)
+	}
+	return nil
+}
+
+// sanitizeLabel makes each "/" separated segment of the label safe to be
+// used as a directory or file name
+func sanitizeLabel(label string) string {
+	segments := strings.Split(label, "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			segments[i] = "_"
+			continue
+		}
+		segments[i] = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`\*?[`, r) || unicode.IsControl(r) {
+				return '_'
+			}
+			return r
+		}, segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// retire closes the file and records its statistics.
+// This method must be called while holding the lock
+func (m *Manager) retire(e *managedFile) {
+	if err := e.file.Close(); err != nil {
+		m.handleError(errors.Wrap(err, `failed to close retired file`))
+	}
+	m.evicted.add(e.file.Stats())
+}
+
+func (m *Manager) handleError(err error) {
+	if h := m.errHandler; h != nil {
+		h(err)
+	}
+}
+
+// Reload replaces the set of labels of the Manager and their options
+// with the given configuration. A new File is created for each label in
+// config, with the options of the label applied on top of the shared
+// options (and those returned by WithLabelOptions). The Files that
+// existed before are retired: they are closed once the writes in
+// progress through WriteLabeled are done.
+//
+// Labels that are not in config may still be used afterwards, in which
+// case their Files are created with the shared options only. If any of
+// the Files cannot be created, the configuration is left unchanged
+func (m *Manager) Reload(config ManagerConfig) error {
+	if m.labelDirs {
+		sanitized := make(ManagerConfig, len(config))
+		for label, options := range config {
+			sanitized[sanitizeLabel(label)] = options
+		}
+		config = sanitized
+	} else {
+		for label := range config {
+			if err := validateLabel(label); err != nil {
+				return err
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return errors.New(`manager closed`)
+	}
+
+	files := make(map[string]*managedFile, len(config))
+	for label, options := range config {
+		f, err := m.newFile(label, options)
+		if err != nil {
+			for _, e := range files {
+				_ = e.file.Close()
+			}
+			return err
+		}
+		files[label] = &managedFile{file: f, lastUsed: time.Now()}
+	}
+
+	for _, e := range m.files {
+		if e.writing > 0 {
+			e.retired = true
+			continue
+		}
+		m.retire(e)
+	}
+
+	m.config = make(ManagerConfig, len(config))
+	for label, options := range config {
+		m.config[label] = append([]Option(nil), options...)
+	}
+	m.files = files
+	m.open.Init()
+	m.openElem = make(map[string]*list.Element)
+	return nil
+}
+
+// ReloadOnSignal reloads the configuration of the Manager using load
+// every time one of the given signals (SIGHUP if none are given) is
+// received, until the Manager is closed. Errors are reported to the
+// handler specified by WithErrorHandler, and leave the configuration
+// unchanged. On js/wasm, which has no SIGHUP, signals must be given.
+func (m *Manager) ReloadOnSignal(load ConfigLoader, signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = defaultReloadSignals
+	}
+	if len(signals) == 0 {
+		// signal.Notify would relay all signals
+		return
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-m.ctx.Done():
+				return
+			case <-ch:
+				config, err := load()
+				if err != nil {
+					m.handleError(errors.Wrap(err, `failed to load configuration`))
+					continue
+				}
+				if err := m.Reload(config); err != nil {
+					m.handleError(errors.Wrap(err, `failed to reload configuration`))
+				}
+			}
+		}
+	}()
+}
+
+// touch marks the file for the given label as the most recently used
+// one, and releases the handles of the least recently used files if
+// there are too many of them.
+// This method must be called while holding the lock
+func (m *Manager) touch(label string) {
+	if m.maxOpen <= 0 {
+		return
+	}
+
+	if e, ok := m.openElem[label]; ok {
+		m.open.MoveToFront(e)
+		return
+	}
+	m.openElem[label] = m.open.PushFront(label)
+
+	for m.open.Len() > m.maxOpen {
+		oldest := m.open.Remove(m.open.Back()).(string)
+		delete(m.openElem, oldest)
+		m.files[oldest].file.releaseHandle()
+	}
+}
+
+// evictLoop periodically evicts the files that have not been used for
+// the duration specified by WithIdleEviction
+func (m *Manager) evictLoop() {
+	ticker := time.NewTicker(m.evictAfter / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.evict()
+		}
+	}
+}
+
+func (m *Manager) evict() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for label, e := range m.files {
+		if e.writing > 0 || time.Since(e.lastUsed) < m.evictAfter {
+			continue
+		}
+
+		m.retire(e)
+		delete(m.files, label)
+		if elem, ok := m.openElem[label]; ok {
+			m.open.Remove(elem)
+			delete(m.openElem, label)
+		}
+	}
+}
+
+// Labels returns the labels of the Files that currently exist, in
+// lexical order
+func (m *Manager) Labels() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	labels := make([]string, 0, len(m.files))
+	for label := range m.files {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// Stats returns the sum of the statistics of all Files, including the
+// ones that have been evicted. Use File(label).Stats() for the
+// statistics of a single File
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.evicted
+	for _, e := range m.files {
+		stats.add(e.file.Stats())
+	}
+	return stats
+}
+
+// RangeStats calls fn with the label and the statistics of each File, in
+// lexical order of the labels, until fn returns false. The statistics of
+// all Files are taken before fn is first called, so fn may call the
+// methods of the Manager. This is meant to be used by metrics collectors
+// and status pages that report on each label
+func (m *Manager) RangeStats(fn func(label string, stats Stats) bool) {
+	m.mu.Lock()
+	labels := make([]string, 0, len(m.files))
+	for label := range m.files {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	stats := make([]Stats, len(labels))
+	for i, label := range labels {
+		stats[i] = m.files[label].file.Stats()
+	}
+	m.mu.Unlock()
+
+	for i, label := range labels {
+		if !fn(label, stats[i]) {
+			return
+		}
+	}
+}
+
+// Flush flushes all Files concurrently. All Files are flushed even if
+// some of them fail, in which case a *ManagerError that lists the failed
+// labels is returned
+func (m *Manager) Flush() error {
+	m.mu.Lock()
+	files := make(map[string]*File, len(m.files))
+	for label, e := range m.files {
+		files[label] = e.file
+	}
+	m.mu.Unlock()
+
+	return fanOut(`flush`, files, (*File).Flush)
+}
+
+// Close closes all Files concurrently. If some of them fail, a
+// *ManagerError that lists the failed labels is returned. File cannot be
+// called after Close
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	close(m.done)
+
+	files := make(map[string]*File, len(m.files))
+	for label, e := range m.files {
+		files[label] = e.file
+	}
+	err := fanOut(`close`, files, (*File).Close)
+	if m.scheduler != nil {
+		_ = m.scheduler.Close()
+	}
+	return err
+}
+
+// fanOut calls fn for each of the files, using up to managerConcurrency
+// goroutines at a time, and collects the errors
+func fanOut(op string, files map[string]*File, fn func(*File) error) error {
+	labels := make([]string, 0, len(files))
+	for label := range files {
+		labels = append(labels, label)
+	}
+
+	var mu sync.Mutex
+	var errs []*LabelError
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, managerConcurrency)
+	for _, label := range labels {
+		label := label
+		f := files[label]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(f); err != nil {
+				mu.Lock()
+				errs = append(errs, &LabelError{Label: label, Err: err})
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Label < errs[j].Label
+	})
+	return &ManagerError{
+		Op:     op,
+		Total:  len(files),
+		Errors: errs,
+	}
+}
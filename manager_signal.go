@@ -0,0 +1,13 @@
+//go:build !js
+// +build !js
+
+package rotating
+
+import (
+	"os"
+	"syscall"
+)
+
+// defaultReloadSignals are the signals that ReloadOnSignal waits for if
+// none are given
+var defaultReloadSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,9 @@
+//go:build js
+// +build js
+
+package rotating
+
+import "os"
+
+// defaultReloadSignals is empty, as there is no SIGHUP on js/wasm
+var defaultReloadSignals []os.Signal
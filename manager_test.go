@@ -0,0 +1,697 @@
+package rotating_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Manager")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err = rotating.NewManager(ctx, filepath.Join(dir, "%Y%m%d.log"))
+	if !assert.Error(t, err, `rotating.NewManager should fail without a placeholder`) {
+		return
+	}
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, err := rotating.NewManager(
+		ctx,
+		filepath.Join(dir, "{label}-%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithBufferSize(4096),
+	)
+	if !assert.NoError(t, err, `rotating.NewManager should succeed`) {
+		return
+	}
+	defer m.Close()
+
+	for _, label := range []string{"info", "error", "info", "100%"} {
+		f, err := m.File(label)
+		if !assert.NoError(t, err, `m.File should succeed`) {
+			return
+		}
+		if _, err := f.Write([]byte(label + "\n")); !assert.NoError(t, err, `f.Write should succeed`) {
+			return
+		}
+	}
+
+	for _, label := range []string{"", "..", "a/b", "a*", "a?", "a[b]"} {
+		if _, err := m.File(label); !assert.Error(t, err, `m.File(%q) should fail`, label) {
+			return
+		}
+	}
+
+	if !assert.Equal(t, []string{"100%", "error", "info"}, m.Labels(), `labels should match`) {
+		return
+	}
+	if !assert.Equal(t, int64(4), m.Stats().Records, `records should be aggregated`) {
+		return
+	}
+
+	// Nothing is written until the buffers are flushed
+	if !assert.NoError(t, m.Flush(), `m.Flush should succeed`) {
+		return
+	}
+	expected := map[string]string{
+		"info-20210101.log":  "info\ninfo\n",
+		"error-20210101.log": "error\n",
+		"100%-20210101.log":  "100%\n",
+	}
+	for name, content := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(data), `contents of %s should match`, name) {
+			return
+		}
+	}
+
+	if !assert.NoError(t, m.Close(), `m.Close should succeed`) {
+		return
+	}
+	if _, err := m.File("info"); !assert.Error(t, err, `m.File should fail after Close`) {
+		return
+	}
+}
+
+func TestKeyedWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-KeyedWriter")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, err := rotating.NewManager(ctx, filepath.Join(dir, "{label}-%Y%m%d.log"), rotating.WithClock(clock))
+	if !assert.NoError(t, err, `rotating.NewManager should succeed`) {
+		return
+	}
+
+	// The tenant is the first field of each record
+	w := rotating.NewKeyedWriter(m, func(p []byte) string {
+		if i := bytes.IndexByte(p, ' '); i > 0 {
+			return string(p[:i])
+		}
+		return "unknown"
+	})
+	var _ rotating.Writer = w
+
+	for _, record := range []string{"alice hello\n", "bob hi\n", "alice bye\n", "orphan\n"} {
+		if _, err := w.Write([]byte(record)); !assert.NoError(t, err, `w.Write should succeed`) {
+			return
+		}
+	}
+	if _, err := w.WriteKeyed("bob", []byte("explicit\n")); !assert.NoError(t, err, `w.WriteKeyed should succeed`) {
+		return
+	}
+	if !assert.NoError(t, w.Close(), `w.Close should succeed`) {
+		return
+	}
+
+	expected := map[string]string{
+		"alice-20210101.log":   "alice hello\nalice bye\n",
+		"bob-20210101.log":     "bob hi\nexplicit\n",
+		"unknown-20210101.log": "orphan\n",
+	}
+	for name, content := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(data), `contents of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func TestManagerMaxOpenFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ManagerMaxOpenFiles")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, err := rotating.NewManager(
+		ctx,
+		filepath.Join(dir, "{label}-%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithBufferSize(4096),
+		rotating.WithMaxOpenFiles(2),
+	)
+	if !assert.NoError(t, err, `rotating.NewManager should succeed`) {
+		return
+	}
+	defer m.Close()
+
+	write := func(label, data string) bool {
+		f, err := m.File(label)
+		if !assert.NoError(t, err, `m.File should succeed`) {
+			return false
+		}
+		_, err = f.Write([]byte(data))
+		return assert.NoError(t, err, `f.Write should succeed`)
+	}
+	contents := func(label string) string {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, label+"-20210101.log"))
+		return string(data)
+	}
+
+	for _, label := range []string{"a", "b", "a", "c"} {
+		if !write(label, label+"\n") {
+			return
+		}
+	}
+
+	// "b" is the least recently used file, so its handle has been
+	// released (and its buffer flushed), while the others are still
+	// buffering
+	if !assert.Equal(t, "b\n", contents("b"), `b should have been flushed`) {
+		return
+	}
+	if !assert.Equal(t, "", contents("a"), `a should still be buffered`) {
+		return
+	}
+	if !assert.Equal(t, "", contents("c"), `c should still be buffered`) {
+		return
+	}
+
+	// Files are reopened in append mode
+	if !write("b", "b\n") {
+		return
+	}
+	if !assert.Equal(t, "a\na\n", contents("a"), `a should have been flushed`) {
+		return
+	}
+	if !assert.NoError(t, m.Flush(), `m.Flush should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "b\nb\n", contents("b"), `b should have been appended to`) {
+		return
+	}
+}
+
+func TestManagerIdleEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ManagerIdleEviction")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, err := rotating.NewManager(
+		ctx,
+		filepath.Join(dir, "{label}-%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithBufferSize(4096),
+		rotating.WithIdleEviction(50*time.Millisecond),
+	)
+	if !assert.NoError(t, err, `rotating.NewManager should succeed`) {
+		return
+	}
+	defer m.Close()
+
+	if _, err := m.WriteLabeled("idle", []byte("idle\n")); !assert.NoError(t, err, `m.WriteLabeled should succeed`) {
+		return
+	}
+
+	// Keep using "busy" while "idle" is evicted
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := m.WriteLabeled("busy", []byte("busy\n")); !assert.NoError(t, err, `m.WriteLabeled should succeed`) {
+			return
+		}
+		if len(m.Labels()) == 1 {
+			break
+		}
+		if !assert.True(t, time.Now().Before(deadline), `idle file should be evicted`) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !assert.Equal(t, []string{"busy"}, m.Labels(), `only the busy file should remain`) {
+		return
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "idle-20210101.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "idle\n", string(data), `evicted file should have been flushed`) {
+		return
+	}
+
+	// The statistics of evicted files are retained
+	records := m.Stats().Records
+	if !assert.True(t, records > 1, `records should include the evicted file`) {
+		return
+	}
+
+	// The file is created again when the label is used
+	if _, err := m.WriteLabeled("idle", []byte("again\n")); !assert.NoError(t, err, `m.WriteLabeled should succeed`) {
+		return
+	}
+	if !assert.NoError(t, m.Close(), `m.Close should succeed`) {
+		return
+	}
+	data, err = ioutil.ReadFile(filepath.Join(dir, "idle-20210101.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "idle\nagain\n", string(data), `file should have been appended to`) {
+		return
+	}
+}
+
+func TestManagerRangeStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ManagerRangeStats")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, err := rotating.NewManager(ctx, filepath.Join(dir, "{label}-%Y%m%d.log"), rotating.WithClock(clock))
+	if !assert.NoError(t, err, `rotating.NewManager should succeed`) {
+		return
+	}
+	defer m.Close()
+
+	for _, label := range []string{"b", "a", "b", "c", "b"} {
+		if _, err := m.WriteLabeled(label, []byte("x\n")); !assert.NoError(t, err, `m.WriteLabeled should succeed`) {
+			return
+		}
+	}
+
+	records := make(map[string]int64)
+	var labels []string
+	m.RangeStats(func(label string, stats rotating.Stats) bool {
+		labels = append(labels, label)
+		records[label] = stats.Records
+		return true
+	})
+	if !assert.Equal(t, []string{"a", "b", "c"}, labels, `labels should be visited in order`) {
+		return
+	}
+	if !assert.Equal(t, map[string]int64{"a": 1, "b": 3, "c": 1}, records, `records should match`) {
+		return
+	}
+	if !assert.Equal(t, int64(5), m.Stats().Records, `aggregate records should match`) {
+		return
+	}
+
+	var visited int
+	m.RangeStats(func(string, rotating.Stats) bool {
+		visited++
+		return false
+	})
+	if !assert.Equal(t, 1, visited, `iteration should stop when fn returns false`) {
+		return
+	}
+}
+
+func TestManagerLabelOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ManagerLabelOptions")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	header := func(label string) rotating.HeaderFunc {
+		return func(string, time.Time) []byte {
+			return []byte("# " + label + "\n")
+		}
+	}
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, err := rotating.NewManager(
+		ctx,
+		filepath.Join(dir, "{label}-%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithFileHeader(header("default")),
+		rotating.WithLabelOptions(func(label string) []rotating.Option {
+			if label == "audit" {
+				return []rotating.Option{rotating.WithFileHeader(header("audit"))}
+			}
+			return nil
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewManager should succeed`) {
+		return
+	}
+
+	for _, label := range []string{"audit", "debug"} {
+		if _, err := m.WriteLabeled(label, []byte(label+"\n")); !assert.NoError(t, err, `m.WriteLabeled should succeed`) {
+			return
+		}
+	}
+	if !assert.NoError(t, m.Close(), `m.Close should succeed`) {
+		return
+	}
+
+	expected := map[string]string{
+		"audit-20210101.log": "# audit\naudit\n",
+		"debug-20210101.log": "# default\ndebug\n",
+	}
+	for name, content := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(data), `contents of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func TestManagerLabelSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ManagerLabelSymlink")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err = rotating.NewManager(ctx, filepath.Join(dir, "{label}-%Y%m%d.log"), rotating.WithLabelSymlink(filepath.Join(dir, "current.log")))
+	if !assert.Error(t, err, `rotating.NewManager should fail without a placeholder in the symlink`) {
+		return
+	}
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, err := rotating.NewManager(
+		ctx,
+		filepath.Join(dir, "{label}-%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithLabelSymlink(filepath.Join(dir, "current", "{label}.log")),
+	)
+	if !assert.NoError(t, err, `rotating.NewManager should succeed`) {
+		return
+	}
+
+	for _, label := range []string{"alice", "bob"} {
+		if _, err := m.WriteLabeled(label, []byte(label+"\n")); !assert.NoError(t, err, `m.WriteLabeled should succeed`) {
+			return
+		}
+	}
+	if !assert.NoError(t, m.Close(), `m.Close should succeed`) {
+		return
+	}
+
+	links, err := filepath.Glob(filepath.Join(dir, "current", "*.log"))
+	if !assert.NoError(t, err, `filepath.Glob should succeed`) {
+		return
+	}
+	if !assert.Len(t, links, 2, `there should be a symlink for each label`) {
+		return
+	}
+	for _, label := range []string{"alice", "bob"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "current", label+".log"))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, label+"\n", string(data), `symlink should point to the file of %s`, label) {
+			return
+		}
+	}
+}
+
+func TestManagerReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ManagerReload")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, err := rotating.NewManager(ctx, filepath.Join(dir, "{label}-%Y%m%d.log"), rotating.WithClock(clock))
+	if !assert.NoError(t, err, `rotating.NewManager should succeed`) {
+		return
+	}
+	defer m.Close()
+
+	for _, label := range []string{"audit", "old"} {
+		if _, err := m.WriteLabeled(label, []byte("before\n")); !assert.NoError(t, err, `m.WriteLabeled should succeed`) {
+			return
+		}
+	}
+
+	if !assert.Error(t, m.Reload(rotating.ManagerConfig{"a/b": nil}), `m.Reload should fail for invalid labels`) {
+		return
+	}
+	if !assert.Equal(t, []string{"audit", "old"}, m.Labels(), `labels should be unchanged`) {
+		return
+	}
+
+	footer := func(rotating.FooterInfo) []byte {
+		return []byte("-- end --\n")
+	}
+	err = m.Reload(rotating.ManagerConfig{
+		"audit": {rotating.WithFileFooter(footer)},
+		"debug": nil,
+	})
+	if !assert.NoError(t, err, `m.Reload should succeed`) {
+		return
+	}
+	if !assert.Equal(t, []string{"audit", "debug"}, m.Labels(), `labels should be replaced`) {
+		return
+	}
+
+	if _, err := m.WriteLabeled("audit", []byte("after\n")); !assert.NoError(t, err, `m.WriteLabeled should succeed`) {
+		return
+	}
+	if !assert.NoError(t, m.Close(), `m.Close should succeed`) {
+		return
+	}
+
+	expected := map[string]string{
+		"audit-20210101.log": "before\nafter\n-- end --\n",
+		"old-20210101.log":   "before\n",
+	}
+	for name, content := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(data), `contents of %s should match`, name) {
+			return
+		}
+	}
+	if !assert.Equal(t, int64(3), m.Stats().Records, `records of retired files should be retained`) {
+		return
+	}
+}
+
+func TestManagerLabelDirectories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ManagerLabelDirectories")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, err := rotating.NewManager(
+		ctx,
+		filepath.Join(dir, "logs", "{label}", "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithLabelDirectories(true),
+	)
+	if !assert.NoError(t, err, `rotating.NewManager should succeed`) {
+		return
+	}
+
+	for _, label := range []string{"acme/billing", "acme/web", "../../etc", "acme//x\ty", "acme/*[?]"} {
+		if _, err := m.WriteLabeled(label, []byte(label+"\n")); !assert.NoError(t, err, `m.WriteLabeled should succeed`) {
+			return
+		}
+	}
+	if !assert.Equal(t, []string{"_/_/etc", "acme/_/x_y", "acme/___]", "acme/billing", "acme/web"}, m.Labels(), `labels should be sanitized`) {
+		return
+	}
+	if !assert.NoError(t, m.Close(), `m.Close should succeed`) {
+		return
+	}
+
+	expected := map[string]string{
+		"logs/acme/billing/20210101.log": "acme/billing\n",
+		"logs/acme/web/20210101.log":     "acme/web\n",
+		"logs/_/_/etc/20210101.log":      "../../etc\n",
+		"logs/acme/_/x_y/20210101.log":   "acme//x\ty\n",
+		"logs/acme/___]/20210101.log":    "acme/*[?]\n",
+	}
+	for name, content := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(data), `contents of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func TestManagerOverlappingLabels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ManagerOverlappingLabels")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The files of "acme-eu" also match the glob of "acme", "acme-*.log"
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, err := rotating.NewManager(
+		ctx,
+		filepath.Join(dir, "{label}-%Y%m%d%H.log"),
+		rotating.WithClock(clock),
+		rotating.WithRotationCount(1),
+	)
+	if !assert.NoError(t, err, `rotating.NewManager should succeed`) {
+		return
+	}
+	defer m.Close()
+
+	for i := 0; i < 2; i++ {
+		for _, label := range []string{"acme-eu", "acme"} {
+			if _, err := m.WriteLabeled(label, []byte(label+"\n")); !assert.NoError(t, err, `m.WriteLabeled should succeed`) {
+				return
+			}
+		}
+		clock.Advance(time.Hour)
+	}
+	if !assert.NoError(t, m.Close(), `m.Close should succeed`) {
+		return
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if !assert.NoError(t, err, `filepath.Glob should succeed`) {
+		return
+	}
+	for i, name := range matches {
+		matches[i] = filepath.Base(name)
+	}
+	expected := []string{"acme-2021010101.log", "acme-eu-2021010101.log"}
+	if !assert.Equal(t, expected, matches, `each label should only purge its own files`) {
+		return
+	}
+}
+
+type failingWriteCloser struct {
+	failingWriter
+}
+
+func (failingWriteCloser) Close() error {
+	return nil
+}
+
+func TestManagerFlushErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ManagerFlushErrors")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, err := rotating.NewManager(
+		ctx,
+		filepath.Join(dir, "{label}-%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithBufferSize(4096),
+		rotating.WithFileOpener(func(name string) (io.WriteCloser, error) {
+			if strings.Contains(name, "bad") {
+				return failingWriteCloser{}, nil
+			}
+			return os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewManager should succeed`) {
+		return
+	}
+	defer m.Close()
+
+	for i := 0; i < 40; i++ {
+		label := fmt.Sprintf("good%02d", i)
+		if i%20 == 7 {
+			label = fmt.Sprintf("bad%02d", i)
+		}
+		if _, err := m.WriteLabeled(label, []byte("hello\n")); !assert.NoError(t, err, `m.WriteLabeled should succeed`) {
+			return
+		}
+	}
+
+	err = m.Flush()
+	var merr *rotating.ManagerError
+	if !assert.True(t, errors.As(err, &merr), `m.Flush should return a *rotating.ManagerError`) {
+		return
+	}
+	if !assert.Equal(t, 40, merr.Total, `total should match`) {
+		return
+	}
+	if !assert.Len(t, merr.Errors, 2, `two labels should have failed`) {
+		return
+	}
+	if !assert.Equal(t, "bad07", merr.Errors[0].Label, `labels should be sorted`) {
+		return
+	}
+	if !assert.Equal(t, "bad27", merr.Errors[1].Label, `labels should be sorted`) {
+		return
+	}
+	if !assert.Contains(t, err.Error(), `failed to flush 2 of 40 files: label "bad07": `, `message should describe the failures`) {
+		return
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "good00-20210101.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "hello\n", string(data), `good files should have been flushed`) {
+		return
+	}
+}
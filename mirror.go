@@ -0,0 +1,144 @@
+package rotating
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// mirrorQueueSize is the number of writes that can be pending for the
+// mirror before further writes to the mirror are dropped
+const mirrorQueueSize = 1024
+
+// mirrorOp is a single operation on the mirror. If data is nil, the
+// mirror file is closed
+type mirrorOp struct {
+	filename string
+	data     []byte
+}
+
+// mirror writes a copy of the data written to the primary files to
+// equivalently named files in another directory. The writes are
+// performed by a dedicated goroutine, so that a slow or failing mirror
+// never blocks the primary.
+type mirror struct {
+	dir      string
+	create   createOptions
+	fs       FileSystem
+	ops      chan mirrorOp
+	done     chan struct{}
+	dropping bool
+}
+
+// startMirror starts the goroutine that writes to the mirror directory
+func (f *File) startMirror(dir string) {
+	m := &mirror{
+		dir:    dir,
+		create: f.create,
+		fs:     f.fs,
+		ops:    make(chan mirrorOp, mirrorQueueSize),
+		done:   make(chan struct{}),
+	}
+	f.mirror = m
+
+	go func() {
+		defer close(m.done)
+		files := make(map[string]FileHandle)
+		for op := range m.ops {
+			if err := m.apply(files, op); err != nil {
+				f.handleError(errors.Wrap(err, `mirror`))
+			}
+		}
+		for name, fh := range files {
+			if err := fh.Close(); err != nil {
+				f.handleError(errors.Wrapf(err, `mirror: failed to close file %s`, name))
+			}
+		}
+	}()
+}
+
+func (m *mirror) apply(files map[string]FileHandle, op mirrorOp) error {
+	fh, ok := files[op.filename]
+	if op.data == nil {
+		if !ok {
+			return nil
+		}
+		delete(files, op.filename)
+		return errors.Wrapf(fh.Close(), `failed to close file %s`, op.filename)
+	}
+
+	if !ok {
+		var err error
+		fh, err = createFile(m.fs, op.filename, os.O_APPEND|os.O_WRONLY, m.create)
+		if err != nil {
+			return err
+		}
+		files[op.filename] = fh
+	}
+
+	if _, err := fh.Write(op.data); err != nil {
+		return errors.Wrapf(err, `failed to write to file %s`, op.filename)
+	}
+	return nil
+}
+
+// stopMirror waits for the pending writes to the mirror to complete.
+// It must be called while holding the lock
+func (f *File) stopMirror() {
+	if f.mirror == nil {
+		return
+	}
+	close(f.mirror.ops)
+	<-f.mirror.done
+	f.mirror = nil
+}
+
+// mirrorWrite enqueues a copy of the data written to filename.
+// It must be called while holding the lock
+func (f *File) mirrorWrite(filename string, bufs [][]byte) {
+	if f.mirror == nil || filename == "" {
+		return
+	}
+
+	var size int
+	for _, buf := range bufs {
+		size += len(buf)
+	}
+	// The caller may reuse the buffers once the write returns
+	data := make([]byte, 0, size)
+	for _, buf := range bufs {
+		data = append(data, buf...)
+	}
+	f.sendMirror(mirrorOp{filename: f.mirrorName(filename), data: data})
+}
+
+// mirrorFinalize closes the mirror file corresponding to filename.
+// It must be called while holding the lock
+func (f *File) mirrorFinalize(filename string) {
+	if f.mirror == nil || filename == "" {
+		return
+	}
+	f.sendMirror(mirrorOp{filename: f.mirrorName(filename)})
+}
+
+func (f *File) mirrorName(filename string) string {
+	return filepath.Join(f.mirror.dir, filepath.Base(filename))
+}
+
+// sendMirror enqueues op without blocking. If the mirror cannot keep up,
+// the operation is dropped. It must be called while holding the lock
+func (f *File) sendMirror(op mirrorOp) {
+	m := f.mirror
+	select {
+	case m.ops <- op:
+		m.dropping = false
+	default:
+		f.stats.MirrorDropped++
+		if !m.dropping {
+			// Only report the first of consecutive drops
+			m.dropping = true
+			f.handleError(errors.Errorf(`mirror: queue is full, dropping writes to %s`, op.filename))
+		}
+	}
+}
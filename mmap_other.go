@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package rotating
+
+import (
+	"io"
+	"os"
+)
+
+// openMmapFile falls back to regular writes on platforms that do not
+// support memory mapped files
+func openMmapFile(filename string, _ int64, flag int, opts createOptions) (io.Writer, error) {
+	return createFile(osFileSystem{}, filename, os.O_APPEND|os.O_WRONLY|flag, opts)
+}
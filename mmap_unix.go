@@ -0,0 +1,152 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package rotating
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// mmapWriter writes to a file by copying data into a memory mapped
+// region of the file. The file is extended by `region` bytes every
+// time the currently mapped region is exhausted.
+type mmapWriter struct {
+	fh     *os.File
+	data   []byte // currently mapped region
+	base   int64  // offset of the mapped region in the file
+	off    int    // write offset within the mapped region
+	region int64
+}
+
+func openMmapFile(filename string, region int64, flag int, opts createOptions) (io.Writer, error) {
+	h, err := createFile(osFileSystem{}, filename, os.O_RDWR|flag, opts)
+	if err != nil {
+		return nil, err
+	}
+	fh := h.(*os.File)
+
+	fi, err := fh.Stat()
+	if err != nil {
+		_ = fh.Close()
+		return nil, errors.Wrapf(err, `failed to stat file %s`, filename)
+	}
+
+	// mmap(2) requires the offset to be aligned to the page size, so
+	// the region must be a multiple of the page size, and if we are
+	// appending to an existing file, the first region must start at
+	// the page boundary right before the end of the file
+	pagesize := int64(os.Getpagesize())
+	if rem := region % pagesize; rem != 0 {
+		region += pagesize - rem
+	}
+
+	size := fi.Size()
+	base := size - size%pagesize
+	w := &mmapWriter{
+		fh:     fh,
+		base:   base,
+		region: region,
+	}
+	if err := w.mapRegion(base); err != nil {
+		_ = fh.Close()
+		return nil, err
+	}
+	w.off = int(size - base)
+	return w, nil
+}
+
+func (w *mmapWriter) mapRegion(base int64) error {
+	if err := w.fh.Truncate(base + w.region); err != nil {
+		return errors.Wrap(err, `failed to extend file`)
+	}
+
+	data, err := unix.Mmap(int(w.fh.Fd()), base, int(w.region), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return errors.Wrap(err, `failed to map file`)
+	}
+	w.data = data
+	w.base = base
+	w.off = 0
+	return nil
+}
+
+func (w *mmapWriter) unmap() error {
+	if w.data == nil {
+		return nil
+	}
+
+	if err := unix.Msync(w.data, unix.MS_SYNC); err != nil {
+		return errors.Wrap(err, `failed to sync mapped region`)
+	}
+	if err := unix.Munmap(w.data); err != nil {
+		return errors.Wrap(err, `failed to unmap region`)
+	}
+	w.data = nil
+	return nil
+}
+
+func (w *mmapWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		if w.data == nil {
+			return written, errors.New(`mmap writer is closed`)
+		}
+
+		if w.off >= len(w.data) {
+			next := w.base + int64(len(w.data))
+			if err := w.unmap(); err != nil {
+				return written, err
+			}
+			if err := w.mapRegion(next); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(w.data[w.off:], p)
+		w.off += n
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Size returns the number of bytes in the file, excluding the space
+// that has been preallocated for the mapped region
+func (w *mmapWriter) Size() int64 {
+	return w.base + int64(w.off)
+}
+
+// Flush schedules the dirty pages in the mapped region to be written
+func (w *mmapWriter) Flush() error {
+	if w.data == nil {
+		return nil
+	}
+	return unix.Msync(w.data, unix.MS_ASYNC)
+}
+
+// Sync waits for the dirty pages in the mapped region to be written
+func (w *mmapWriter) Sync() error {
+	if w.data == nil {
+		return nil
+	}
+	return unix.Msync(w.data, unix.MS_SYNC)
+}
+
+func (w *mmapWriter) Close() error {
+	size := w.Size()
+	if err := w.unmap(); err != nil {
+		_ = w.fh.Close()
+		return err
+	}
+
+	// Get rid of the space that we preallocated, but did not use
+	if err := w.fh.Truncate(size); err != nil {
+		_ = w.fh.Close()
+		return errors.Wrap(err, `failed to truncate file`)
+	}
+	return w.fh.Close()
+}
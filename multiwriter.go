@@ -0,0 +1,53 @@
+package rotating
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+type multiWriter struct {
+	errorHandler func(error)
+	writers      []io.Writer
+}
+
+// MultiWriter creates a writer that duplicates its writes to all of the
+// given writers, e.g. a *File, os.Stderr, and a network connection.
+//
+// Unlike io.MultiWriter, an error from one of the writers does not stop
+// the data from being written to the rest of them, nor does it fail the
+// overall Write. Instead, the error is passed to errorHandler, which may
+// be nil. Write only returns an error if all of the writers failed.
+func MultiWriter(errorHandler func(error), writers ...io.Writer) io.Writer {
+	list := make([]io.Writer, len(writers))
+	copy(list, writers)
+	return &multiWriter{
+		errorHandler: errorHandler,
+		writers:      list,
+	}
+}
+
+func (w *multiWriter) Write(p []byte) (int, error) {
+	var lastError error
+	var failed int
+	for i, dst := range w.writers {
+		n, err := dst.Write(p)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err == nil {
+			continue
+		}
+
+		failed++
+		lastError = errors.Wrapf(err, `failed to write to writer #%d`, i)
+		if h := w.errorHandler; h != nil {
+			h(lastError)
+		}
+	}
+
+	if len(w.writers) > 0 && failed == len(w.writers) {
+		return 0, lastError
+	}
+	return len(p), nil
+}
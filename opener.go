@@ -0,0 +1,7 @@
+package rotating
+
+import "io"
+
+// FileOpener opens the sink that the data for the given file name should
+// be written to. See WithFileOpener
+type FileOpener func(name string) (io.WriteCloser, error)
@@ -1,19 +1,84 @@
 package rotating
 
 import (
+	"io"
+	"os"
 	"time"
 
+	"github.com/lestrrat-go/backoff"
 	"github.com/lestrrat-go/option"
 )
 
 type Option = option.Interface
 
+type identArchiveDir struct{}
+type identArchiver struct{}
+type identArchiveTimeout struct{}
+type identBackoff struct{}
+type identBufferSize struct{}
 type identClock struct{}
+type identCompress struct{}
+type identCompressor struct{}
+type identCompressionWorkers struct{}
+type identCompressHook struct{}
+type identContinuationMarkers struct{}
 type identCheckInterval struct{}
+type identCircuitBreaker struct{}
+type identDirMode struct{}
+type identDirSync struct{}
+type identDockerJSON struct{}
+type identDropOnDiskFull struct{}
+type identErrorHandler struct{}
+type identExactPermissions struct{}
+type identFIFO struct{}
+type identFallback struct{}
+type identFileFooter struct{}
+type identFilter struct{}
+type identFrameChecksum struct{}
+type identMaxFrameSize struct{}
+type identFraming struct{}
+type identFileHeader struct{}
+type identFileMode struct{}
+type identFileOpener struct{}
+type identFileSystem struct{}
+type identIdleEviction struct{}
+type identIdleTimeout struct{}
+type identLabelDirectories struct{}
+type identLabelOptions struct{}
+type identLabelSymlink struct{}
+type identMaxAge struct{}
 type identMaxFileSize struct{}
+type identMaxRecordSize struct{}
 type identMaxInterval struct{}
+type identMaxTotalSize struct{}
+type identMinDiskFree struct{}
+type identMaxOpenFiles struct{}
+type identMaxUncompressedSize struct{}
+type identMirror struct{}
+type identMmap struct{}
+type identOpenFlags struct{}
+type identOperationTimeout struct{}
+type identOwner struct{}
+type identPassthrough struct{}
+type identPartialWriteRetry struct{}
+type identPreallocate struct{}
+type identPreopen struct{}
+type identPurgeHook struct{}
+type identRateLimit struct{}
+type identRateLimitPolicy struct{}
+type identRecordDelimiter struct{}
+type identRetainSlots struct{}
+type identRotateHook struct{}
 type identRotationCount struct{}
+type identScheduler struct{}
+type identSlotQuota struct{}
 type identSymlink struct{}
+type identTransformer struct{}
+type identTruncateOnOpen struct{}
+type identTruncationPolicy struct{}
+type identVerifyDirectory struct{}
+type identWriterWrapper struct{}
+type identSynchronousRotation struct{}
 
 // WithClock creates a new Option that sets a clock that the File
 // object will use to determine the current time.
@@ -25,10 +90,23 @@ func WithClock(c Clock) Option {
 	return option.New(identClock{}, c)
 }
 
+// WithCheckInterval specifies the minimum interval between checks for
+// the size of the file. Checking the file size requires flushing the
+// buffers and stat'ing the file, so it is not performed on every write.
+//
+// The elapsed time is measured using the Clock specified by WithClock.
+// If WithMaxFileSize is specified without this option, the interval
+// defaults to 5 minutes.
 func WithCheckInterval(v time.Duration) Option {
 	return option.New(identCheckInterval{}, v)
 }
 
+// WithMaxFileSize specifies the size of the file on disk that triggers a
+// rotation. The size is checked as specified by WithCheckInterval, after
+// flushing the buffers. When the data is compressed on the fly by a
+// WriterWrapper, this is the compressed size, and the compressor is
+// flushed at each check so that the size can be measured. See also
+// WithMaxUncompressedSize.
 func WithMaxFileSize(v int64) Option {
 	return option.New(identMaxFileSize{}, v)
 }
@@ -69,3 +147,764 @@ func WithSymlink(v string) Option {
 func WithRotationCount(v int) Option {
 	return option.New(identRotationCount{}, v)
 }
+
+// WithMaxAge specifies the maximum age of the files to retain. Files
+// whose modification time is older than the given duration are removed
+// when the file is rotated. It can be combined with WithRotationCount.
+func WithMaxAge(v time.Duration) Option {
+	return option.New(identMaxAge{}, v)
+}
+
+// WithMaxTotalSize specifies the maximum total size in bytes of the files
+// that have been rotated out. When the file is rotated, the oldest files
+// are removed until the total size of the remaining ones fits within the
+// given size. The file that is currently written to does not count
+// towards the total, and is never removed. It can be combined with
+// WithRotationCount and WithMaxAge.
+func WithMaxTotalSize(v int64) Option {
+	return option.New(identMaxTotalSize{}, v)
+}
+
+// WithMinDiskFree specifies the minimum free space of the file system
+// that the files are written to, either in bytes (DiskFreeBytes) or as a
+// percentage of its size (DiskFreePercent). When the file is rotated and
+// the free space is below the minimum, the oldest files are removed one at
+// a time until it is not, regardless of WithRotationCount and the other
+// retention options. The file that is currently written to is never
+// removed.
+//
+// The free space is queried with statfs(2) (GetDiskFreeSpaceEx on
+// Windows). This option is ignored on other platforms, and with
+// WithFileSystem.
+func WithMinDiskFree(v DiskFree) Option {
+	return option.New(identMinDiskFree{}, v)
+}
+
+// WithMmap specifies that the file should be written through a memory
+// mapped region instead of write(2) calls. This option is EXPERIMENTAL.
+//
+// The file is extended and mapped `v` bytes at a time (rounded up to the
+// system's page size), and data is copied directly into the mapped region.
+// The mapped region is synchronized to disk via msync(2) when the file is
+// flushed, and the file is truncated to the actual size of the data
+// when it is closed. Note that this means that a file that has not been
+// closed properly (e.g. because the process crashed) may contain trailing
+// NUL bytes.
+//
+// On platforms where memory mapped files are not supported, this option
+// is ignored and regular writes are used.
+func WithMmap(v int64) Option {
+	return option.New(identMmap{}, v)
+}
+
+// WithPreallocate specifies the number of bytes to preallocate on disk
+// when a new file is created. Preallocating space for files that are
+// expected to grow large (e.g. up to the size specified in
+// WithMaxFileSize) reduces fragmentation and write stalls on file systems
+// such as ext4 and xfs.
+//
+// The apparent size of the file is not changed by preallocation.
+// Preallocation is only performed on platforms that support it
+// (currently Linux), and is done on a best-effort basis.
+func WithPreallocate(v int64) Option {
+	return option.New(identPreallocate{}, v)
+}
+
+// WithOpenFlags specifies additional flags to be passed to os.OpenFile
+// when files are opened. The given flags are OR'ed with the flags that
+// are always used (os.O_CREATE, os.O_APPEND and os.O_WRONLY).
+//
+// For example, durability critical applications may want to specify
+// os.O_SYNC or syscall.O_DSYNC, and on Linux syscall.O_NOATIME can be
+// used to avoid updating the access time of the files.
+func WithOpenFlags(v int) Option {
+	return option.New(identOpenFlags{}, v)
+}
+
+// WithSynchronousRotation specifies that upon rotation, the previous
+// file must be completely flushed, synced, and closed before the new file
+// is created and written to.
+//
+// By default the previous file is finalized asynchronously, so that
+// the write that triggered the rotation does not have to wait for it.
+// Use this option if you need a strict ordering guarantee, at the cost of
+// increased latency during rotation. If the previous file fails to be
+// finalized, the write that triggered the rotation returns an error.
+func WithSynchronousRotation(v bool) Option {
+	return option.New(identSynchronousRotation{}, v)
+}
+
+// WithDirSync specifies that the directory containing the file should
+// be synced after a new file is created, and that the directory
+// containing the symlink should be synced after the symlink is updated.
+//
+// Without this, a newly created file or an updated symlink may not
+// survive a system crash, even if the contents of the file itself
+// have been synced.
+func WithDirSync(v bool) Option {
+	return option.New(identDirSync{}, v)
+}
+
+// WithIdleTimeout specifies the duration after which the underlying
+// file handle is flushed and closed if the file has not been written to.
+// The file is transparently reopened (in append mode) upon the next write.
+//
+// This is useful when managing a large number of files, where keeping
+// a file descriptor open for each of them would waste resources.
+func WithIdleTimeout(v time.Duration) Option {
+	return option.New(identIdleTimeout{}, v)
+}
+
+// WithOperationTimeout specifies the maximum amount of time to wait for
+// file system operations such as opening and stat'ing files, and renaming
+// symlinks. When the timeout expires, the operation is abandoned and
+// a *TimeoutError is returned.
+//
+// This is useful when writing to file systems such as NFS, where an
+// operation may block indefinitely. Note that the abandoned operation
+// is left running in the background, as there is no way to cancel it.
+func WithOperationTimeout(v time.Duration) Option {
+	return option.New(identOperationTimeout{}, v)
+}
+
+type rateLimitValue struct {
+	rate  int64
+	burst int64
+}
+
+// WithRateLimit limits the rate at which data is written to the file
+// to `bytesPerSec` bytes per second, allowing bursts of up to `burst`
+// bytes. If `burst` is not a positive value, it defaults to `bytesPerSec`.
+//
+// What happens to writes that exceed the rate limit is controlled
+// by WithRateLimitPolicy. By default, writes are blocked until enough
+// bandwidth becomes available.
+func WithRateLimit(bytesPerSec, burst int64) Option {
+	return option.New(identRateLimit{}, rateLimitValue{rate: bytesPerSec, burst: burst})
+}
+
+// WithRateLimitPolicy specifies what happens to writes that exceed the
+// rate limit specified by WithRateLimit. The default is RateLimitBlock.
+//
+// When RateLimitDrop is specified, writes that exceed the rate limit
+// are discarded, but are reported as successful to the caller.
+func WithRateLimitPolicy(v RateLimitPolicy) Option {
+	return option.New(identRateLimitPolicy{}, v)
+}
+
+type slotQuotaValue struct {
+	size   int64
+	policy QuotaPolicy
+}
+
+// WithSlotQuota specifies the maximum number of bytes that may be
+// written during a single time slot (see WithMaxInterval), regardless
+// of how many files are created for the slot due to size based rotation.
+//
+// Once the quota has been reached, further writes are handled according
+// to the given policy: QuotaDrop discards them, and writes a single marker
+// line with the number of suppressed records at the end of the slot.
+// QuotaOverflow diverts them to an overflow file, which is named after
+// the file for the time slot with an additional ".overflow" suffix.
+// Overflow files do not count towards the retention policy, and are only
+// removed because of their age (see WithMaxAge).
+func WithSlotQuota(size int64, policy QuotaPolicy) Option {
+	return option.New(identSlotQuota{}, slotQuotaValue{size: size, policy: policy})
+}
+
+// WithErrorHandler specifies a function that is called with errors
+// that occur in the background, and therefore cannot be returned to
+// the caller, such as failures to update the symlink, to purge old
+// files, or to flush and close files that were rotated out or released
+// because they were idle.
+//
+// The handler is usually called from the maintenance goroutine, so it
+// should not block for a long time. Errors are discarded if no handler
+// is specified.
+func WithErrorHandler(v func(error)) Option {
+	return option.New(identErrorHandler{}, v)
+}
+
+// WithBufferSize specifies that writes should be buffered in memory,
+// using a buffer of the given size, before they are written to the
+// underlying file.
+//
+// Buffered data is flushed when the buffer is full, when the file is
+// checked for its size, when the file is rotated, and when Flush or
+// Close is called.
+func WithBufferSize(v int) Option {
+	return option.New(identBufferSize{}, v)
+}
+
+// WithRecordDelimiter specifies that the data written to the file
+// consists of records terminated by the given delimiter (e.g. '\n'),
+// and that the file must only be rotated between records.
+//
+// When a write ends in the middle of a record, the rotation is deferred
+// until the record is completed by subsequent writes, so that a single
+// record is never split across two files.
+func WithRecordDelimiter(v byte) Option {
+	return option.New(identRecordDelimiter{}, v)
+}
+
+// WithFileHeader specifies a function that generates the header to be
+// written at the beginning of each newly created file, such as CSV headers,
+// schema versions, or the name of the host. Use StaticHeader if the
+// header does not depend on the file.
+//
+// The header is not written when appending to a file that already
+// contains data.
+func WithFileHeader(v HeaderFunc) Option {
+	return option.New(identFileHeader{}, v)
+}
+
+// WithFileFooter specifies a function that generates the footer to be
+// written at the end of each file, right before it is finalized upon
+// rotation or Close. The function receives information about the file,
+// such as the name of the next file and the number of records written,
+// which allows consumers to detect truncated files.
+func WithFileFooter(v FooterFunc) Option {
+	return option.New(identFileFooter{}, v)
+}
+
+// WithTransformer specifies a function that transforms each record
+// before it is written, such as prefixing a timestamp or redacting
+// sensitive fields. This option may be specified multiple times, in
+// which case the transformers are applied in the order specified.
+//
+// Each call to Write (or WriteVec) is considered a single record. The
+// transformed record may be of different length than the original, but
+// the number of bytes reported as written is that of the original data.
+func WithTransformer(v Transformer) Option {
+	return option.New(identTransformer{}, v)
+}
+
+// WithFilter specifies a function that decides if a record should be
+// written, such as to suppress health-check noise. Records for which the
+// function returns false are dropped, and counted in Stats. This option
+// may be specified multiple times, in which case a record must pass all
+// of the filters to be written.
+//
+// Filters are applied before the transformers specified by WithTransformer.
+func WithFilter(v Filter) Option {
+	return option.New(identFilter{}, v)
+}
+
+// WithFraming enables the framing mode, in which each record is written
+// prefixed with its length (a big-endian uint32). This allows binary or
+// multi-line payloads to be written unambiguously. The files can be read
+// using a FrameReader.
+//
+// Headers, footers, and markers for suppressed records are written as
+// frames as well.
+func WithFraming(b bool) Option {
+	return option.New(identFraming{}, b)
+}
+
+// WithFrameChecksum adds a CRC32 checksum to each frame written in the
+// framing mode (see WithFraming), so that a FrameReader can detect and
+// skip frames that have been corrupted, e.g. by a crash. This option has
+// no effect unless framing is enabled.
+func WithFrameChecksum(b bool) Option {
+	return option.New(identFrameChecksum{}, b)
+}
+
+// WithMaxFrameSize specifies the maximum size of the payload of a frame
+// that is accepted by a FrameReader. Frames whose header claims a larger
+// size are treated as corrupted, so that a damaged header does not make
+// the reader allocate an arbitrary amount of memory. The default is 64MB.
+func WithMaxFrameSize(v int64) Option {
+	return option.New(identMaxFrameSize{}, v)
+}
+
+// WithTruncationPolicy enables the detection of the active file being
+// truncated by another process, and specifies how to respond to it.
+// The size of the file is checked at the interval specified by
+// WithCheckInterval. Truncations are reported to the error handler as
+// a *TruncationError.
+func WithTruncationPolicy(v TruncationPolicy) Option {
+	return option.New(identTruncationPolicy{}, v)
+}
+
+type maxRecordSizeValue struct {
+	size   int64
+	policy RecordSizePolicy
+}
+
+// WithMaxRecordSize specifies the maximum size of a single record, to
+// guard against gigantic writes (e.g. an accidentally logged payload).
+// The size is checked after the transformers specified by WithTransformer
+// have been applied.
+//
+// Records that exceed the size are handled according to the given policy:
+// RecordReject returns a *RecordSizeError from Write, RecordTruncate writes
+// the first size bytes followed by a "[truncated]" marker, and RecordSplit
+// splits the record into several records of at most size bytes.
+func WithMaxRecordSize(size int64, policy RecordSizePolicy) Option {
+	return option.New(identMaxRecordSize{}, maxRecordSizeValue{size: size, policy: policy})
+}
+
+// WithMirror specifies a directory to which every write is copied, into
+// a file with the same name as the primary file (e.g. local disk and NFS).
+//
+// Writes to the mirror are performed asynchronously, and failures are
+// reported to the error handler, so that a slow or failing mirror never
+// blocks nor fails the writes to the primary file. If the mirror cannot
+// keep up, writes to it are dropped, and counted in Stats.
+func WithMirror(dir string) Option {
+	return option.New(identMirror{}, dir)
+}
+
+type fallbackValue struct {
+	writer io.Writer
+	retry  time.Duration
+}
+
+// WithFallback specifies a writer (e.g. os.Stderr, or a file in another
+// directory) to which records are written when they cannot be written
+// to the primary file, e.g. because the file cannot be opened or written
+// to.
+//
+// While the fallback writer is in use, the primary file is retried every
+// retry interval (30 seconds if not specified), and writes are switched
+// back to the primary file once it recovers. The switch to the fallback
+// writer is reported to the error handler.
+func WithFallback(w io.Writer, retry time.Duration) Option {
+	return option.New(identFallback{}, fallbackValue{writer: w, retry: retry})
+}
+
+type circuitBreakerValue struct {
+	threshold int
+	cooldown  time.Duration
+}
+
+// WithCircuitBreaker specifies that after threshold consecutive failures
+// to open or write to the primary file, writes should fail immediately
+// with a *CircuitOpenError for the duration of cooldown, instead of
+// going through the whole process of opening the file on every write.
+// This protects latency-sensitive callers during storage outages.
+//
+// If a fallback writer has been specified using WithFallback, records
+// are written to the fallback writer while the breaker is open.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return option.New(identCircuitBreaker{}, circuitBreakerValue{threshold: threshold, cooldown: cooldown})
+}
+
+// WithPassthrough enables the passthrough mode, in which records are
+// written directly to the given writer (typically os.Stdout or os.Stderr)
+// without creating any files, nor rotating them. This allows the same
+// code to be used both in environments where logs are written to files,
+// and in environments where the standard output is collected (e.g.
+// containers). Filters, transformers, and framing still apply.
+//
+// If this option is not specified, the passthrough mode may also be
+// enabled by setting the environment variable named by PassthroughEnv
+// to "stdout" or "stderr".
+func WithPassthrough(w io.Writer) Option {
+	return option.New(identPassthrough{}, w)
+}
+
+// WithFileOpener specifies a function that opens the sink for each file,
+// in place of creating a regular file. This allows the rotation, naming,
+// and retention machinery to drive other kinds of sinks, such as named
+// pipes, in-memory files for tests, or custom storage drivers.
+//
+// The sink should be ready to be appended to. If it implements a
+// `Size() int64` method, it is used for size based rotation, and to
+// decide if the header should be written. Otherwise the sink is assumed
+// to be empty when opened, and size based rotation is disabled.
+// WithMmap and WithPreallocate are ignored when this option is specified.
+func WithFileOpener(v FileOpener) Option {
+	return option.New(identFileOpener{}, v)
+}
+
+// WithFIFO specifies that the files are named pipes (FIFOs), for
+// integrations that consume the data through pipes. The pipes are
+// created if they do not exist, with the permissions and owner specified
+// by WithFileMode, WithExactPermissions, and WithOwner. Rotation closes the current pipe and
+// opens the pipe with the new name, which may be the same name if the
+// pattern does not contain any time components.
+//
+// The pipes are opened in non-blocking mode, so that opening a pipe
+// without a reader fails immediately instead of blocking. Combine with
+// WithFallback or WithCircuitBreaker to handle the absence of a reader.
+// Size based rotation is not available for named pipes.
+func WithFIFO(b bool) Option {
+	return option.New(identFIFO{}, b)
+}
+
+// WithWriterWrapper specifies a function that decorates the writer for
+// each newly opened file, e.g. with an encrypting or metering writer.
+// All data written to the file, including headers and footers, goes
+// through the decorating writer.
+//
+// The lifecycle of the file is still managed by this package: when the
+// file is flushed, the decorating writer is flushed first if it has a
+// `Flush() error` method, and when the file is finalized, the decorating
+// writer is closed first if it implements io.Closer. The decorating
+// writer must not close the writer that it wraps.
+func WithWriterWrapper(v WriterWrapper) Option {
+	return option.New(identWriterWrapper{}, v)
+}
+
+// WithFileSystem specifies the FileSystem through which all file system
+// operations (opening, stat'ing, globbing, removing, renaming files, and
+// creating symlinks and directories) are performed. By default the os
+// package is used.
+//
+// Memory mapped files, preallocation, and named pipes require the default
+// FileSystem, and are ignored (or fail, in the case of named pipes)
+// otherwise. Directories are only synced if the FileSystem provides a
+// SyncDir method, as the default one does.
+//
+// This option may also be passed to NewFrameReader.
+func WithFileSystem(v FileSystem) Option {
+	return option.New(identFileSystem{}, v)
+}
+
+// WithDockerJSON specifies that records should be written in Docker's
+// json-file log format, i.e. each line as a JSON object such as
+// `{"log":"message\n","stream":"stdout","time":"2021-01-01T00:00:00Z"}`,
+// so that the files can be consumed by tooling that understands that
+// format. The stream is typically "stdout" or "stderr", and the time is
+// taken from the clock of the File.
+//
+// The encoding is applied after the transformers specified by
+// WithTransformer.
+func WithDockerJSON(stream string) Option {
+	return option.New(identDockerJSON{}, stream)
+}
+
+// WithMaxOpenFiles specifies the maximum number of Files of a Manager
+// whose file handles are kept open at the same time. When the limit is
+// exceeded, the handle of the least recently used File is flushed and
+// closed, and it is transparently reopened (in append mode) upon the next
+// write. By default the number of open files is not limited.
+//
+// This option is only honored by NewManager. Files are considered used
+// when they are obtained through Manager.File, so the limit is only
+// enforced if Manager.File (or a KeyedWriter) is used for every write,
+// instead of holding on to the *File.
+func WithMaxOpenFiles(v int) Option {
+	return option.New(identMaxOpenFiles{}, v)
+}
+
+// WithScheduler specifies a Scheduler that performs the maintenance of
+// the File, so that many Files can share its goroutines and timer.
+// Files created by a Manager use a Scheduler automatically.
+//
+// When a Scheduler is used, the sizes of the files are checked by the
+// Scheduler at its interval, and the value specified by WithCheckInterval
+// is only used to tell whether the sizes need to be checked at all.
+func WithScheduler(v *Scheduler) Option {
+	return option.New(identScheduler{}, v)
+}
+
+// WithIdleEviction specifies the duration after which the Files of a
+// Manager that have not been used are evicted: they are flushed, closed,
+// and forgotten by the Manager, so that the memory and file descriptors
+// used by Files for short-lived labels (e.g. tenants) do not grow without
+// bound. An evicted File is created again when its label is used.
+//
+// This option is only honored by NewManager. Files are considered used
+// when they are obtained through Manager.File or written to through
+// Manager.WriteLabeled (or a KeyedWriter).
+func WithIdleEviction(v time.Duration) Option {
+	return option.New(identIdleEviction{}, v)
+}
+
+// WithLabelOptions specifies a function that returns the options that
+// are specific to the File for a label, e.g. a larger maximum size or a
+// longer retention for an "audit" label than for a "debug" label. They
+// are applied after the options passed to NewManager, so they take
+// precedence over them (options that accumulate, such as WithTransformer
+// and WithFilter, are added to the shared ones).
+//
+// This option is only honored by NewManager. The function is called
+// every time a File is created for a label.
+func WithLabelOptions(v LabelOptionsFunc) Option {
+	return option.New(identLabelOptions{}, v)
+}
+
+// WithLabelSymlink specifies a template for the symlinks that point to
+// the current file of each label of a Manager, such as
+// "/var/log/app/current/{label}.log", so that log shippers can discover
+// the files of all labels by globbing the symlinks. The template must
+// contain LabelPlaceholder. The symlinks of evicted Files are left in
+// place.
+//
+// This option is only honored by NewManager. It takes precedence over
+// WithSymlink, but a symlink specified by WithLabelOptions takes
+// precedence over it.
+func WithLabelSymlink(v string) Option {
+	return option.New(identLabelSymlink{}, v)
+}
+
+// WithLabelDirectories specifies whether the labels of a Manager may
+// contain "/" to expand into a directory structure, e.g. the label
+// "acme/billing" with the pattern "logs/{label}/%Y%m%d.log" writes to
+// "logs/acme/billing/20210101.log", so that each tenant gets its own
+// tree of logs.
+//
+// Each segment of the label is sanitized instead of rejected: empty
+// segments, "." and ".." are replaced with "_", as are backslashes, the
+// glob metacharacters "*", "?" and "[", and control characters. The Manager identifies the Files by the sanitized
+// labels, which are the ones that Labels returns.
+//
+// This option is only honored by NewManager.
+func WithLabelDirectories(v bool) Option {
+	return option.New(identLabelDirectories{}, v)
+}
+
+// WithDropOnDiskFull specifies that when a write fails because the disk
+// is full, the File should drop the data instead of returning errors,
+// and retry writing after the given interval (30 seconds if retry is not
+// positive). When writing succeeds again, a marker such as
+// "-- resumed after dropping 1234 bytes --" is written first.
+//
+// Each episode is reported to the error handler as a *DiskFullError, and
+// is counted in Stats, along with the number of bytes dropped. Data that
+// was buffered when the disk became full is lost without being counted.
+func WithDropOnDiskFull(retry time.Duration) Option {
+	return option.New(identDropOnDiskFull{}, retry)
+}
+
+// WithDirMode specifies the permissions of the directories that are
+// created as necessary for the files, the symlink, and the mirror
+// (before the umask is applied). The default is 0755.
+func WithDirMode(v os.FileMode) Option {
+	return option.New(identDirMode{}, v)
+}
+
+// WithOwner specifies the user and group IDs that the files and
+// directories should be owned by when they are created, e.g. for daemons
+// that start as root and then drop privileges. Either ID may be -1 to
+// leave it unchanged.
+//
+// Changing owners requires the appropriate privileges, and is not
+// supported on all platforms and FileSystems. Failures are reported to
+// the error handler, and do not prevent the files from being written to.
+func WithOwner(uid, gid int) Option {
+	return option.New(identOwner{}, ownerValue{uid: uid, gid: gid})
+}
+
+// WithFileMode specifies the permissions of the files that are created
+// (before the umask is applied). The default is 0644.
+func WithFileMode(v os.FileMode) Option {
+	return option.New(identFileMode{}, v)
+}
+
+// WithExactPermissions changes the permissions of the files and
+// directories to exactly the modes specified by WithFileMode and
+// WithDirMode after creating them, so that the umask inherited from the
+// environment cannot make the logs more or less accessible than intended.
+//
+// Failing to change the permissions is an error, and the file is not
+// written to. The FileSystem must support changing permissions.
+func WithExactPermissions(v bool) Option {
+	return option.New(identExactPermissions{}, v)
+}
+
+// WithTruncateOnOpen truncates files that already exist instead of
+// appending to them, e.g. to discard the output of a previous run when
+// replaying.
+//
+// Files are only truncated when the File switches to them: on the first
+// write, when rotating, and for the overflow file of WithSlotQuota.
+// Reopening the current file (e.g. after WithIdleTimeout released the
+// handle) always appends. As generation numbers restart from 0 for each
+// File, the generations left over by a previous run are truncated as
+// they are reached, so that old and new data are never mixed.
+//
+// This has no effect on named pipes and on files opened by WithFileOpener.
+func WithTruncateOnOpen(v bool) Option {
+	return option.New(identTruncateOnOpen{}, v)
+}
+
+// WithVerifyDirectory makes NewFile create the directory of the pattern
+// (up to the first component that depends on the time) and check that
+// files can be created in it, so that a misconfiguration is reported by
+// NewFile instead of by the first Write.
+//
+// Directories below that depend on the time are still created when the
+// files are rotated. The check is skipped when the output is not written
+// to files, i.e. with WithPassthrough, WithFIFO, or WithFileOpener.
+func WithVerifyDirectory(v bool) Option {
+	return option.New(identVerifyDirectory{}, v)
+}
+
+// WithPreopen opens the file for the next time slot in the background
+// when a write happens within the given lead time before the boundary,
+// so that the write that crosses the boundary does not have to wait for
+// the directory and the file to be created. The symlink is updated in the
+// background as usual.
+//
+// Until the boundary is crossed, a marker file with the "_preopen" suffix
+// is kept next to a pre-opened file that did not exist, so that it is
+// neither counted by the retention policy nor read by a Follower or a
+// FrameReader. If the File is closed before the boundary, the file is
+// removed.
+func WithPreopen(lead time.Duration) Option {
+	return option.New(identPreopen{}, lead)
+}
+
+// WithRetainSlots specifies the number of time slots (see WithMaxInterval)
+// that files are retained for, e.g. 7 with daily files to keep the logs of
+// the last 7 days, however many generations WithMaxFileSize created in each
+// of them. The slot of each file is taken from its name, so the pattern
+// must contain the time. It can be combined with WithRotationCount and
+// WithMaxAge, in which case files are removed if any of them says so.
+func WithRetainSlots(v int) Option {
+	return option.New(identRetainSlots{}, v)
+}
+
+// WithPartialWriteRetry specifies the number of times that the rest of a
+// record is written again after a write failed midway (e.g. because a
+// disk quota was hit), after reopening the file, or rotating it if it is
+// due. If the record ends up in a new file, the whole record is written
+// to it. The error is reported to the error handler for each retry, and
+// returned from Write if the last retry fails as well. The default is 0,
+// i.e. no retries.
+func WithPartialWriteRetry(v int) Option {
+	return option.New(identPartialWriteRetry{}, v)
+}
+
+// WithContinuationMarkers writes a "-- continued in <next file> --" line
+// at the end of each file that is rotated out, and a
+// "-- continued from <previous file> --" line at the beginning of the file
+// that replaces it (after the header, if any), so that readers can follow
+// the stream across files.
+//
+// No markers are written when a Scheduler finishes a file because its
+// time slot ended before anything was written to the next file.
+func WithContinuationMarkers(v bool) Option {
+	return option.New(identContinuationMarkers{}, v)
+}
+
+// WithMaxUncompressedSize specifies the number of bytes written to a file
+// by this File (excluding headers and footers) that triggers a rotation.
+// The data is counted before it is passed to the WriterWrapper, so with
+// on-the-fly compression this limits the uncompressed size, whereas
+// WithMaxFileSize limits the compressed size on disk. Both may be
+// specified, in which case the file is rotated when either is reached.
+// Unlike WithMaxFileSize, this is checked on every write.
+func WithMaxUncompressedSize(v int64) Option {
+	return option.New(identMaxUncompressedSize{}, v)
+}
+
+// WithBackoff specifies the policy for retrying the creation of a new file
+// when it fails, e.g. on network file systems that fail intermittently.
+// By default the creation is attempted only once. Note that the write
+// that triggered the rotation waits while the attempts are made.
+func WithBackoff(v backoff.Policy) Option {
+	return option.New(identBackoff{}, v)
+}
+
+// WithRotateHook specifies a function that is called each time that the
+// File rotates from one file to another, e.g. to compress or ship the
+// file that was rotated out. It is called from the maintenance goroutine
+// after the previous file has been flushed and closed, so the previous
+// file is complete by the time that the hook sees it. If the files are
+// compressed (see WithCompress), it is called from the compression
+// workers once the file has been compressed instead. It is not called
+// when the first file is opened, nor when the File is closed.
+//
+// The hook must not call methods of the File, and should return quickly,
+// as other maintenance tasks (e.g. purging old files) wait for it.
+func WithRotateHook(v func(RotationInfo)) Option {
+	return option.New(identRotateHook{}, v)
+}
+
+// WithCompress compresses the files that have been rotated out with gzip,
+// in the background. Each file is replaced by a file with the same name
+// and a ".gz" suffix once it has been compressed. If that file already
+// exists (e.g. because the process was restarted within the same time
+// slot), the data is appended to it as another gzip member, which
+// gzip readers (including ConcatReader) read as a single stream.
+//
+// The file that is current when the File is closed is not compressed.
+// This option is ignored with WithFIFO and WithFileOpener.
+func WithCompress(v bool) Option {
+	return option.New(identCompress{}, v)
+}
+
+// WithCompressor is the same as WithCompress, but the files are compressed
+// with the given Compressor instead of gzip, e.g. to use zstd or lz4
+// implementations from other packages.
+func WithCompressor(v Compressor) Option {
+	return option.New(identCompressor{}, v)
+}
+
+// WithCompressionWorkers specifies the number of goroutines that compress
+// the files that have been rotated out, as specified by WithCompress or
+// WithCompressor. Files that are rotated out while all of the workers are
+// busy are queued. The default is 1, which compresses the files in the
+// order they were rotated out; with more workers, files (and the calls to
+// the hooks) may complete out of order.
+func WithCompressionWorkers(v int) Option {
+	return option.New(identCompressionWorkers{}, v)
+}
+
+// WithCompressHook specifies a function that is called from the
+// compression workers each time that a file has been compressed, or
+// failed to be compressed, e.g. to monitor the progress of the
+// compression. Like the hook specified by WithRotateHook, it must not
+// call methods of the File.
+func WithCompressHook(v func(CompressionInfo)) Option {
+	return option.New(identCompressHook{}, v)
+}
+
+// WithArchiveDir specifies a directory that the files that fall out of
+// the retention policy are moved to, instead of being removed. The files
+// keep their paths relative to the directory of the pattern (e.g.
+// "logs/%Y/%m%d.log" with the archive directory "archive" moves
+// "logs/2021/0101.log" to "archive/2021/0101.log"), and a numeric suffix is
+// appended if a file with the same name has already been archived. Files
+// in the archive directory never count towards the retention policy.
+//
+// The files are renamed, so the archive directory must be on the same
+// file system as the files.
+func WithArchiveDir(v string) Option {
+	return option.New(identArchiveDir{}, v)
+}
+
+// WithArchiver specifies an Archiver that the files that have been rotated
+// out are handed over to, e.g. to ship them to object storage. Each file
+// is archived once it is complete (and compressed, with WithCompress or
+// WithCompressor), before the function specified by WithRotateHook is
+// called, and is kept from being purged by the retention policy until
+// Archive returns nil. If Archive fails, the error is reported to the
+// error handler as a *FileError with OpArchive, the file is kept, and it
+// is archived again along with the next file that is rotated out.
+//
+// The files are archived one at a time by a dedicated goroutine, so
+// neither the writes nor the other maintenance tasks wait for them, and
+// Close waits for the queued files to be archived. Until a file has been
+// archived, a marker file with the "_archive" suffix is kept next to it,
+// so that the files that were not archived (e.g. because the process
+// exited) are archived by the next File created with the same pattern.
+// The file that is current when the File is closed is not archived. This
+// option is ignored with WithFIFO and WithFileOpener.
+func WithArchiver(v Archiver) Option {
+	return option.New(identArchiver{}, v)
+}
+
+// WithArchiveTimeout specifies the time that each call to the Archiver
+// specified by WithArchiver may take, after which its context is
+// canceled. The default is 10 minutes, and zero means no timeout.
+func WithArchiveTimeout(v time.Duration) Option {
+	return option.New(identArchiveTimeout{}, v)
+}
+
+// WithPurgeHook specifies a function that is called after each purge that
+// removed files, or failed to remove them, with the names of the files
+// that were removed (or moved to the directory specified by
+// WithArchiveDir), and the errors for those that could not be, e.g. to
+// audit the removals. Only the first of the errors is reported to the
+// error handler.
+//
+// The hook is called from the maintenance goroutine, or from the
+// goroutine that calls Purge, and must not call methods of the File.
+func WithPurgeHook(v func(removed []string, errs []error)) Option {
+	return option.New(identPurgeHook{}, v)
+}
@@ -0,0 +1,45 @@
+package rotating
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// writeRecovering writes a single record to w. If the write fails after
+// only part of the record was written (e.g. because a quota was hit), the
+// file is reopened (or rotated, if it is due) and the rest of the record
+// is written again, up to the number of times given by
+// WithPartialWriteRetry. If the record ends up in a different file, it is
+// written again in its entirety, so that the new file contains the
+// complete record. The returned count is the number of bytes of the
+// record that are in the file that is being written to.
+// It must be called while holding the lock
+func (f *File) writeRecovering(ctx context.Context, w io.Writer, bufs [][]byte) (int64, error) {
+	n, err := f.writeRecord(w, bufs)
+	for i := 0; err != nil && n > 0 && i < f.partialRetry && ctx.Err() == nil; i++ {
+		f.handleError(errors.Wrapf(err, `partial write to file %s, retrying`, f.filename))
+
+		// The writer may refuse to be written to after an error (e.g.
+		// bufio.Writer), so start over with a new handle
+		filename := f.filename
+		f.releaseWriter()
+		nw, werr := f.getWriter(ctx)
+		if werr != nil {
+			return n, errors.Wrap(werr, `failed to obtain file handle`)
+		}
+
+		rest := bufs
+		if f.filename == filename {
+			rest = skipBytes(bufs, n)
+		} else {
+			n = 0
+		}
+
+		var m int64
+		m, err = f.writeBytes(nw, rest)
+		n += m
+	}
+	return n, err
+}
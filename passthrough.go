@@ -0,0 +1,81 @@
+package rotating
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+)
+
+// PassthroughEnv is the name of the environment variable that enables
+// the passthrough mode when WithPassthrough is not specified. Its value
+// may be "stdout" or "stderr". Any other value is ignored.
+const PassthroughEnv = `ROTATING_PASSTHROUGH`
+
+// passthroughFromEnv returns the writer specified by PassthroughEnv,
+// or nil if the passthrough mode has not been requested
+func passthroughFromEnv() io.Writer {
+	switch strings.ToLower(os.Getenv(PassthroughEnv)) {
+	case "stdout":
+		return os.Stdout
+	case "stderr":
+		return os.Stderr
+	default:
+		return nil
+	}
+}
+
+// NewWriter creates a Writer that either rotates files like NewFile,
+// or writes directly to the standard output or error, so that 12-factor
+// style applications can switch between the two without changing code.
+//
+// A plain writer for the standard output is returned if p is "-" or
+// empty. Otherwise, if the passthrough mode is requested via
+// WithPassthrough or the environment variable named by PassthroughEnv,
+// a plain writer for the specified destination is returned. In all other
+// cases, the result of NewFile is returned.
+func NewWriter(ctx context.Context, p string, options ...Option) (Writer, error) {
+	if p == "" || p == "-" {
+		return &plainWriter{dst: os.Stdout}, nil
+	}
+
+	var dst io.Writer
+	for _, option := range options {
+		if option.Ident() == (identPassthrough{}) {
+			dst = option.Value().(io.Writer)
+		}
+	}
+	if dst == nil {
+		dst = passthroughFromEnv()
+	}
+	if dst != nil {
+		return &plainWriter{dst: dst}, nil
+	}
+
+	return NewFile(ctx, p, options...)
+}
+
+// plainWriter writes directly to the destination. Flush and Close are
+// forwarded to the destination if it supports them, except for the
+// standard output and error, which are never closed
+type plainWriter struct {
+	dst io.Writer
+}
+
+func (w *plainWriter) Write(p []byte) (int, error) {
+	return w.dst.Write(p)
+}
+
+func (w *plainWriter) Flush() error {
+	return flushWriter(w.dst)
+}
+
+func (w *plainWriter) Close() error {
+	if w.dst == os.Stdout || w.dst == os.Stderr {
+		return nil
+	}
+	if c, ok := w.dst.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package rotating
+
+import "sync"
+
+// workerPool runs the tasks for the files that have been rotated out
+// (compressing and archiving them) using a bounded number of goroutines,
+// so that neither the writes nor the other maintenance tasks wait for
+// them. Tasks are queued without limit, and started in the order they
+// were queued.
+type workerPool struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	tasks   []func() error
+	stopped bool
+	onError func(error)
+	wg      sync.WaitGroup
+}
+
+func newWorkerPool(workers int, onError func(error)) *workerPool {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	p := &workerPool{onError: onError}
+	p.cond = sync.NewCond(&p.mu)
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// push queues a task. If the pool has been stopped, the task is executed
+// synchronously
+func (p *workerPool) push(task func() error) {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		if err := task(); err != nil {
+			p.onError(err)
+		}
+		return
+	}
+	p.tasks = append(p.tasks, task)
+	p.cond.Signal()
+	p.mu.Unlock()
+}
+
+// pending returns the number of tasks that are waiting for a worker
+func (p *workerPool) pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.tasks)
+}
+
+func (p *workerPool) work() {
+	defer p.wg.Done()
+	for {
+		p.mu.Lock()
+		for len(p.tasks) == 0 && !p.stopped {
+			p.cond.Wait()
+		}
+		if len(p.tasks) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		task := p.tasks[0]
+		p.tasks = p.tasks[1:]
+		p.mu.Unlock()
+
+		if err := task(); err != nil {
+			p.onError(err)
+		}
+	}
+}
+
+// stop waits for the queued tasks to complete, and stops the workers
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package rotating
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func preallocateFile(fh *os.File, size int64) error {
+	rc, err := fh.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var ferr error
+	if err := rc.Control(func(fd uintptr) {
+		ferr = unix.Fallocate(int(fd), unix.FALLOC_FL_KEEP_SIZE, 0, size)
+	}); err != nil {
+		return err
+	}
+	return ferr
+}
@@ -0,0 +1,19 @@
+//go:build linux
+// +build linux
+
+package rotating_test
+
+import (
+	"os"
+	"syscall"
+)
+
+// allocatedSize returns the disk space allocated to the file, which is
+// larger than its apparent size when it has been preallocated
+func allocatedSize(fi os.FileInfo) (int64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return st.Blocks * 512, true
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package rotating
+
+import "os"
+
+func preallocateFile(_ *os.File, _ int64) error {
+	return nil
+}
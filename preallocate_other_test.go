@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package rotating_test
+
+import "os"
+
+// allocatedSize reports false, as files are only preallocated on Linux
+func allocatedSize(_ os.FileInfo) (int64, bool) {
+	return 0, false
+}
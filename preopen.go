@@ -0,0 +1,144 @@
+package rotating
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// preopenMarkerSuffix is appended to the name of a file that has been
+// opened ahead of time to create a marker that records that the file has
+// not been written to yet, so that it is neither counted by the retention
+// policy nor read by a Follower or a FrameReader until the time slot
+// starts. A marker left behind by a process that exited is removed once
+// the file is opened as the current file
+const preopenMarkerSuffix = `_preopen`
+
+// preopenedFile is the file for the next time slot, opened ahead of time
+// as specified by WithPreopen
+type preopenedFile struct {
+	name    string
+	w       io.Writer
+	created bool // the file did not exist before it was opened
+}
+
+// maybePreopen schedules the file for the next time slot to be opened in
+// the background, if the boundary is closer than the lead time given by
+// WithPreopen.
+// It must be called while holding the lock
+func (f *File) maybePreopen() {
+	if f.preopenLead <= 0 || f.fifo || f.filename == "" {
+		return
+	}
+
+	now := f.clock.Now()
+	next := truncate(now, f.maxInterval).Add(f.maxInterval)
+	if now.Before(next.Add(-f.preopenLead)) {
+		return
+	}
+
+	name := f.pattern.FormatString(next)
+	if name == f.filename || name == f.preopening {
+		return
+	}
+	f.preopening = name
+
+	flag := f.newFileFlag()
+	f.schedule(func() error {
+		p, err := f.preopen(name, flag)
+		if err != nil {
+			return err
+		}
+
+		f.preMu.Lock()
+		prev := f.preopened
+		f.preopened = p
+		f.preMu.Unlock()
+		if prev != nil {
+			return f.discardPreopened(prev)
+		}
+		return nil
+	})
+}
+
+// preopen opens the given file ahead of time. A file that did not exist
+// is marked as such, until it is opened as the current file.
+// It is run from the maintenance goroutine
+func (f *File) preopen(name string, flag int) (*preopenedFile, error) {
+	p := &preopenedFile{name: name}
+	if f.opener == nil {
+		if _, err := f.fs.Stat(name); os.IsNotExist(err) {
+			fh, err := createFile(f.fs, name+preopenMarkerSuffix, os.O_WRONLY, f.create)
+			if err != nil {
+				return nil, fileError(OpOpen, name, errors.Wrap(err, `failed to create marker`))
+			}
+			_ = fh.Close()
+			p.created = true
+		}
+	}
+
+	w, err := f.openFileWithTimeout(name, flag)
+	if err != nil {
+		if p.created {
+			_ = f.fs.Remove(name + preopenMarkerSuffix)
+		}
+		return nil, err
+	}
+	p.w = w
+	return p, nil
+}
+
+// takePreopened returns the writer for the given file if it has been
+// opened ahead of time, or nil. A file that was opened for another name
+// (e.g. because the clock jumped) is discarded.
+// It must be called while holding the lock
+func (f *File) takePreopened(name string) io.Writer {
+	f.preMu.Lock()
+	p := f.preopened
+	f.preopened = nil
+	f.preMu.Unlock()
+
+	if p == nil {
+		return nil
+	}
+	if p.name != name {
+		f.schedule(func() error {
+			return f.discardPreopened(p)
+		})
+		return nil
+	}
+	return p.w
+}
+
+// clearPreopenMarker removes the marker of the given file, which has
+// been opened as the current file, in case it was opened ahead of time by
+// this File or by a previous one.
+// It must be called while holding the lock
+func (f *File) clearPreopenMarker(name string) {
+	if f.opener != nil || f.fifo {
+		return
+	}
+	if err := f.fs.Remove(name + preopenMarkerSuffix); err != nil && !os.IsNotExist(err) {
+		f.handleError(fileError(OpOpen, name, errors.Wrap(err, `failed to remove marker`)))
+	}
+}
+
+// discardPreopened closes a file that was opened ahead of time but is
+// not going to be written to, and removes it unless it already existed
+// or it has been opened as the current file since
+func (f *File) discardPreopened(p *preopenedFile) error {
+	if err := finalizeWriter(p.w); err != nil {
+		return fileError(OpFinalize, p.name, err)
+	}
+	if current, _ := f.activeName.Load().(string); !p.created || current == p.name {
+		return nil
+	}
+	if err := f.fs.Remove(p.name); err != nil && !os.IsNotExist(err) {
+		return fileError(OpPurge, p.name, err)
+	}
+	if err := f.fs.Remove(p.name + preopenMarkerSuffix); err != nil && !os.IsNotExist(err) {
+		return fileError(OpPurge, p.name, errors.Wrap(err, `failed to remove marker`))
+	}
+	return nil
+}
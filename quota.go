@@ -0,0 +1,83 @@
+package rotating
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// QuotaPolicy specifies what happens to writes that exceed the quota
+// specified by WithSlotQuota
+type QuotaPolicy int
+
+const (
+	// QuotaDrop discards writes that exceed the quota. A single marker
+	// with the number of discarded records is written at the end of the
+	// time slot
+	QuotaDrop QuotaPolicy = iota
+	// QuotaOverflow diverts writes that exceed the quota to an overflow file
+	QuotaOverflow
+)
+
+const overflowSuffix = `.overflow`
+
+// quotaExceeded must be called while holding the lock
+func (f *File) quotaExceeded(size int) bool {
+	return f.slotQuota > 0 && f.slotBytes+int64(size) > f.slotQuota
+}
+
+// writeOverQuota handles writes that exceed the quota for the current
+// time slot. It must be called while holding the lock
+func (f *File) writeOverQuota(bufs [][]byte, size int) (int64, error) {
+	if f.quotaPolicy != QuotaOverflow {
+		f.suppressed++
+		f.stats.QuotaSuppressed++
+		return int64(size), nil
+	}
+
+	if f.overflow == nil {
+		fn := f.pattern.FormatString(f.baseTime) + overflowSuffix
+		w, err := f.openFileWithTimeout(fn, f.newFileFlag())
+		if err != nil {
+			return 0, errors.Wrapf(err, `failed to open overflow file %s`, fn)
+		}
+		f.overflow = w
+		f.overflowName = fn
+		f.activeOverflow.Store(fn)
+	}
+	n, err := writeBuffers(f.overflow, bufs)
+	if err == nil {
+		f.mirrorWrite(f.overflowName, bufs)
+	}
+	return n, err
+}
+
+// endSlot is called when the current time slot ends. It writes the
+// marker for suppressed records, and releases the overflow file.
+// It must be called while holding the lock
+func (f *File) endSlot() {
+	if f.overflow != nil {
+		f.finalizeAsync(f.overflow, f.overflowName)
+		f.overflow = nil
+		f.overflowName = ""
+		f.activeOverflow.Store("")
+	}
+
+	if f.suppressed > 0 && f.filename != "" && !f.sealed {
+		if f.file == nil {
+			// The file handle may have been released because it was idle
+			if w, err := f.openFileWithTimeout(f.filename, 0); err == nil {
+				f.file = w
+			}
+		}
+		if f.file != nil {
+			marker := fmt.Sprintf("-- %d records suppressed --\n", f.suppressed)
+			b := f.encodeFrame([]byte(marker))
+			if _, err := f.file.Write(b); err == nil {
+				f.mirrorWrite(f.filename, [][]byte{b})
+			}
+		}
+	}
+	f.suppressed = 0
+	f.slotBytes = 0
+}
@@ -0,0 +1,88 @@
+package rotating
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimitPolicy specifies what happens to writes that exceed the
+// rate limit specified by WithRateLimit
+type RateLimitPolicy int
+
+const (
+	// RateLimitBlock blocks the write until enough bandwidth is available
+	RateLimitBlock RateLimitPolicy = iota
+	// RateLimitDrop silently discards the write
+	RateLimitDrop
+)
+
+// rateLimiter is a simple token bucket, where each token represents a byte
+type rateLimiter struct {
+	mu     sync.Mutex
+	burst  float64
+	last   time.Time
+	rate   float64 // bytes per second
+	tokens float64
+}
+
+func newRateLimiter(rate, burst int64) *rateLimiter {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &rateLimiter{
+		burst:  float64(burst),
+		last:   time.Now(),
+		rate:   float64(rate),
+		tokens: float64(burst),
+	}
+}
+
+// refill must be called while holding the lock
+func (l *rateLimiter) refill(now time.Time) {
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// allow returns true if n bytes can be written right now. Writes larger
+// than the burst size are allowed only when the bucket is full.
+func (l *rateLimiter) allow(n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	if l.tokens >= float64(n) || l.tokens >= l.burst {
+		l.tokens -= float64(n)
+		return true
+	}
+	return false
+}
+
+// wait blocks until n bytes can be written, or the context is canceled
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	l.refill(time.Now())
+	// Reserve the tokens right away, even if it makes the bucket
+	// go negative. Subsequent writers will have to wait longer
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(time.Duration(deficit / l.rate * float64(time.Second)))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
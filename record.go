@@ -0,0 +1,39 @@
+package rotating
+
+import "bytes"
+
+// splitRecord splits bufs right after the first occurrence of delim.
+// If delim is not found, all of bufs is returned as head.
+func splitRecord(bufs [][]byte, delim byte) (head, tail [][]byte) {
+	for i, buf := range bufs {
+		idx := bytes.IndexByte(buf, delim)
+		if idx < 0 {
+			continue
+		}
+
+		head = make([][]byte, 0, i+1)
+		head = append(head, bufs[:i]...)
+		head = append(head, buf[:idx+1])
+
+		if rest := buf[idx+1:]; len(rest) > 0 {
+			tail = make([][]byte, 0, len(bufs)-i)
+			tail = append(tail, rest)
+			tail = append(tail, bufs[i+1:]...)
+		} else {
+			tail = bufs[i+1:]
+		}
+		return head, tail
+	}
+	return bufs, nil
+}
+
+// lastByte returns the last byte in bufs. The second return value is
+// false if bufs does not contain any data
+func lastByte(bufs [][]byte) (byte, bool) {
+	for i := len(bufs) - 1; i >= 0; i-- {
+		if l := len(bufs[i]); l > 0 {
+			return bufs[i][l-1], true
+		}
+	}
+	return 0, false
+}
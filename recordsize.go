@@ -0,0 +1,73 @@
+package rotating
+
+import (
+	"context"
+	"fmt"
+)
+
+// RecordSizePolicy specifies what happens to records that exceed the
+// size specified by WithMaxRecordSize
+type RecordSizePolicy int
+
+const (
+	// RecordReject rejects the record, and returns a *RecordSizeError
+	RecordReject RecordSizePolicy = iota
+	// RecordTruncate writes the first bytes of the record up to the
+	// maximum size, followed by a marker
+	RecordTruncate
+	// RecordSplit splits the record into several records, none of which
+	// exceed the maximum size. In the framing mode, each of them is
+	// written as a separate frame
+	RecordSplit
+)
+
+const truncatedMarker = `[truncated]`
+
+// writeOversized handles records that exceed the maximum record size.
+// It is called without holding the lock
+func (f *File) writeOversized(ctx context.Context, bufs [][]byte, size int64) error {
+	f.mu.Lock()
+	f.stats.Oversized++
+	f.mu.Unlock()
+
+	switch f.oversizePolicy {
+	case RecordTruncate:
+		rec := joinBuffers(bufs)
+		truncated := [][]byte{rec[:f.maxRecordSize], []byte(truncatedMarker)}
+		// Keep the record terminated so that the next record starts
+		// on its own line
+		if last := rec[len(rec)-1]; last == '\n' || (f.recordAware && last == f.recordDelimiter) {
+			truncated = append(truncated, []byte{last})
+		}
+		return f.writeFramed(ctx, truncated)
+	case RecordSplit:
+		rec := joinBuffers(bufs)
+		for len(rec) > 0 {
+			n := f.maxRecordSize
+			if int64(len(rec)) < n {
+				n = int64(len(rec))
+			}
+			if err := f.writeFramed(ctx, [][]byte{rec[:n]}); err != nil {
+				return err
+			}
+			rec = rec[n:]
+		}
+		return nil
+	default:
+		return &RecordSizeError{
+			Size: size,
+			Max:  f.maxRecordSize,
+		}
+	}
+}
+
+// RecordSizeError is returned when a record that exceeds the size
+// specified by WithMaxRecordSize is rejected
+type RecordSizeError struct {
+	Size int64
+	Max  int64
+}
+
+func (e *RecordSizeError) Error() string {
+	return fmt.Sprintf(`record size %d exceeds the maximum of %d bytes`, e.Size, e.Max)
+}
@@ -0,0 +1,542 @@
+package rotating
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RemoveFS is an fs.FS that can also remove files, which is all that is
+// needed to apply the retention policy to a store. If it implements
+// `Lstat(name string) (fs.FileInfo, error)` and
+// `ReadLink(name string) (string, error)`, symlinks are detected, and the
+// file that the symlink points to is protected from being removed.
+type RemoveFS interface {
+	fs.FS
+	Remove(name string) error
+}
+
+// retention describes which files to retain
+type retention struct {
+	count        int
+	maxAge       time.Duration
+	slots        int
+	maxTotalSize int64
+	lowDiskSpace func() (bool, error)
+	parser       *nameParser // extracts the time slots from the names
+	names        *nameParser // if non-nil, only the names that it parses are considered
+	suffix       string      // suffix of the compressed files, besides ".gz"
+	protected    string      // name of the file that the symlink points to
+	hasProtected bool
+	current      string              // name of the file that is being written to
+	overflow     string              // name of the overflow file that is being written to
+	pending      map[string]struct{} // names of the files that have not been archived
+}
+
+// Purge removes the files generated from the given strftime pattern from
+// fsys according to the retention policy, so that the same retention
+// logic that File uses can be applied to remote or virtual stores.
+//
+// The pattern, and the symlink specified by WithSymlink, are names in
+// fsys, i.e. slash separated paths without a leading slash. The options
+// that are honored are WithRotationCount, WithMaxAge, WithRetainSlots,
+// WithMaxTotalSize, WithSymlink, WithCompressor, and WithClock. If files cannot be removed,
+// the first error is returned after attempting to remove the others.
+func Purge(fsys RemoveFS, pattern string, options ...Option) error {
+	var r retention
+	var symlink string
+	clock := Local()
+	for _, option := range options {
+		switch option.Ident() {
+		case identRotationCount{}:
+			r.count = option.Value().(int)
+		case identMaxAge{}:
+			r.maxAge = option.Value().(time.Duration)
+		case identRetainSlots{}:
+			r.slots = option.Value().(int)
+		case identMaxTotalSize{}:
+			r.maxTotalSize = option.Value().(int64)
+		case identSymlink{}:
+			symlink = option.Value().(string)
+		case identCompressor{}:
+			r.suffix = option.Value().(Compressor).Suffix()
+		case identClock{}:
+			clock = option.Value().(Clock)
+		}
+	}
+
+	r.names = newNameParser(pattern, clock.Now().Location())
+	if r.slots > 0 {
+		parser, err := newSlotParser(pattern, clock.Now().Location())
+		if err != nil {
+			return err
+		}
+		r.parser = parser
+	}
+
+	if symlink != "" {
+		if rl, ok := fsys.(interface{ ReadLink(string) (string, error) }); ok {
+			if dst, err := rl.ReadLink(symlink); err == nil {
+				if !path.IsAbs(dst) {
+					dst = path.Join(path.Dir(symlink), dst)
+				}
+				r.protected = dst
+				r.hasProtected = true
+			}
+		}
+	}
+
+	_, errs := r.purge(fsys, globFromPattern(pattern), clock.Now())
+	return firstError(errs)
+}
+
+// firstError returns the first of errs, or nil if there are none
+func firstError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+// purge removes the files matching the glob pattern from fsys, and
+// returns the names of the files that were removed, and the errors for
+// those that could not be. Files that have already been removed by
+// someone else are not considered an error
+func (r *retention) purge(fsys RemoveFS, pattern string, now time.Time) ([]string, []error) {
+	matches, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, []error{fileError(OpPurge, pattern, err)}
+	}
+
+	stats := make(map[string]fs.FileInfo)
+	overflows := make(map[string]fs.FileInfo)
+	var preopened []string
+	// stat all the files once and cache
+	for _, name := range matches {
+		if r.names != nil {
+			if _, ok := r.names.parseFile(name); !ok {
+				continue
+			}
+		}
+		if strings.HasSuffix(name, preopenMarkerSuffix) {
+			preopened = append(preopened, strings.TrimSuffix(name, preopenMarkerSuffix))
+			continue
+		}
+		if isTemporaryFile(name) {
+			continue
+		}
+
+		fi, err := lstat(fsys, name)
+		if err != nil {
+			continue
+		}
+
+		if strings.HasSuffix(name, overflowSuffix) {
+			// Overflow files (see WithSlotQuota) hold the records that
+			// did not fit in their time slot, and are only removed
+			// because of their age
+			if name != r.overflow {
+				overflows[name] = fi
+			}
+			continue
+		}
+		stats[name] = fi
+	}
+
+	// The current file (and the file that the symlink points to, which
+	// is usually the same) counts towards the rotation count, but is
+	// never removed
+	var excluded int
+	if r.hasProtected {
+		delete(stats, r.protected)
+		excluded++
+	}
+	if r.current != "" && (!r.hasProtected || r.current != r.protected) {
+		if _, ok := stats[r.current]; ok {
+			delete(stats, r.current)
+			excluded++
+		}
+	}
+	for name := range r.pending {
+		delete(stats, name)
+	}
+	// Files opened ahead of time for the next time slot have not been
+	// written to yet
+	for _, name := range preopened {
+		delete(stats, name)
+	}
+
+	matches = make([]string, 0, len(stats))
+	for name := range stats {
+		matches = append(matches, name)
+	}
+
+	// sort by name. Compressed files are sorted as if they were not, so
+	// that a compressed file precedes the next generation in its slot
+	sort.Slice(matches, func(i, j int) bool {
+		return strings.Compare(r.trimSuffix(matches[i]), r.trimSuffix(matches[j])) < 0
+	})
+
+	toPurge := make([]string, 0, len(matches))
+	candidates := make([]string, 0, len(matches))
+
+	cutoff := now.Add(-1 * r.maxAge)
+	if r.maxAge > 0 {
+		for _, name := range sortedNames(overflows) {
+			if overflows[name].ModTime().Before(cutoff) {
+				toPurge = append(toPurge, name)
+			}
+		}
+	}
+	for _, name := range matches {
+		fi := stats[name]
+		if fi.Mode()&fs.ModeSymlink == fs.ModeSymlink {
+			continue
+		}
+
+		if r.maxAge > 0 && fi.ModTime().Before(cutoff) {
+			toPurge = append(toPurge, name)
+			continue
+		}
+
+		candidates = append(candidates, name)
+	}
+
+	if r.slots > 0 {
+		var old []string
+		candidates, old = r.splitBySlot(candidates)
+		toPurge = append(toPurge, old...)
+	}
+
+	if c := r.count; c > 0 {
+		// if we protected files from being deleted, they need to be
+		// added to the total count of files
+		lc := len(candidates)
+		c -= excluded
+		if lc > c {
+			toPurge = append(toPurge, candidates[:lc-c]...)
+			candidates = candidates[lc-c:]
+		}
+	}
+
+	// Unless the current file is known, the newest file is assumed to be
+	// the one being written to, which is never removed because of the
+	// disk usage
+	var newest int
+	if !r.hasProtected && r.current == "" && len(candidates) > 0 {
+		newest = 1
+	}
+
+	if r.maxTotalSize > 0 {
+		var total int64
+		for _, name := range candidates[:len(candidates)-newest] {
+			total += stats[name].Size()
+		}
+		for len(candidates) > newest && total > r.maxTotalSize {
+			total -= stats[candidates[0]].Size()
+			toPurge = append(toPurge, candidates[0])
+			candidates = candidates[1:]
+		}
+	}
+
+	removed := make([]string, 0, len(toPurge))
+	var errs []error
+	remove := func(name string) {
+		if err := fsys.Remove(name); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, fileError(OpPurge, name, err))
+			}
+			return
+		}
+		removed = append(removed, name)
+	}
+	for _, name := range toPurge {
+		remove(name)
+	}
+
+	// Remove the oldest of the remaining files one at a time while the
+	// free disk space is below the minimum
+	if r.lowDiskSpace != nil {
+		for len(candidates) > newest {
+			low, err := r.lowDiskSpace()
+			if err != nil {
+				errs = append(errs, fileError(OpPurge, pattern, err))
+				break
+			}
+			if !low {
+				break
+			}
+			remove(candidates[0])
+			candidates = candidates[1:]
+		}
+	}
+	return removed, errs
+}
+
+// sortedNames returns the names in stats in sorted order
+func sortedNames(stats map[string]fs.FileInfo) []string {
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// trimSuffix removes the suffix of compressed files from name
+func (r *retention) trimSuffix(name string) string {
+	if r.suffix != "" && strings.HasSuffix(name, r.suffix) {
+		return strings.TrimSuffix(name, r.suffix)
+	}
+	return strings.TrimSuffix(name, gzipSuffix)
+}
+
+// newSlotParser creates the parser used to tell which time slot the files
+// generated from pattern belong to
+func newSlotParser(pattern string, loc *time.Location) (*nameParser, error) {
+	parser := newNameParser(pattern, loc)
+	if !parser.hasTime {
+		return nil, errors.Errorf(`pattern %q does not contain the time of the files`, pattern)
+	}
+	return parser, nil
+}
+
+// splitBySlot splits the names (sorted by name) into the files that
+// belong to the newest time slots, which are retained, and the others.
+// The slot of the protected file always counts as one of the newest, and
+// names that the time cannot be extracted from are retained
+func (r *retention) splitBySlot(names []string) ([]string, []string) {
+	slotOf := make(map[string]time.Time, len(names))
+	seen := make(map[time.Time]struct{})
+	var slots []time.Time
+	addSlot := func(t time.Time) {
+		if _, ok := seen[t]; !ok {
+			seen[t] = struct{}{}
+			slots = append(slots, t)
+		}
+	}
+
+	for _, name := range names {
+		t, _, ok := r.parser.parse(name)
+		if !ok {
+			continue
+		}
+		slotOf[name] = t
+		addSlot(t)
+	}
+
+	protected, _, hasProtected := r.parser.parse(r.protected)
+	hasProtected = hasProtected && r.hasProtected
+	if hasProtected {
+		addSlot(protected)
+	}
+
+	if len(slots) <= r.slots {
+		return names, nil
+	}
+
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].After(slots[j])
+	})
+	retained := make(map[time.Time]struct{}, r.slots)
+	for _, t := range slots[:r.slots] {
+		retained[t] = struct{}{}
+	}
+	if hasProtected {
+		retained[protected] = struct{}{}
+	}
+
+	var kept, old []string
+	for _, name := range names {
+		t, ok := slotOf[name]
+		if _, retain := retained[t]; !ok || retain {
+			kept = append(kept, name)
+			continue
+		}
+		old = append(old, name)
+	}
+	return kept, old
+}
+
+func lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if l, ok := fsys.(interface {
+		Lstat(string) (fs.FileInfo, error)
+	}); ok {
+		return l.Lstat(name)
+	}
+	return fs.Stat(fsys, name)
+}
+
+// temporarySuffixes are the suffixes of the temporary files and markers
+// that are created next to the files generated from a pattern
+var temporarySuffixes = []string{`_lock`, `_symlink`, `_snapshot`, `_compress`, archiveMarkerSuffix, preopenMarkerSuffix}
+
+// isTemporaryFile reports whether name is one of the temporary files or
+// markers, which are neither purged nor read as log files
+func isTemporaryFile(name string) bool {
+	for _, suffix := range temporarySuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRoot returns the longest leading directory of the glob pattern
+// that does not contain any wildcards
+func globRoot(pattern string) string {
+	dir := filepath.Dir(pattern)
+	for strings.ContainsAny(dir, `*?[`) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// fsName converts a path to a name relative to root, as used by fs.FS.
+// It reports false if the path is not under root
+func fsName(root, p string) (string, bool) {
+	if filepath.IsAbs(root) != filepath.IsAbs(p) {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return "", false
+	}
+	name := filepath.ToSlash(rel)
+	if !fs.ValidPath(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// fileSystemFS exposes the files under root in a FileSystem as a RemoveFS
+type fileSystemFS struct {
+	fs   FileSystem
+	root string
+}
+
+func (fsys *fileSystemFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(fsys.root, filepath.FromSlash(name)), nil
+}
+
+func (fsys *fileSystemFS) Open(name string) (fs.File, error) {
+	p, err := fsys.path(`open`, name)
+	if err != nil {
+		return nil, err
+	}
+	fh, err := fsys.fs.OpenFile(p, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSystemFile{FileHandle: fh, fs: fsys.fs, path: p}, nil
+}
+
+func (fsys *fileSystemFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := fsys.path(`stat`, name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.fs.Stat(p)
+}
+
+func (fsys *fileSystemFS) Lstat(name string) (fs.FileInfo, error) {
+	p, err := fsys.path(`lstat`, name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.fs.Lstat(p)
+}
+
+func (fsys *fileSystemFS) Glob(pattern string) ([]string, error) {
+	p, err := fsys.path(`glob`, pattern)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := fsys.fs.Glob(p)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if name, ok := fsName(fsys.root, match); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (fsys *fileSystemFS) Remove(name string) error {
+	p, err := fsys.path(`remove`, name)
+	if err != nil {
+		return err
+	}
+	return fsys.fs.Remove(p)
+}
+
+type fileSystemFile struct {
+	FileHandle
+	fs   FileSystem
+	path string
+}
+
+func (f *fileSystemFile) Stat() (fs.FileInfo, error) {
+	return f.fs.Stat(f.path)
+}
+
+// archiveFS is a fileSystemFS whose Remove moves the files to the archive
+// directory specified by WithArchiveDir, keeping their paths relative to
+// the root. The files in the archive directory are not listed, so that
+// they do not count towards the retention policy
+type archiveFS struct {
+	*fileSystemFS
+	dir    string
+	create createOptions
+}
+
+func (fsys *archiveFS) Glob(pattern string) ([]string, error) {
+	matches, err := fsys.fileSystemFS.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	names := matches[:0]
+	for _, name := range matches {
+		if _, archived := fsName(fsys.dir, filepath.Join(fsys.root, filepath.FromSlash(name))); !archived {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (fsys *archiveFS) Remove(name string) error {
+	p, err := fsys.path(`remove`, name)
+	if err != nil {
+		return err
+	}
+
+	dst := filepath.Join(fsys.dir, filepath.FromSlash(name))
+	if err := mkdirAll(fsys.fs, filepath.Dir(dst), fsys.create); err != nil {
+		return err
+	}
+
+	// Do not overwrite files that have been archived before, e.g. by a
+	// previous process that wrote to the same names
+	for i := 1; ; i++ {
+		if _, err := fsys.fs.Lstat(dst); err != nil {
+			break
+		}
+		dst = filepath.Join(fsys.dir, filepath.FromSlash(name)) + `.` + strconv.Itoa(i)
+	}
+	return fsys.fs.Rename(p, dst)
+}
@@ -5,14 +5,13 @@ package rotating
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lestrrat-go/backoff"
@@ -21,29 +20,118 @@ import (
 )
 
 type File struct {
-	backoff       backoff.Policy
-	baseTime      time.Time
-	cancel        func()
-	checkInterval time.Duration
-	clock         Clock
-	ctx           context.Context
-	file          io.Writer
-	filename      string // current filename
-	generation    int
-	globPattern   string
-	pattern       *strftime.Strftime
-	lastCheck     time.Time
-	maxAge        time.Duration
-	maxInterval   time.Duration
-	maxFileSize   int64
-	mu            sync.RWMutex
-	nextCheck     *time.Timer
-	rotationCount int
-	symlink       string
+	backoff         backoff.Policy
+	baseTime        time.Time
+	breaker         *circuitBreaker
+	bufferSize      int
+	cancel          func()
+	closed          bool
+	checkInterval   time.Duration
+	clock           Clock
+	errorHandler    func(error)
+	expectedSize    int64
+	fallback        io.Writer
+	fallbackActive  bool
+	fallbackRetry   time.Duration
+	fallbackUntil   time.Time
+	fifo            bool
+	ctx             context.Context
+	maintenanceDone chan struct{}
+	dirSync         bool
+	file            io.Writer
+	fileBaseTime    time.Time
+	fileGeneration  int
+	fileBytes       int64
+	fileRecords     int64
+	filename        string // current filename
+	filters         []Filter
+	footer          FooterFunc
+	frameChecksum   bool
+	framing         bool
+	generation      int
+	globPattern     string
+	header          HeaderFunc
+	idleArmed       bool
+	idleTimeout     time.Duration
+	idleTimer       *time.Timer
+	lastActive      time.Time
+	passthrough     io.Writer
+	pattern         *strftime.Strftime
+	lastCheck       time.Time
+	maxAge          time.Duration
+	maxInterval     time.Duration
+	midRecord       bool
+	maxFileSize     int64
+	maxRecordSize   int64
+	mirror          *mirror
+	mmapRegion      int64
+	preallocate     int64
+	quotaPolicy     QuotaPolicy
+	rateLimiter     *rateLimiter
+	rateLimitPolicy RateLimitPolicy
+	recordAware     bool
+	recordDelimiter byte
+	mu              sync.RWMutex
+	overflow        io.Writer
+	overflowName    string
+	oversizePolicy  RecordSizePolicy
+	opener          FileOpener
+	openFlags       int
+	opTimeout       time.Duration
+	rotationCount   int
+	slotBytes       int64
+	slotQuota       int64
+	stats           Stats
+	suppressed      int64
+	symlink         string
+	syncRotation    bool
+	sealed          bool // the current file was finalized by a synchronous rotation that failed
+	tasks           chan func() error
+	purgeHook       func([]string, []error)
+	minDiskFree     DiskFree
+	maxTotalSize    int64
+	archiver        Archiver
+	archiveTimeout  time.Duration
+	archiving       *workerPool
+	activeName      atomic.Value
+	activeOverflow  atomic.Value
+	unarchived      *archiveSet
+	archiveDir      string
+	compressHook    func(CompressionInfo)
+	compression     *workerPool
+	compressor      Compressor
+	rotateHook      func(RotationInfo)
+	maxUncompressed int64
+	continuation    bool
+	partialRetry    int
+	retainSlots     int
+	nameParser      *nameParser
+	slotParser      *nameParser
+	preopenLead     time.Duration
+	preopening      string
+	preMu           sync.Mutex
+	preopened       *preopenedFile
+	truncOnOpen     bool
+	create          createOptions
+	diskFullRetry   time.Duration
+	dropping        bool
+	dropUntil       time.Time
+	dropped         int64
+	options         []Option
+	parentCtx       context.Context
+	oversized       bool
+	queue           *taskQueue
+	scheduler       *Scheduler
+	fs              FileSystem
+	truncation      TruncationPolicy
+	transformers    []Transformer
+	wrapper         WriterWrapper
 }
 
 const (
 	defaultCheckInterval = 5 * time.Minute
+	defaultDirMode       = os.FileMode(0755)
+	defaultFileMode      = os.FileMode(0644)
 )
 
 var patternConversionRegexps = []*regexp.Regexp{
@@ -51,14 +139,93 @@ var patternConversionRegexps = []*regexp.Regexp{
 	regexp.MustCompile(`\*+`),
 }
 
+// globMetaEscaper escapes the characters of a pattern that glob patterns
+// would otherwise interpret, except for "*"
+var globMetaEscaper = strings.NewReplacer(`[`, `[[]`, `?`, `[?]`)
+
+// globFromPattern converts a strftime pattern to a glob pattern that
+// matches all of the files generated from it
+func globFromPattern(p string) string {
+	globPattern := globMetaEscaper.Replace(p)
+	for _, re := range patternConversionRegexps {
+		globPattern = re.ReplaceAllString(globPattern, "*")
+	}
+	if !strings.HasSuffix(globPattern, "*") {
+		globPattern = globPattern + "*" // allow suffixes
+	}
+	return globPattern
+}
+
 func NewFile(ctx context.Context, p string, options ...Option) (*File, error) {
 	bo := backoff.Null()
 	clock := Local()
+	fs := OSFileSystem()
 	maxInterval := time.Hour
+	create := createOptions{
+		dirMode:  defaultDirMode,
+		fileMode: defaultFileMode,
+		uid:      -1,
+		gid:      -1,
+	}
 	var checkInterval time.Duration
 	var maxFileSize int64 = 0
 	var symlink string
 	var rotationCount int
+	var mmapRegion int64
+	var preallocate int64
+	var openFlags int
+	var syncRotation bool
+	var dirSync bool
+	var idleTimeout time.Duration
+	var opTimeout time.Duration
+	var rateLimit, rateBurst int64
+	var rateLimitPolicy RateLimitPolicy
+	var slotQuota int64
+	var quotaPolicy QuotaPolicy
+	var errorHandler func(error)
+	var bufferSize int
+	var recordAware bool
+	var recordDelimiter byte
+	var header HeaderFunc
+	var footer FooterFunc
+	var transformers []Transformer
+	var filters []Filter
+	var framing bool
+	var frameChecksum bool
+	var truncationPolicy TruncationPolicy
+	var maxRecordSize int64
+	var recordSizePolicy RecordSizePolicy
+	var mirrorDir string
+	var fallback io.Writer
+	fallbackRetry := defaultFallbackRetry
+	var breakerThreshold int
+	var breakerCooldown time.Duration
+	var passthrough io.Writer
+	var opener FileOpener
+	var fifo bool
+	var wrapper WriterWrapper
+	var maxAge time.Duration
+	var dockerStream string
+	var scheduler *Scheduler
+	var diskFullRetry time.Duration
+	var truncOnOpen bool
+	var verifyDir bool
+	var preopenLead time.Duration
+	var retainSlots int
+	var partialRetry int
+	var continuation bool
+	var maxUncompressed int64
+	var rotateHook func(RotationInfo)
+	var compress bool
+	var compressor Compressor
+	var compressWorkers int
+	var compressHook func(CompressionInfo)
+	var archiveDir string
+	var archiver Archiver
+	var maxTotalSize int64
+	var minDiskFree DiskFree
+	var purgeHook func([]string, []error)
+	archiveTimeout := defaultArchiveTimeout
 	for _, option := range options {
 		switch option.Ident() {
 		case identClock{}:
@@ -73,191 +240,615 @@ func NewFile(ctx context.Context, p string, options ...Option) (*File, error) {
 			symlink = option.Value().(string)
 		case identRotationCount{}:
 			rotationCount = option.Value().(int)
+		case identMmap{}:
+			mmapRegion = option.Value().(int64)
+		case identPreallocate{}:
+			preallocate = option.Value().(int64)
+		case identOpenFlags{}:
+			openFlags = option.Value().(int)
+		case identSynchronousRotation{}:
+			syncRotation = option.Value().(bool)
+		case identDirSync{}:
+			dirSync = option.Value().(bool)
+		case identIdleTimeout{}:
+			idleTimeout = option.Value().(time.Duration)
+		case identOperationTimeout{}:
+			opTimeout = option.Value().(time.Duration)
+		case identRateLimit{}:
+			v := option.Value().(rateLimitValue)
+			rateLimit = v.rate
+			rateBurst = v.burst
+		case identRateLimitPolicy{}:
+			rateLimitPolicy = option.Value().(RateLimitPolicy)
+		case identSlotQuota{}:
+			v := option.Value().(slotQuotaValue)
+			slotQuota = v.size
+			quotaPolicy = v.policy
+		case identErrorHandler{}:
+			errorHandler = option.Value().(func(error))
+		case identBufferSize{}:
+			bufferSize = option.Value().(int)
+		case identRecordDelimiter{}:
+			recordAware = true
+			recordDelimiter = option.Value().(byte)
+		case identFileHeader{}:
+			header = option.Value().(HeaderFunc)
+		case identFileFooter{}:
+			footer = option.Value().(FooterFunc)
+		case identTransformer{}:
+			transformers = append(transformers, option.Value().(Transformer))
+		case identFilter{}:
+			filters = append(filters, option.Value().(Filter))
+
+		case identFraming{}:
+			framing = option.Value().(bool)
+		case identFrameChecksum{}:
+			frameChecksum = option.Value().(bool)
+		case identTruncationPolicy{}:
+			truncationPolicy = option.Value().(TruncationPolicy)
+		case identMaxRecordSize{}:
+			v := option.Value().(maxRecordSizeValue)
+			maxRecordSize = v.size
+			recordSizePolicy = v.policy
+		case identMirror{}:
+			mirrorDir = option.Value().(string)
+		case identFallback{}:
+			v := option.Value().(fallbackValue)
+			fallback = v.writer
+			if v.retry > 0 {
+				fallbackRetry = v.retry
+			}
+		case identCircuitBreaker{}:
+			v := option.Value().(circuitBreakerValue)
+			breakerThreshold = v.threshold
+			breakerCooldown = v.cooldown
+		case identPassthrough{}:
+			passthrough = option.Value().(io.Writer)
+		case identFileOpener{}:
+			opener = option.Value().(FileOpener)
+		case identFIFO{}:
+			fifo = option.Value().(bool)
+		case identWriterWrapper{}:
+			wrapper = option.Value().(WriterWrapper)
+		case identMaxAge{}:
+			maxAge = option.Value().(time.Duration)
+		case identFileSystem{}:
+			fs = option.Value().(FileSystem)
+		case identDockerJSON{}:
+			dockerStream = option.Value().(string)
+		case identScheduler{}:
+			scheduler = option.Value().(*Scheduler)
+		case identDropOnDiskFull{}:
+			diskFullRetry = option.Value().(time.Duration)
+			if diskFullRetry <= 0 {
+				diskFullRetry = defaultDiskFullRetry
+			}
+		case identDirMode{}:
+			create.dirMode = option.Value().(os.FileMode)
+		case identFileMode{}:
+			create.fileMode = option.Value().(os.FileMode)
+		case identExactPermissions{}:
+			create.exact = option.Value().(bool)
+		case identOwner{}:
+			owner := option.Value().(ownerValue)
+			create.uid, create.gid = owner.uid, owner.gid
+		case identTruncateOnOpen{}:
+			truncOnOpen = option.Value().(bool)
+		case identVerifyDirectory{}:
+			verifyDir = option.Value().(bool)
+		case identPreopen{}:
+			preopenLead = option.Value().(time.Duration)
+		case identRetainSlots{}:
+			retainSlots = option.Value().(int)
+		case identPartialWriteRetry{}:
+			partialRetry = option.Value().(int)
+		case identContinuationMarkers{}:
+			continuation = option.Value().(bool)
+		case identMaxUncompressedSize{}:
+			maxUncompressed = option.Value().(int64)
+		case identBackoff{}:
+			bo = option.Value().(backoff.Policy)
+		case identRotateHook{}:
+			rotateHook = option.Value().(func(RotationInfo))
+		case identCompress{}:
+			compress = option.Value().(bool)
+		case identCompressor{}:
+			compressor = option.Value().(Compressor)
+		case identCompressionWorkers{}:
+			compressWorkers = option.Value().(int)
+		case identCompressHook{}:
+			compressHook = option.Value().(func(CompressionInfo))
+		case identArchiveDir{}:
+			archiveDir = option.Value().(string)
+		case identArchiver{}:
+			archiver = option.Value().(Archiver)
+		case identMaxTotalSize{}:
+			maxTotalSize = option.Value().(int64)
+		case identMinDiskFree{}:
+			minDiskFree = option.Value().(DiskFree)
+		case identPurgeHook{}:
+			purgeHook = option.Value().(func([]string, []error))
+		case identArchiveTimeout{}:
+			archiveTimeout = option.Value().(time.Duration)
 		}
 	}
 
+	if dockerStream != "" {
+		transformers = append(transformers, dockerJSON(dockerStream, clock))
+	}
+
 	// Create the basic strftime pattern object to generate the filenames
 	pattern, err := strftime.New(p)
 	if err != nil {
 		return nil, errors.Wrap(err, `invalid strftime pattern`)
 	}
 
-	if maxFileSize > 0 && checkInterval <= 0 {
+	if (maxFileSize > 0 || truncationPolicy != TruncationIgnore) && checkInterval <= 0 {
 		checkInterval = defaultCheckInterval
 	}
 
-	// Create the timer to periodically check for the file state
-	var nextCheck *time.Timer
-	if checkInterval > 0 {
-		nextCheck = time.NewTimer(checkInterval)
-	} else {
-		nextCheck = time.NewTimer(0)
-		if !nextCheck.Stop() {
-			select {
-			case <-nextCheck.C:
-			default:
-			}
+	// Create a glob pattern so that we can purge old files
+	globPattern := globFromPattern(p)
+
+	// The names of the files are relative to the root of the glob
+	// pattern when they are purged. The glob may also match files that
+	// were not generated from the pattern (e.g. "{label}-*.log" for the
+	// labels of a Manager that share a prefix), which the parser rejects
+	var nameParser, slotParser *nameParser
+	rel, ok := fsName(globRoot(globPattern), filepath.Clean(p))
+	if ok {
+		nameParser = newNameParser(rel, clock.Now().Location())
+	}
+	if retainSlots > 0 {
+		if !ok {
+			return nil, errors.Errorf(`failed to convert pattern %s`, p)
+		}
+		slotParser, err = newSlotParser(rel, clock.Now().Location())
+		if err != nil {
+			return nil, errors.Wrap(err, `invalid option WithRetainSlots`)
 		}
 	}
 
-	// Create a glob pattern so that we can purge old files
-	globPattern := p
-	for _, re := range patternConversionRegexps {
-		globPattern = re.ReplaceAllString(globPattern, "*")
+	if passthrough == nil {
+		passthrough = passthroughFromEnv()
 	}
-	if !strings.HasSuffix(globPattern, "*") {
-		globPattern = globPattern + "*" // allow suffixes
+
+	if compress && compressor == nil {
+		compressor = defaultCompressor()
+	}
+	if opener != nil || fifo {
+		// Sinks that are not regular files cannot be read back
+		compressor = nil
+		archiver = nil
+	}
+
+	create.onError = errorHandler
+	if verifyDir && passthrough == nil && opener == nil && !fifo {
+		if err := verifyDirectory(fs, patternDir(p), create); err != nil {
+			return nil, errors.Wrap(err, `failed to verify directory`)
+		}
+	}
+
+	var breaker *circuitBreaker
+	if breakerThreshold > 0 {
+		breaker = &circuitBreaker{
+			threshold: breakerThreshold,
+			cooldown:  breakerCooldown,
+		}
+	}
+
+	var limiter *rateLimiter
+	if rateLimit > 0 {
+		limiter = newRateLimiter(rateLimit, rateBurst)
 	}
 
 	wctx, cancel := context.WithCancel(ctx)
 	f := &File{
-		backoff:       bo,
-		ctx:           wctx,
-		cancel:        cancel,
-		checkInterval: checkInterval,
-		clock:         clock,
-		globPattern:   globPattern,
-		maxFileSize:   maxFileSize,
-		maxInterval:   maxInterval,
-		nextCheck:     nextCheck,
-		pattern:       pattern,
-		rotationCount: rotationCount,
-		symlink:       symlink,
+		backoff:         bo,
+		breaker:         breaker,
+		bufferSize:      bufferSize,
+		ctx:             wctx,
+		cancel:          cancel,
+		checkInterval:   checkInterval,
+		clock:           clock,
+		dirSync:         dirSync,
+		errorHandler:    errorHandler,
+		fallback:        fallback,
+		fallbackRetry:   fallbackRetry,
+		fifo:            fifo,
+		globPattern:     globPattern,
+		filters:         filters,
+		footer:          footer,
+		frameChecksum:   frameChecksum,
+		framing:         framing,
+		header:          header,
+		idleTimeout:     idleTimeout,
+		maxAge:          maxAge,
+		maxFileSize:     maxFileSize,
+		maxRecordSize:   maxRecordSize,
+		maxInterval:     maxInterval,
+		mmapRegion:      mmapRegion,
+		preallocate:     preallocate,
+		quotaPolicy:     quotaPolicy,
+		rateLimiter:     limiter,
+		rateLimitPolicy: rateLimitPolicy,
+		recordAware:     recordAware,
+		recordDelimiter: recordDelimiter,
+		oversizePolicy:  recordSizePolicy,
+		opener:          opener,
+		openFlags:       openFlags,
+		opTimeout:       opTimeout,
+		passthrough:     passthrough,
+		pattern:         pattern,
+		rotationCount:   rotationCount,
+		slotQuota:       slotQuota,
+		symlink:         symlink,
+		syncRotation:    syncRotation,
+		archiveTimeout:  archiveTimeout,
+		purgeHook:       purgeHook,
+		minDiskFree:     minDiskFree,
+		maxTotalSize:    maxTotalSize,
+		archiver:        archiver,
+		archiveDir:      archiveDir,
+		compressHook:    compressHook,
+		compressor:      compressor,
+		rotateHook:      rotateHook,
+		maxUncompressed: maxUncompressed,
+		continuation:    continuation,
+		partialRetry:    partialRetry,
+		retainSlots:     retainSlots,
+		nameParser:      nameParser,
+		slotParser:      slotParser,
+		preopenLead:     preopenLead,
+		truncOnOpen:     truncOnOpen,
+		create:          create,
+		diskFullRetry:   diskFullRetry,
+		options:         append([]Option(nil), options...),
+		parentCtx:       ctx,
+		scheduler:       scheduler,
+		fs:              fs,
+		truncation:      truncationPolicy,
+		transformers:    transformers,
+		wrapper:         wrapper,
+	}
+	f.startMaintenance()
+	if compressor != nil {
+		f.compression = newWorkerPool(compressWorkers, f.handleError)
+	}
+	if archiver != nil {
+		f.unarchived = newArchiveSet()
+		f.archiving = newWorkerPool(1, f.handleError)
+		f.recoverArchives()
+	}
+	if scheduler != nil {
+		scheduler.register(f)
+	}
+	if mirrorDir != "" {
+		f.startMirror(mirrorDir)
 	}
 
 	return f, nil
 }
 
+// Clone creates a new File that writes to the files generated from the
+// given pattern, using the same context and options that f was created
+// with, so that related logs can share the clock, error handler,
+// Scheduler, retention settings, etc. The given options are applied on
+// top of the options of f.
+//
+// The symlink of f is not inherited, as two Files cannot maintain the
+// same symlink. Use WithSymlink to specify a symlink for the new File.
+func (f *File) Clone(pattern string, options ...Option) (*File, error) {
+	list := make([]Option, 0, len(f.options)+len(options))
+	for _, option := range f.options {
+		if option.Ident() == (identSymlink{}) {
+			continue
+		}
+		list = append(list, option)
+	}
+	list = append(list, options...)
+	return NewFile(f.parentCtx, pattern, list...)
+}
+
+// Close flushes and closes the current file, and waits for the pending
+// background tasks (e.g. closing the files that were rotated out, or
+// purging old files) to complete. It returns the error from closing the
+// current file, if any; failures of the background tasks are reported to
+// the handler specified by WithErrorHandler. Writing to the File after it
+// has been closed fails with ErrClosed.
 func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
 	f.cancel()
+	f.endSlot()
+	f.writeFooter("")
+	if f.idleTimer != nil {
+		f.idleTimer.Stop()
+	}
+	var err error
 	if f.file != nil {
-		finalizeWriter(f.file)
+		err = fileError(OpFinalize, f.filename, finalizeWriter(f.file))
+		f.file = nil
 	}
-	return nil
+
+	// wait for the pending maintenance tasks (e.g. finalizing the
+	// previous files) to complete
+	f.stopMaintenance()
+	if f.compression != nil {
+		// the maintenance tasks may have queued files for compression
+		f.compression.stop()
+	}
+	if f.archiving != nil {
+		// the files that have been compressed may have been queued too
+		f.archiving.stop()
+	}
+	if p := f.preopened; p != nil {
+		// the file opened ahead of time is not going to be written to
+		f.preopened = nil
+		if perr := f.discardPreopened(p); err == nil {
+			err = perr
+		}
+	}
+	f.stopMirror()
+	if f.scheduler != nil {
+		f.scheduler.unregister(f)
+	}
+	return err
 }
 
+// sizeExceeded must be called while holding the lock
 func (f *File) sizeExceeded() bool {
-	f.mu.Lock()
-	var checkSize bool
-	select {
-	// Don't check for sizes in every single Write() call
-	case <-f.nextCheck.C:
-		checkSize = true
-		f.nextCheck.Reset(f.checkInterval)
-	default:
+	if f.checkInterval <= 0 {
+		return false
+	}
+
+	if f.scheduler != nil {
+		// The size is checked periodically by the scheduler
+		exceeded := f.oversized
+		f.oversized = false
+		return exceeded
 	}
-	f.mu.Unlock()
 
-	if !checkSize {
+	// Don't check for sizes in every single Write() call. If the clock
+	// has gone backwards since the last check, we can't tell how much
+	// time has passed, so play it safe and check
+	now := f.clock.Now()
+	if elapsed := now.Sub(f.lastCheck); elapsed >= 0 && elapsed < f.checkInterval {
 		return false
 	}
+	f.lastCheck = now
+	return f.checkSize()
+}
 
-	f.mu.RLock()
-	if f.file == nil {
-		f.mu.RUnlock()
+// checkSize returns true if the current file needs to be rotated because
+// of its size (or because it has gone missing).
+// It must be called while holding the lock
+func (f *File) checkSize() bool {
+	// The size of a named pipe is meaningless
+	if f.file == nil || f.fifo {
 		return false
 	}
-	flushWriter(f.file)
+	_ = flushWriter(f.file)
 	maxFileSize := f.maxFileSize
-	// XXX DO NOT USE (*os.File).Stat() here. Always use os.Stat(filename)
-	// otherwise you will not be able to detect, for example, the file
-	// missing in the file system
-	fi, err := os.Stat(f.filename)
-	f.mu.RUnlock()
+	sizer, hasSize := unwrapWriter(f.file).(interface{ Size() int64 })
 
-	if err != nil {
-		// if we couldn't stat... well, it could be because of a gazillion reasons
-		// but one thing we can handle for sure is the file missing
-		if os.IsNotExist(err) {
-			return true // size hasn't exceeded, but...
+	var size int64
+	if f.opener != nil {
+		// Sinks created by a custom opener may not exist in the file
+		// system, so rely solely on the writer to report its size
+		if !hasSize {
+			return false
+		}
+		size = sizer.Size()
+	} else {
+		// XXX DO NOT USE (*os.File).Stat() here. Always stat the filename
+		// otherwise you will not be able to detect, for example, the file
+		// missing in the file system
+		var fi os.FileInfo
+		err := f.withTimeout(`stat`, f.filename, func() (err error) {
+			fi, err = f.fs.Stat(f.filename)
+			return err
+		}, nil)
+
+		if err != nil {
+			// if we couldn't stat... well, it could be because of a gazillion reasons
+			// but one thing we can handle for sure is the file missing
+			if os.IsNotExist(err) {
+				return true // size hasn't exceeded, but...
+			}
+			// Play it safe otherwise
+			return false
+		}
+
+		size = fi.Size()
+		// Some writers (e.g. the mmap-backed writer) preallocate space in
+		// the file, so the size reported by the file system does not
+		// reflect the amount of data that has been written
+		if hasSize {
+			size = sizer.Size()
 		}
-		// Play it safe otherwise
-		return false
+	}
+
+	if f.checkTruncation(size) {
+		return true
 	}
 
 	// Do we have a maximum size that we need to rotate by?
-	return maxFileSize >= 0 && fi.Size() >= maxFileSize
+	return maxFileSize > 0 && size >= maxFileSize
+}
+
+// uncompressedExceeded returns true if the amount of data written to the
+// current file exceeds the size given by WithMaxUncompressedSize. Unlike
+// the size on disk, it is known without flushing, so it is checked on
+// every write.
+// It must be called while holding the lock
+func (f *File) uncompressedExceeded() bool {
+	return f.maxUncompressed > 0 && f.filename != "" && f.fileBytes >= f.maxUncompressed
 }
 
 func (f *File) intervalExceeded() bool {
 	return !f.baseTime.Equal(truncate(f.clock.Now(), f.maxInterval))
 }
 
-func flushWriter(w io.Writer) {
+func flushWriter(w io.Writer) error {
 	if v, ok := w.(interface{ Flush() error }); ok {
-		_ = v.Flush()
+		if err := v.Flush(); err != nil {
+			return errors.Wrap(err, `failed to flush`)
+		}
 	}
 
 	if v, ok := w.(interface{ Sync() error }); ok {
-		_ = v.Sync()
+		if err := v.Sync(); err != nil {
+			return errors.Wrap(err, `failed to sync`)
+		}
 	}
+	return nil
 }
 
-func finalizeWriter(w io.Writer) {
-	flushWriter(w)
+func finalizeWriter(w io.Writer) error {
+	ferr := flushWriter(w)
 	if v, ok := w.(io.Closer); ok {
-		_ = v.Close()
+		if err := v.Close(); err != nil && ferr == nil {
+			ferr = errors.Wrap(err, `failed to close`)
+		}
 	}
+	return ferr
 }
 
-func (f *File) rotateFile(ctx context.Context, newFileName string) error {
+// finalizeAsync finalizes the given writer in the maintenance goroutine.
+// Close waits for all such writers to be finalized
+func (f *File) finalizeAsync(w io.Writer, filename string) {
+	f.mirrorFinalize(filename)
+	f.schedule(func() error {
+		return fileError(OpFinalize, filename, finalizeWriter(w))
+	})
+}
+
+// rotateFile must be called while holding the lock
+func (f *File) rotateFile(ctx context.Context, newFileName string, reason RotationReason) error {
 	var lastError error
 	// attempt to open new file. try for a bit
-	f.mu.RLock()
 	b := f.backoff.Start(ctx)
-	f.mu.RUnlock()
 
+	// When strict ordering is requested, the previous file must be
+	// completely finalized before we even attempt to create the new one.
+	// If the new file cannot be opened, the previous one is not written
+	// to again: the rotation is retried upon the next write instead
+	if f.syncRotation && !f.sealed {
+		f.writeFooter(newFileName)
+		f.mirrorFinalize(f.filename)
+		f.sealed = f.filename != ""
+		if f.file != nil {
+			err := finalizeWriter(f.file)
+			f.file = nil
+			if err != nil {
+				return fileError(OpFinalize, f.filename, err)
+			}
+		}
+	}
+
+	preopened := f.takePreopened(newFileName)
 	for backoff.Continue(b) {
-		newF, err := createFile(newFileName)
+		var newF io.Writer
+		var err error
+		if preopened != nil {
+			newF, preopened = preopened, nil
+		} else {
+			newF, err = f.openFileWithTimeout(newFileName, f.newFileFlag())
+		}
 		if err != nil {
 			lastError = err
 			continue
 		}
 
+		if f.dirSync {
+			// The file is not guaranteed to survive a crash until its
+			// directory entry has been persisted
+			if err := f.syncDir(filepath.Dir(newFileName)); err != nil {
+				_ = finalizeWriter(newF)
+				lastError = err
+				continue
+			}
+		}
+
+		if err := f.writeHeader(newF, newFileName); err != nil {
+			_ = finalizeWriter(newF)
+			lastError = err
+			continue
+		}
+
+		if err := f.writeContinuedFrom(newF, newFileName); err != nil {
+			_ = finalizeWriter(newF)
+			lastError = err
+			continue
+		}
+
 		// created new file. assign it to the cache, and flush the previous
-		// file. Closing the previous file is done asynchronously
-		f.mu.Lock()
+		// file. Closing the previous file is done asynchronously, so that
+		// the write that triggered the rotation does not have to wait
+		// for the previous file to be synced and closed
+		if !f.syncRotation {
+			f.writeFooter(newFileName)
+		}
 		if f.file != nil {
-			finalizeWriter(f.file)
+			f.finalizeAsync(f.file, f.filename)
 		}
+		f.sealFile(f.filename, newFileName, reason)
+		f.sealed = false
 		f.file = newF
 		f.filename = newFileName
-		f.mu.Unlock()
+		f.activeName.Store(newFileName)
+		f.clearPreopenMarker(newFileName)
+		f.fileBaseTime = f.baseTime
+		f.fileGeneration = f.generation
+		f.fileBytes = 0
+		f.fileRecords = 0
+		f.expectedSize = -1
+		f.stats.Rotations++
 
-		if err := f.makeSymlink(); err != nil {
-			return errors.Wrap(err, `failed to create symlink`)
-		}
-
-		if err := f.purgeOld(); err != nil {
-		}
+		f.schedule(func() error {
+			return fileError(OpSymlink, f.symlink, f.makeSymlink(newFileName))
+		})
+		now := f.clock.Now()
+		f.schedule(func() error {
+			_, err := f.purgeOld(now)
+			return err
+		})
 
 		return nil
 	}
 
-	return errors.Wrapf(lastError, `failed to create file %s`, newFileName)
+	if lastError == nil {
+		// No attempt was made, because the context is already done
+		lastError = ctx.Err()
+	}
+	return fileError(OpRotate, newFileName, lastError)
 }
 
-func (f *File) makeSymlink() error {
+// makeSymlink updates the symlink to point to the given filename.
+// It is run from the maintenance goroutine
+func (f *File) makeSymlink(filename string) error {
 	sym := f.symlink
 	if sym == "" {
 		return nil
 	}
 
-	lockFn := f.filename + `_lock`
-	fh, err := os.OpenFile(lockFn, os.O_CREATE|os.O_EXCL, 0644)
+	lockFn := filename + `_lock`
+	fh, err := f.fs.OpenFile(lockFn, os.O_CREATE|os.O_EXCL, 0644)
 	if err != nil {
 		return errors.Wrap(err, `failed to open lockfile`)
 	}
 	defer func() {
 		_ = fh.Close()
-		_ = os.Remove(lockFn)
+		_ = f.fs.Remove(lockFn)
 	}()
 
 	// Change how the link name is generated based on where the
 	// target location is. if the location is directly underneath
 	// the main filename's parent directory, then we create a
 	// symlink with a relative path
-	linkDst := f.filename
+	linkDst := filename
 	linkDir := filepath.Dir(f.symlink)
 	if strings.Contains(linkDst, linkDir) {
 		tmp, err := filepath.Rel(linkDir, linkDst)
@@ -267,168 +858,601 @@ func (f *File) makeSymlink() error {
 		linkDst = tmp
 	}
 
-	if _, err := os.Stat(linkDir); err != nil && os.IsNotExist(err) {
-		if err := os.MkdirAll(linkDir, 0755); err != nil {
-			return errors.Wrapf(err, `failed to create directory %s`, linkDir)
-		}
+	if err := mkdirAll(f.fs, linkDir, f.create); err != nil {
+		return err
 	}
 
-	linkFn := f.filename + `_symlink`
-	if err := os.Symlink(linkDst, linkFn); err != nil {
+	linkFn := filename + `_symlink`
+	if err := f.fs.Symlink(linkDst, linkFn); err != nil {
 		return errors.Wrap(err, `failed to create symlink`)
 	}
 
-	if err := os.Rename(linkFn, f.symlink); err != nil {
+	if err := f.withTimeout(`rename`, linkFn, func() error { return f.fs.Rename(linkFn, f.symlink) }, nil); err != nil {
+		_ = f.fs.Remove(linkFn)
 		return errors.Wrap(err, `failed to rename new symlink`)
 	}
+
+	if f.dirSync {
+		if err := f.syncDir(linkDir); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // Write satisfies the io.Writer interface.
 //
+// Each call to Write is treated as a single record: it is safe to call
+// Write from multiple goroutines, and the payload of each call is written
+// contiguously, without being interleaved with the payloads of other
+// calls. The file is checked for rotation only once per call, so the
+// payload is never split across two files.
+//
+// When buffering is enabled (see WithBufferSize), the buffer is flushed
+// before writing a payload that does not fit in it, so that a payload is
+// not split across multiple writes to the underlying file, unless it is
+// larger than the buffer.
 func (f *File) Write(p []byte) (int, error) {
-	w, err := f.getWriter()
-	if err != nil {
-		return 0, errors.Wrap(err, `failed to obtain file handle`)
-	}
+	n, err := f.write(f.ctx, [][]byte{p})
+	return int(n), err
+}
 
-	return w.Write(p)
+// WriteContext is the same as Write, but the given context is used
+// to bound the amount of time spent retrying to create a new file
+// upon rotation, as well as the time spent waiting for the rate
+// limit. By default, Write uses the context that was passed to
+// NewFile, which is usually long-lived.
+func (f *File) WriteContext(ctx context.Context, p []byte) (int, error) {
+	n, err := f.write(ctx, [][]byte{p})
+	return int(n), err
 }
 
-func (f *File) getWriter() (io.Writer, error) {
-	sizeExceeded := f.sizeExceeded()
-	intervalExceeded := f.intervalExceeded()
-	if sizeExceeded || intervalExceeded {
-		f.baseTime = truncate(f.clock.Now(), f.maxInterval)
-		fn := f.pattern.FormatString(f.baseTime)
-		if intervalExceeded {
-			f.generation = 0
-		} else {
-			if fn == f.filename { // We are still writing to the same "time slot"
-				f.generation++
-				fn = fmt.Sprintf("%s.%d", fn, f.generation)
+// WriteVec writes the contents of each element in bufs to the file,
+// in order. This is useful when a record is composed of several pieces
+// (e.g. header, body, newline), as it allows the caller to avoid
+// concatenating them before writing.
+//
+// The elements of bufs are treated as a single record, with the same
+// guarantees as Write: they are written contiguously, and are guaranteed
+// to end up in the same file. Where available (e.g. Linux), the data is
+// written using writev(2).
+func (f *File) WriteVec(bufs [][]byte) (int64, error) {
+	return f.write(f.ctx, bufs)
+}
+
+// WriteVecContext is the same as WriteVec, but uses the given context
+// in the same manner as WriteContext
+func (f *File) WriteVecContext(ctx context.Context, bufs [][]byte) (int64, error) {
+	return f.write(ctx, bufs)
+}
+
+func (f *File) write(ctx context.Context, bufs [][]byte) (int64, error) {
+	if len(f.filters) == 0 && len(f.transformers) == 0 && !f.framing && f.maxRecordSize <= 0 {
+		return f.writeRecordBufs(ctx, bufs)
+	}
+
+	// The transformers, size guard, and framing may change the length of
+	// the record, but the caller should only see the number of bytes that
+	// it passed in
+	var size int64
+	for _, buf := range bufs {
+		size += int64(len(buf))
+	}
+
+	if len(f.filters) > 0 || len(f.transformers) > 0 {
+		rec := joinBuffers(bufs)
+		if !f.accept(rec) {
+			f.mu.Lock()
+			f.stats.Filtered++
+			f.mu.Unlock()
+			return size, nil
+		}
+		bufs = [][]byte{f.transform(rec)}
+	}
+
+	if f.maxRecordSize > 0 {
+		var recSize int64
+		for _, buf := range bufs {
+			recSize += int64(len(buf))
+		}
+		if recSize > f.maxRecordSize {
+			if err := f.writeOversized(ctx, bufs, recSize); err != nil {
+				return 0, err
 			}
+			return size, nil
 		}
+	}
+
+	if err := f.writeFramed(ctx, bufs); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// writeFramed writes a single record, framing it if necessary
+func (f *File) writeFramed(ctx context.Context, bufs [][]byte) error {
+	if f.framing {
+		bufs = frameBuffers(bufs, f.frameChecksum)
+	}
+	_, err := f.writeRecordBufs(ctx, bufs)
+	return err
+}
+
+func (f *File) writeRecordBufs(ctx context.Context, bufs [][]byte) (int64, error) {
+	var size int
+	for _, buf := range bufs {
+		size += len(buf)
+	}
 
-		if err := f.rotateFile(f.ctx, fn); err != nil {
-			return nil, errors.Wrap(err, `failed to rotate file`)
+	if ok, err := f.throttle(ctx, size); !ok {
+		if err != nil {
+			return 0, err
 		}
+		f.mu.Lock()
+		f.stats.RateLimited++
+		f.mu.Unlock()
+		return int64(size), nil
 	}
-	return f.file, nil
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.fallback != nil {
+		return f.writeWithFallback(ctx, bufs, size)
+	}
+	return f.writePrimary(ctx, bufs, size)
 }
 
-// createFile creates a new file in the given path, creating parent directories
-// as necessary
-func createFile(filename string) (*os.File, error) {
-	// make sure the dir is existed, eg:
-	// ./foo/bar/baz/hello.log must make sure ./foo/bar/baz is existed
-	dirname := filepath.Dir(filename)
-	if _, err := os.Stat(dirname); err != nil {
-		if os.IsNotExist(err) {
-			if err := os.MkdirAll(dirname, 0755); err != nil {
-				return nil, errors.Wrapf(err, "failed to create directory %s", dirname)
-			}
+// writeLocked writes a single record to the primary file.
+// It must be called while holding the lock
+func (f *File) writeLocked(ctx context.Context, bufs [][]byte, size int) (int64, error) {
+	var written int64
+	if f.midRecord {
+		// The previous write ended in the middle of a record. The file
+		// must not be rotated until the record is complete, so write
+		// the remainder of the record to the current file
+		var head [][]byte
+		head, bufs = splitRecord(bufs, f.recordDelimiter)
+		w, err := f.currentWriter()
+		if err != nil {
+			return 0, err
 		}
+
+		n, err := f.writeRecord(w, head)
+		written += n
+		if err != nil || len(bufs) == 0 {
+			return written, err
+		}
+		size -= int(n)
 	}
 
-	// if we got here, then we need to create a file
-	fh, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	w, err := f.getWriter(ctx)
 	if err != nil {
-		return nil, errors.Errorf("failed to open file %s: %s", filename, err)
+		return written, errors.Wrap(err, `failed to obtain file handle`)
 	}
 
-	return fh, nil
+	if f.quotaExceeded(size) {
+		n, err := f.writeOverQuota(bufs, size)
+		return written + n, err
+	}
+
+	n, err := f.writeRecovering(ctx, w, bufs)
+	return written + n, err
 }
 
-func (f *File) purgeOld() error {
-	matches, err := filepath.Glob(f.globPattern)
-	if err != nil {
-		return errors.Wrap(err, `failed to apply glob pattern`)
-	}
+// writeRecord writes bufs to w, and updates the accounting information.
+// It must be called while holding the lock
+func (f *File) writeRecord(w io.Writer, bufs [][]byte) (int64, error) {
+	f.fileRecords++
+	f.stats.Records++
+	return f.writeBytes(w, bufs)
+}
 
-	stats := make(map[string]os.FileInfo)
-	// stat all the files once and cache
-	for _, path := range matches {
-		// Ignore temporary files
-		if strings.HasSuffix(path, "_lock") || strings.HasSuffix(path, "_symlink") {
-			continue
+// writeBytes writes bufs to w, and updates the accounting information
+// for the number of bytes that were actually written.
+// It must be called while holding the lock
+func (f *File) writeBytes(w io.Writer, bufs [][]byte) (int64, error) {
+	n, err := writeBuffers(w, bufs)
+	if err == nil {
+		f.mirrorWrite(f.filename, bufs)
+	}
+	f.slotBytes += n
+	f.fileBytes += n
+	if f.expectedSize >= 0 {
+		f.expectedSize += n
+	}
+	f.stats.Bytes += n
+	if f.recordAware && n > 0 {
+		if b, ok := lastByte(bufs); ok {
+			f.midRecord = b != f.recordDelimiter
 		}
+	}
+	return n, err
+}
+
+// throttle applies the rate limit specified by WithRateLimit. It returns
+// false if the write should not proceed, either because it should be
+// dropped, or because an error occurred while waiting
+func (f *File) throttle(ctx context.Context, n int) (bool, error) {
+	if f.rateLimiter == nil {
+		return true, nil
+	}
+
+	if f.rateLimitPolicy == RateLimitDrop {
+		return f.rateLimiter.allow(n), nil
+	}
 
-		fi, err := os.Lstat(path)
+	if err := f.rateLimiter.wait(ctx, n); err != nil {
+		return false, errors.Wrap(err, `failed to wait for rate limit`)
+	}
+	return true, nil
+}
+
+// writeBuffers writes bufs to w, keeping the data contiguous in the
+// underlying file whenever possible
+func writeBuffers(w io.Writer, bufs [][]byte) (int64, error) {
+	if v, ok := w.(*bufferedWriter); ok {
+		return v.writeBuffers(bufs)
+	}
+	return writeVec(w, bufs)
+}
+
+// writeVecGeneric writes each element of bufs to w, one at a time. This is
+// the fallback used when writev(2) cannot be used
+func writeVecGeneric(w io.Writer, bufs [][]byte) (int64, error) {
+	var written int64
+	for _, buf := range bufs {
+		n, err := w.Write(buf)
+		written += int64(n)
 		if err != nil {
-			continue
+			return written, err
 		}
+	}
+	return written, nil
+}
 
-		stats[path] = fi
+// getWriter must be called while holding the lock
+func (f *File) getWriter(ctx context.Context) (io.Writer, error) {
+	if f.passthrough != nil {
+		return f.passthrough, nil
 	}
 
-	var protected bool
-	if sym := f.symlink; sym != "" {
-		// If we have a symlink and that symlink points to one of the
-		// files that is a candidate to be deleted... do NOT delete it
-		dst, err := os.Readlink(sym)
-		if err == nil {
-			delete(stats, dst)
-			// remember that we have one extra file, so that we can
-			// use that in the calculation of rotationCount
-			protected = true
+	sizeExceeded := f.sizeExceeded() || f.uncompressedExceeded()
+	intervalExceeded := f.intervalExceeded()
+	if f.filename == "" || f.sealed || sizeExceeded || intervalExceeded {
+		reason := RotationSize
+		if intervalExceeded {
+			reason = RotationInterval
+		}
+		if err := f.rotate(ctx, reason); err != nil {
+			return nil, err
 		}
 	}
+	f.maybePreopen()
+
+	return f.currentWriter()
+}
+
+// currentWriter returns the writer for the current file, without
+// checking if the file needs to be rotated.
+// It must be called while holding the lock
+func (f *File) currentWriter() (io.Writer, error) {
+	if f.passthrough != nil {
+		return f.passthrough, nil
+	}
 
-	matches = make([]string, 0, len(stats))
-	for path := range stats {
-		matches = append(matches, path)
+	if f.file == nil {
+		if f.sealed {
+			return nil, fileError(OpOpen, f.filename, errors.New(`file has already been finalized`))
+		}
+		// The file handle has been released (e.g. because it was idle),
+		// but we are still supposed to be writing to the same file
+		w, err := f.openFileWithTimeout(f.filename, 0)
+		if err != nil {
+			return nil, err
+		}
+		f.file = w
 	}
 
-	// sort by name.
-	sort.Slice(matches, func(i, j int) bool {
-		return strings.Compare(matches[i], matches[j]) < 0
+	f.markActive()
+	return f.file, nil
+}
+
+// markActive records the fact that the file has been used, so that
+// the file handle is not released while it is in use.
+// This method must be called while holding the lock
+func (f *File) markActive() {
+	if f.idleTimeout <= 0 {
+		return
+	}
+
+	f.lastActive = time.Now()
+	if f.scheduler != nil {
+		// Idle files are released by the scheduler
+		return
+	}
+	if f.idleTimer == nil {
+		f.idleTimer = time.AfterFunc(f.idleTimeout, f.releaseIdle)
+	} else if !f.idleArmed {
+		f.idleTimer.Reset(f.idleTimeout)
+	}
+	f.idleArmed = true
+}
+
+// releaseIdle closes the underlying file handle if the file has not been
+// written to for the duration specified by WithIdleTimeout. The file is
+// transparently reopened upon the next write
+func (f *File) releaseIdle() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		f.idleArmed = false
+		return
+	}
+
+	// The file may have been written to since the timer was set.
+	// If so, check again later
+	if remaining := f.idleTimeout - time.Since(f.lastActive); remaining > 0 {
+		f.idleTimer.Reset(remaining)
+		return
+	}
+
+	f.idleArmed = false
+	f.releaseFile()
+}
+
+// releaseHandle flushes and closes the underlying file handle. The file
+// is transparently reopened upon the next write
+func (f *File) releaseHandle() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil || f.passthrough != nil {
+		return
+	}
+	f.releaseFile()
+}
+
+// releaseFile flushes and closes the underlying file handle, reporting
+// failures to the error handler. The file is transparently reopened upon
+// the next write.
+// It must be called while holding the lock
+func (f *File) releaseFile() {
+	if err := finalizeWriter(f.file); err != nil {
+		f.handleError(fileError(OpFinalize, f.filename, err))
+	}
+	f.file = nil
+}
+
+// withTimeout runs fn, but gives up waiting for it to complete after
+// the duration specified by WithOperationTimeout. In that case fn is left
+// running in the background, and if it eventually succeeds, abandon
+// (if non-nil) is called to release any resources that it acquired.
+func (f *File) withTimeout(op, path string, fn func() error, abandon func()) error {
+	if f.opTimeout <= 0 {
+		return fn()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	t := time.NewTimer(f.opTimeout)
+	defer t.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-t.C:
+		if abandon != nil {
+			go func() {
+				if err := <-done; err == nil {
+					abandon()
+				}
+			}()
+		}
+		return &TimeoutError{Op: op, Path: path, Duration: f.opTimeout}
+	}
+}
+
+func (f *File) openFileWithTimeout(filename string, flag int) (io.Writer, error) {
+	var w io.Writer
+	err := f.withTimeout(`open`, filename, func() (err error) {
+		w, err = f.openFile(filename, flag)
+		return err
+	}, func() {
+		_ = finalizeWriter(w)
 	})
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
 
-	maxAge := f.maxAge
-	toPurge := make([]string, 0, len(matches))
-	candidates := make([]string, 0, len(matches))
+// newFileFlag returns the additional flag used when switching to a file,
+// as opposed to reopening the current file. Only the former truncates the
+// file when WithTruncateOnOpen is enabled, so that data written by this
+// File is never discarded
+func (f *File) newFileFlag() int {
+	if f.truncOnOpen {
+		return os.O_TRUNC
+	}
+	return 0
+}
 
-	cutoff := f.clock.Now().Add(-1 * maxAge)
-	for _, path := range matches {
+// openFile opens the file that we write to, applying buffering
+// if necessary. flag is combined with the flags given by WithOpenFlags
+func (f *File) openFile(filename string, flag int) (io.Writer, error) {
+	w, err := f.openRawFile(filename, flag|f.openFlags)
+	if err != nil {
+		return nil, err
+	}
 
-		fi, ok := stats[path]
-		if !ok {
-			continue
+	if f.bufferSize > 0 {
+		w = newBufferedWriter(w, f.bufferSize)
+	}
+
+	if f.wrapper != nil {
+		w = &wrappedWriter{
+			Writer: f.wrapper(w, filename),
+			dst:    w,
 		}
+	}
+	return w, nil
+}
 
-		if maxAge > 0 && fi.ModTime().After(cutoff) {
-			toPurge = append(toPurge, path)
-			continue
+func (f *File) openRawFile(filename string, flag int) (io.Writer, error) {
+	if f.opener != nil {
+		w, err := f.opener(filename)
+		if err != nil {
+			return nil, fileError(OpOpen, filename, err)
 		}
+		return w, nil
+	}
 
-		if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
-			continue
+	osfs := isOSFileSystem(f.fs)
+	if f.fifo {
+		if !osfs {
+			return nil, errors.New(`named pipes require the default file system`)
+		}
+		return openFIFO(filename, f.create)
+	}
+
+	if f.mmapRegion > 0 && osfs {
+		return openMmapFile(filename, f.mmapRegion, flag, f.create)
+	}
+
+	fh, err := createFile(f.fs, filename, os.O_APPEND|os.O_WRONLY|flag, f.create)
+	if err != nil {
+		return nil, err
+	}
+
+	if osfh, ok := fh.(*os.File); ok && f.preallocate > 0 {
+		// Only preallocate space for newly created files. Preallocation
+		// is merely an optimization, so errors are ignored
+		if fi, err := osfh.Stat(); err == nil && fi.Size() == 0 {
+			_ = preallocateFile(osfh, f.preallocate)
 		}
+	}
+	return fh, nil
+}
 
-		candidates = append(candidates, path)
+// syncDir persists the entries of the given directory, if the file system
+// supports it
+func (f *File) syncDir(dir string) error {
+	s, ok := f.fs.(interface {
+		SyncDir(name string) error
+	})
+	if !ok {
+		return nil
 	}
+	return s.SyncDir(dir)
+}
+
+// Purge applies the retention policy (see WithRotationCount, WithMaxAge,
+// and WithRetainSlots) immediately, instead of waiting for the next
+// rotation, and returns the names of the files that were removed (or
+// moved to the directory specified by WithArchiveDir). If files cannot be
+// removed, the first error is returned after attempting to remove the
+// others.
+func (f *File) Purge() ([]string, error) {
+	return f.purgeOld(f.clock.Now())
+}
 
-	if c := f.rotationCount; c > 0 {
-		// if we protected a file from being deleted, we need to add 1
-		// to the total count of files
-		lc := len(candidates)
-		if protected {
-			c--
+// purgeOld removes (or archives) files according to the retention policy,
+// reports the result to the function specified by WithPurgeHook, and
+// returns the names of the removed files, and the first error. The
+// current file is never removed.
+// It is run from the maintenance goroutine, or by Purge
+func (f *File) purgeOld(now time.Time) ([]string, error) {
+	removed, errs := f.purgeFiles(now)
+	if hook := f.purgeHook; hook != nil && (len(removed) > 0 || len(errs) > 0) {
+		hook(removed, errs)
+	}
+	return removed, firstError(errs)
+}
+
+// purgeFiles removes (or archives) files according to the retention
+// policy, and returns the names of the removed files, and the errors for
+// the files that could not be removed
+func (f *File) purgeFiles(now time.Time) ([]string, []error) {
+	root := globRoot(f.globPattern)
+	pattern, ok := fsName(root, f.globPattern)
+	if !ok {
+		return nil, []error{fileError(OpPurge, f.globPattern, errors.New(`invalid glob pattern`))}
+	}
+
+	var r retention
+	r.count = f.rotationCount
+	r.maxAge = f.maxAge
+	r.slots = f.retainSlots
+	r.maxTotalSize = f.maxTotalSize
+	r.lowDiskSpace = f.lowDiskSpace(root)
+	r.parser = f.slotParser
+	r.names = f.nameParser
+	if f.compressor != nil {
+		r.suffix = f.compressor.Suffix()
+	}
+	if sym := f.symlink; sym != "" {
+		// If we have a symlink and that symlink points to one of the
+		// files that is a candidate to be deleted... do NOT delete it
+		if dst, err := f.fs.Readlink(sym); err == nil {
+			if !filepath.IsAbs(dst) {
+				// makeSymlink creates links relative to their directory
+				dst = filepath.Join(filepath.Dir(sym), dst)
+			}
+			r.hasProtected = true
+			if name, ok := fsName(root, dst); ok {
+				r.protected = name
+			}
 		}
-		if lc > c {
-			toPurge = append(toPurge, candidates[:lc-c]...)
+	}
+	if current, _ := f.activeName.Load().(string); current != "" {
+		if name, ok := fsName(root, current); ok {
+			r.current = name
+		}
+	}
+	if overflow, _ := f.activeOverflow.Load().(string); overflow != "" {
+		if name, ok := fsName(root, overflow); ok {
+			r.overflow = name
 		}
 	}
 
-	if len(toPurge) > 0 {
-		// Finally, start removing the files
-		go func(files []string) {
-			for _, file := range files {
-				_ = os.Remove(file)
+	if f.unarchived != nil {
+		// Files are only purged once they have been archived
+		for _, p := range f.unarchived.list() {
+			if name, ok := fsName(root, p); ok {
+				if r.pending == nil {
+					r.pending = make(map[string]struct{})
+				}
+				r.pending[name] = struct{}{}
 			}
-		}(toPurge)
+		}
 	}
 
-	return nil
+	var fsys RemoveFS = &fileSystemFS{fs: f.fs, root: root}
+	if f.archiveDir != "" {
+		fsys = &archiveFS{
+			fileSystemFS: fsys.(*fileSystemFS),
+			dir:          filepath.Clean(f.archiveDir),
+			create:       f.create,
+		}
+	}
+	names, errs := r.purge(fsys, pattern, now)
+	for i, err := range errs {
+		if fe, ok := err.(*FileError); ok {
+			// report the path instead of the name relative to the root
+			errs[i] = fileError(fe.Op, filepath.Join(root, filepath.FromSlash(fe.Path)), fe.Err)
+		}
+	}
+	removed := make([]string, len(names))
+	for i, name := range names {
+		removed[i] = filepath.Join(root, filepath.FromSlash(name))
+	}
+	return removed, errs
 }
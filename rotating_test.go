@@ -1,21 +1,31 @@
 package rotating_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/lestrrat-go/backoff"
 	"github.com/lestrrat-go/rotating"
+	"github.com/lestrrat-go/rotating/rotatingtest"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
 type fakeClock struct {
-	t time.Time
+	mu sync.Mutex
+	t  time.Time
 }
 
 func NewFakeClock(t time.Time) *fakeClock {
@@ -23,14 +33,20 @@ func NewFakeClock(t time.Time) *fakeClock {
 }
 
 func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.t
 }
 
 func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.t = c.t.Add(d)
 }
 
 func (c *fakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.t = t
 }
 
@@ -66,6 +82,12 @@ func TestMaxInterval(t *testing.T) {
 	assertSymlink := func(t *testing.T, expected string) bool {
 		t.Helper()
 
+		// The symlink is updated asynchronously
+		assert.Eventually(t, func() bool {
+			sym, err := os.Readlink(linkName)
+			return err == nil && sym == expected
+		}, time.Second, 10*time.Millisecond)
+
 		sym, err := os.Readlink(linkName)
 		if !assert.NoError(t, err, `os.Readlink should succeed`) {
 			return false
@@ -148,7 +170,7 @@ func TestMaxFileSize(t *testing.T) {
 	}
 
 	fmt.Fprintf(f, "0123456789\n")
-	time.Sleep(200 * time.Millisecond)
+	clock.Advance(200 * time.Millisecond)
 	fmt.Fprintf(f, "0123456789\n")
 	entries, err := os.ReadDir(dir)
 	if !assert.NoError(t, err, `os.ReadDir should succeed`) {
@@ -183,11 +205,12 @@ func TestRotationCount(t *testing.T) {
 
 	for i := 0; i < 20; i++ {
 		fmt.Fprintf(f, "0123456789\n")
-		time.Sleep(150*time.Millisecond)
+		clock.Advance(150 * time.Millisecond)
 		if i == 9 {
 			clock.Advance(6*time.Second)
 		}
 	}
+	f.Close()
 
 	
 	entries, err := os.ReadDir(dir)
@@ -203,3 +226,4328 @@ func TestRotationCount(t *testing.T) {
 		t.Logf("found file(%d): %s", i, ent.Name())
 	}
 }
+
+func TestWriteVec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-WriteVec")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	bufs := [][]byte{[]byte("header "), []byte("Hello, World"), nil, []byte("\n")}
+	n, err := f.WriteVec(bufs)
+	if !assert.NoError(t, err, `f.WriteVec should succeed`) {
+		return
+	}
+	if !assert.Equal(t, int64(20), n, `number of bytes written should match`) {
+		return
+	}
+	f.Close()
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101-000000.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "header Hello, World\n", string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestMmap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Mmap")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithMmap(1),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	// Write enough data to span multiple mapped regions
+	var expected []byte
+	line := []byte("0123456789abcdefghijklmnopqrstuvwxyz\n")
+	for i := 0; i < 1000; i++ {
+		expected = append(expected, line...)
+		if _, err := f.Write(line); !assert.NoError(t, err, `f.Write should succeed`) {
+			return
+		}
+	}
+	f.Close()
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101-000000.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, string(expected), string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestPreallocate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Preallocate")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithPreallocate(1024*1024),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+	f.Close()
+
+	// Preallocation should not change the apparent size of the file
+	fi, err := os.Stat(filepath.Join(dir, "20210101-000000.log"))
+	if !assert.NoError(t, err, `os.Stat should succeed`) {
+		return
+	}
+	if !assert.Equal(t, int64(len(msg)), fi.Size(), `file size should match`) {
+		return
+	}
+
+	// ...but the space should have been allocated
+	if allocated, ok := allocatedSize(fi); ok {
+		if !assert.GreaterOrEqual(t, allocated, int64(1024*1024), `allocated size should include the preallocated space`) {
+			return
+		}
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-IdleTimeout")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithIdleTimeout(50*time.Millisecond),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+	// let the file handle be released, and write again
+	time.Sleep(150 * time.Millisecond)
+	fmt.Fprintf(f, msg)
+	f.Close()
+
+	entries, err := os.ReadDir(dir)
+	if !assert.NoError(t, err, `os.ReadDir should succeed`) {
+		return
+	}
+	if !assert.Len(t, entries, 1, "should be 1 entry in directory") {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101-000000.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, msg+msg, string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-RateLimit")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithRateLimit(1, 20),
+		rotating.WithRateLimitPolicy(rotating.RateLimitDrop),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "0123456789\n"
+	for i := 0; i < 3; i++ {
+		n, err := f.Write([]byte(msg))
+		if !assert.NoError(t, err, `f.Write should succeed`) {
+			return
+		}
+		if !assert.Equal(t, len(msg), n, `f.Write should report the full length`) {
+			return
+		}
+	}
+	f.Close()
+
+	// Only the first write fits in the burst
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101-000000.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, msg, string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestSlotQuota(t *testing.T) {
+	const msg = "0123456789\n"
+	testcases := []struct {
+		Name     string
+		Policy   rotating.QuotaPolicy
+		Expected map[string]string
+	}{
+		{
+			Name:   "Drop",
+			Policy: rotating.QuotaDrop,
+			Expected: map[string]string{
+				"20210101-000000.log": msg + "-- 2 records suppressed --\n",
+			},
+		},
+		{
+			Name:   "Overflow",
+			Policy: rotating.QuotaOverflow,
+			Expected: map[string]string{
+				"20210101-000000.log":          msg,
+				"20210101-000000.log.overflow": msg + msg,
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "rotating_test-SlotQuota")
+			if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+				return
+			}
+			defer os.RemoveAll(dir)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+			f, err := rotating.NewFile(
+				ctx,
+				filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+				rotating.WithClock(clock),
+				rotating.WithSlotQuota(int64(len(msg)), tc.Policy),
+			)
+			if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+				return
+			}
+
+			for i := 0; i < 3; i++ {
+				fmt.Fprintf(f, msg)
+			}
+			f.Close()
+
+			entries, err := os.ReadDir(dir)
+			if !assert.NoError(t, err, `os.ReadDir should succeed`) {
+				return
+			}
+			if !assert.Len(t, entries, len(tc.Expected), `number of files should match`) {
+				return
+			}
+
+			for name, expected := range tc.Expected {
+				buf, err := ioutil.ReadFile(filepath.Join(dir, name))
+				if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+					return
+				}
+				if !assert.Equal(t, expected, string(buf), `contents of %s should match`, name) {
+					return
+				}
+			}
+		})
+	}
+}
+
+func TestWriteContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-WriteContext")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithRateLimit(1, 11),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	const msg = "0123456789\n"
+	if _, err := f.WriteContext(ctx, []byte(msg)); !assert.NoError(t, err, `f.WriteContext should succeed`) {
+		return
+	}
+
+	// The next write would have to wait for ~11 seconds
+	wctx, wcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer wcancel()
+
+	start := time.Now()
+	_, err = f.WriteContext(wctx, []byte(msg))
+	if !assert.Error(t, err, `f.WriteContext should fail`) {
+		return
+	}
+	if !assert.True(t, time.Since(start) < 5*time.Second, `f.WriteContext should return promptly`) {
+		return
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ErrorHandler")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// The symlink cannot be created, because its parent is a regular file
+	notDir := filepath.Join(dir, "not-a-directory")
+	if !assert.NoError(t, ioutil.WriteFile(notDir, nil, 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	errCh := make(chan error, 1)
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithSymlink(filepath.Join(notDir, "current.log")),
+		rotating.WithErrorHandler(func(err error) {
+			select {
+			case errCh <- err:
+			default:
+			}
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	// The write itself should succeed
+	_, err = f.Write([]byte("Hello, World\n"))
+	if !assert.NoError(t, err, `f.Write should succeed`) {
+		return
+	}
+	f.Close()
+
+	select {
+	case err := <-errCh:
+		t.Logf("received error: %s", err)
+	default:
+		t.Errorf(`error handler should have been called`)
+	}
+}
+
+func TestBuffered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Buffered")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithBufferSize(1024),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+	if !assert.Equal(t, len(msg), f.Buffered(), `f.Buffered should match`) {
+		return
+	}
+
+	fn := filepath.Join(dir, "20210101-000000.log")
+	buf, err := ioutil.ReadFile(fn)
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Empty(t, buf, `file should be empty before flush`) {
+		return
+	}
+
+	if !assert.NoError(t, f.Flush(), `f.Flush should succeed`) {
+		return
+	}
+	if !assert.Equal(t, 0, f.Buffered(), `f.Buffered should be 0 after flush`) {
+		return
+	}
+
+	buf, err = ioutil.ReadFile(fn)
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, msg, string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestRecordDelimiter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-RecordDelimiter")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithRecordDelimiter('\n'),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	fmt.Fprintf(f, "Hello, ")
+	clock.Advance(6 * time.Second)
+	// The first record must be completed in the first file, even
+	// though the interval has been exceeded
+	fmt.Fprintf(f, "World\nfoo ")
+	fmt.Fprintf(f, "bar\n")
+	f.Close()
+
+	expected := map[string]string{
+		"20210101-000000.log": "Hello, World\n",
+		"20210101-000005.log": "foo bar\n",
+	}
+	for name, content := range expected {
+		buf, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(buf), `contents of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ConcurrentWrites")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(rotating.UTC()),
+		rotating.WithBufferSize(64),
+		rotating.WithMaxFileSize(1024),
+		rotating.WithCheckInterval(time.Millisecond),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				// records of varying sizes, some of which are larger
+				// than the buffer
+				body := strings.Repeat(string(rune('a'+g)), (i*7)%100)
+				fmt.Fprintf(f, "%d:%s\n", len(body), body)
+			}
+		}(g)
+	}
+	wg.Wait()
+	f.Close()
+
+	entries, err := os.ReadDir(dir)
+	if !assert.NoError(t, err, `os.ReadDir should succeed`) {
+		return
+	}
+
+	var count int
+	for _, ent := range entries {
+		buf, err := ioutil.ReadFile(filepath.Join(dir, ent.Name()))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+
+		for _, line := range strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n") {
+			var size int
+			var body string
+			fmt.Sscanf(line, "%d:%s", &size, &body)
+			if !assert.Len(t, body, size, `record should not be interleaved (%q)`, line) {
+				return
+			}
+			if size > 0 && !assert.Equal(t, strings.Repeat(body[:1], size), body, `record should not be interleaved`) {
+				return
+			}
+			count++
+		}
+	}
+	if !assert.Equal(t, 800, count, `number of records should match`) {
+		return
+	}
+}
+
+func TestFileHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-FileHeader")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithFileHeader(func(filename string, t time.Time) []byte {
+			return []byte(fmt.Sprintf("# %s %s\n", filepath.Base(filename), t.Format(time.RFC3339)))
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+	fmt.Fprintf(f, msg)
+	clock.Advance(6 * time.Second)
+	fmt.Fprintf(f, msg)
+	f.Close()
+
+	expected := map[string]string{
+		"20210101-000000.log": "# 20210101-000000.log 2021-01-01T00:00:00Z\n" + msg + msg,
+		"20210101-000005.log": "# 20210101-000005.log 2021-01-01T00:00:05Z\n" + msg,
+	}
+	for name, content := range expected {
+		buf, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(buf), `contents of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func TestFileFooter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-FileFooter")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithFileFooter(func(info rotating.FooterInfo) []byte {
+			next := "none"
+			if info.Next != "" {
+				next = filepath.Base(info.Next)
+			}
+			return []byte(fmt.Sprintf("# next=%s records=%d bytes=%d\n", next, info.Records, info.Bytes))
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+	fmt.Fprintf(f, msg)
+	clock.Advance(6 * time.Second)
+	fmt.Fprintf(f, msg)
+	f.Close()
+
+	expected := map[string]string{
+		"20210101-000000.log": msg + msg + "# next=20210101-000005.log records=2 bytes=26\n",
+		"20210101-000005.log": msg + "# next=none records=1 bytes=13\n",
+	}
+	for name, content := range expected {
+		buf, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(buf), `contents of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func TestTransformer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Transformer")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithTransformer(func(b []byte) []byte {
+			return bytes.Replace(b, []byte("secret"), []byte("******"), -1)
+		}),
+		rotating.WithTransformer(func(b []byte) []byte {
+			return append([]byte("[app] "), b...)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "password=secret\n"
+	n, err := f.Write([]byte(msg))
+	if !assert.NoError(t, err, `f.Write should succeed`) {
+		return
+	}
+	if !assert.Equal(t, len(msg), n, `f.Write should report the length of the original record`) {
+		return
+	}
+	if _, err := f.WriteVec([][]byte{[]byte("password="), []byte("secret"), []byte("\n")}); !assert.NoError(t, err, `f.WriteVec should succeed`) {
+		return
+	}
+	f.Close()
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101-000000.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "[app] password=******\n[app] password=******\n", string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Filter")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithFilter(func(b []byte) bool {
+			return !bytes.Contains(b, []byte("/healthz"))
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	lines := []string{
+		"GET /index.html\n",
+		"GET /healthz\n",
+		"GET /about.html\n",
+		"GET /healthz\n",
+	}
+	for _, line := range lines {
+		n, err := f.Write([]byte(line))
+		if !assert.NoError(t, err, `f.Write should succeed`) {
+			return
+		}
+		if !assert.Equal(t, len(line), n, `f.Write should report the length of the record`) {
+			return
+		}
+	}
+
+	stats := f.Stats()
+	if !assert.Equal(t, int64(2), stats.Records, `stats.Records should match`) {
+		return
+	}
+	if !assert.Equal(t, int64(2), stats.Filtered, `stats.Filtered should match`) {
+		return
+	}
+	f.Close()
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101-000000.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "GET /index.html\nGET /about.html\n", string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestFraming(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Framing")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pattern := filepath.Join(dir, "%Y%m%d-%H%M%S.log")
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		pattern,
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithFraming(true),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	records := []string{"first\nline", "", "second\x00record", "third"}
+	f.Write([]byte(records[0]))
+	f.Write([]byte(records[1]))
+	clock.Advance(6 * time.Second)
+	f.WriteVec([][]byte{[]byte("second"), []byte("\x00record")})
+
+	r := rotating.NewFrameReader(pattern)
+	defer r.Close()
+
+	for _, expected := range records[:3] {
+		payload, err := r.Next()
+		if !assert.NoError(t, err, `r.Next should succeed`) {
+			return
+		}
+		if !assert.Equal(t, expected, string(payload), `payload should match`) {
+			return
+		}
+	}
+
+	_, err = r.Next()
+	if !assert.Equal(t, io.EOF, err, `r.Next should return io.EOF`) {
+		return
+	}
+
+	filename, offset := r.Position()
+	if !assert.Equal(t, filepath.Join(dir, "20210101-000005.log"), filename, `filename should match`) {
+		return
+	}
+
+	// Frames written after reaching the end should be picked up
+	clock.Advance(5 * time.Second)
+	f.Write([]byte(records[3]))
+
+	payload, err := r.Next()
+	if !assert.NoError(t, err, `r.Next should succeed`) {
+		return
+	}
+	if !assert.Equal(t, records[3], string(payload), `payload should match`) {
+		return
+	}
+
+	// A new reader can resume from a previous position
+	r2 := rotating.NewFrameReader(pattern)
+	defer r2.Close()
+	if !assert.NoError(t, r2.Seek(filename, offset), `r2.Seek should succeed`) {
+		return
+	}
+	payload, err = r2.Next()
+	if !assert.NoError(t, err, `r2.Next should succeed`) {
+		return
+	}
+	if !assert.Equal(t, records[3], string(payload), `payload should match`) {
+		return
+	}
+}
+
+func TestFrameChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-FrameChecksum")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pattern := filepath.Join(dir, "%Y%m%d-%H%M%S.log")
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		pattern,
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithFraming(true),
+		rotating.WithFrameChecksum(true),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	f.Write([]byte("first"))
+	f.Write([]byte("second"))
+	f.Write([]byte("third"))
+	clock.Advance(6 * time.Second)
+	f.Write([]byte("fourth"))
+	f.Close()
+
+	// Corrupt the payload of the second frame, and leave a truncated
+	// frame at the end of the first file
+	fn := filepath.Join(dir, "20210101-000000.log")
+	buf, err := ioutil.ReadFile(fn)
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	buf[8+len("first")+8] = 'S'
+	buf = append(buf, 0x80, 0x00, 0x00, 0x10, 0x01)
+	if !assert.NoError(t, ioutil.WriteFile(fn, buf, 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	r := rotating.NewFrameReader(pattern)
+	defer r.Close()
+
+	var payloads []string
+	for {
+		payload, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err, `r.Next should succeed`) {
+			return
+		}
+		payloads = append(payloads, string(payload))
+	}
+
+	if !assert.Equal(t, []string{"first", "third", "fourth"}, payloads, `payloads should match`) {
+		return
+	}
+	if !assert.Equal(t, int64(2), r.Unrecoverable(), `r.Unrecoverable should match`) {
+		return
+	}
+}
+
+func TestTimestampWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-TimestampWriter")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	l := log.New(rotating.NewTimestampWriter(f, time.RFC3339), "", 0)
+	l.Printf("Hello, World")
+	clock.Advance(time.Second)
+	rotating.NewTimestampWriter(f, rotating.TimestampUnix).Write([]byte("Hello, Epoch\n"))
+	f.Close()
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101-000000.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "2021-01-01T00:00:00Z Hello, World\n1609459201 Hello, Epoch\n", string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestTruncationPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-TruncationPolicy")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var mu sync.Mutex
+	var errs []error
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithCheckInterval(time.Second),
+		rotating.WithTruncationPolicy(rotating.TruncationRotate),
+		rotating.WithErrorHandler(func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+	clock.Advance(time.Second)
+	fmt.Fprintf(f, msg)
+
+	// Another process truncates the file
+	if !assert.NoError(t, os.Truncate(filepath.Join(dir, "20210101-000000.log"), 0), `os.Truncate should succeed`) {
+		return
+	}
+
+	clock.Advance(time.Second)
+	fmt.Fprintf(f, msg)
+	f.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Len(t, errs, 1, `there should be 1 error`) {
+		return
+	}
+	var terr *rotating.TruncationError
+	if !assert.True(t, errors.As(errs[0], &terr), `error should be a *rotating.TruncationError`) {
+		return
+	}
+	if !assert.Equal(t, int64(2*len(msg)), terr.Expected, `terr.Expected should match`) {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101-000000.log.1"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, msg, string(buf), `contents of the new file should match`) {
+		return
+	}
+}
+
+func TestMaxRecordSize(t *testing.T) {
+	const record = "0123456789abcdef\n"
+	testcases := []struct {
+		Name     string
+		Policy   rotating.RecordSizePolicy
+		Error    bool
+		Expected string
+	}{
+		{
+			Name:     "reject",
+			Policy:   rotating.RecordReject,
+			Error:    true,
+			Expected: "short\n",
+		},
+		{
+			Name:     "truncate",
+			Policy:   rotating.RecordTruncate,
+			Expected: "short\n01234567[truncated]\n",
+		},
+		{
+			Name:     "split",
+			Policy:   rotating.RecordSplit,
+			Expected: "short\n0123456789abcdef\n",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "rotating_test-MaxRecordSize")
+			if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+				return
+			}
+			defer os.RemoveAll(dir)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+			f, err := rotating.NewFile(
+				ctx,
+				filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+				rotating.WithClock(clock),
+				rotating.WithMaxRecordSize(8, tc.Policy),
+			)
+			if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+				return
+			}
+
+			if _, err := f.Write([]byte("short\n")); !assert.NoError(t, err, `f.Write should succeed`) {
+				return
+			}
+
+			n, err := f.Write([]byte(record))
+			if tc.Error {
+				var rerr *rotating.RecordSizeError
+				if !assert.True(t, errors.As(err, &rerr), `error should be a *rotating.RecordSizeError`) {
+					return
+				}
+			} else {
+				if !assert.NoError(t, err, `f.Write should succeed`) {
+					return
+				}
+				if !assert.Equal(t, len(record), n, `f.Write should report the length of the record`) {
+					return
+				}
+			}
+
+			if !assert.Equal(t, int64(1), f.Stats().Oversized, `stats.Oversized should match`) {
+				return
+			}
+			f.Close()
+
+			buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101-000000.log"))
+			if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+				return
+			}
+			if !assert.Equal(t, tc.Expected, string(buf), `contents should match`) {
+				return
+			}
+		})
+	}
+}
+
+func TestMirror(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Mirror")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	t.Run("mirror", func(t *testing.T) {
+		primary := filepath.Join(dir, "primary")
+		secondary := filepath.Join(dir, "secondary")
+		clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+		f, err := rotating.NewFile(
+			ctx,
+			filepath.Join(primary, "%Y%m%d-%H%M%S.log"),
+			rotating.WithClock(clock),
+			rotating.WithMaxInterval(5*time.Second),
+			rotating.WithMirror(secondary),
+		)
+		if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+			return
+		}
+
+		const msg = "Hello, World\n"
+		fmt.Fprintf(f, msg)
+		fmt.Fprintf(f, msg)
+		clock.Advance(6 * time.Second)
+		fmt.Fprintf(f, msg)
+		f.Close()
+
+		for _, name := range []string{"20210101-000000.log", "20210101-000005.log"} {
+			expected, err := ioutil.ReadFile(filepath.Join(primary, name))
+			if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+				return
+			}
+			buf, err := ioutil.ReadFile(filepath.Join(secondary, name))
+			if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+				return
+			}
+			if !assert.Equal(t, string(expected), string(buf), `contents of %s should match`, name) {
+				return
+			}
+		}
+	})
+	t.Run("failing mirror", func(t *testing.T) {
+		primary := filepath.Join(dir, "failing")
+		// A regular file can not be used as the mirror directory
+		secondary := filepath.Join(dir, "not-a-directory")
+		if !assert.NoError(t, ioutil.WriteFile(secondary, nil, 0644), `ioutil.WriteFile should succeed`) {
+			return
+		}
+
+		var mu sync.Mutex
+		var errs []error
+		clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+		f, err := rotating.NewFile(
+			ctx,
+			filepath.Join(primary, "%Y%m%d-%H%M%S.log"),
+			rotating.WithClock(clock),
+			rotating.WithMirror(secondary),
+			rotating.WithErrorHandler(func(err error) {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}),
+		)
+		if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+			return
+		}
+
+		const msg = "Hello, World\n"
+		if _, err := fmt.Fprintf(f, msg); !assert.NoError(t, err, `writing to the primary should succeed`) {
+			return
+		}
+		f.Close()
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !assert.NotEmpty(t, errs, `errors should be reported to the error handler`) {
+			return
+		}
+
+		buf, err := ioutil.ReadFile(filepath.Join(primary, "20210101-000000.log"))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, msg, string(buf), `contents should match`) {
+			return
+		}
+	})
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New(`failed to write`)
+}
+
+func TestMultiWriter(t *testing.T) {
+	var errs []error
+	var buf1, buf2 bytes.Buffer
+	w := rotating.MultiWriter(func(err error) {
+		errs = append(errs, err)
+	}, &buf1, failingWriter{}, &buf2)
+
+	const msg = "Hello, World\n"
+	n, err := w.Write([]byte(msg))
+	if !assert.NoError(t, err, `w.Write should succeed`) {
+		return
+	}
+	if !assert.Equal(t, len(msg), n, `w.Write should report the length of the data`) {
+		return
+	}
+	if !assert.Len(t, errs, 1, `there should be 1 error`) {
+		return
+	}
+	if !assert.Equal(t, msg, buf1.String(), `contents of the first writer should match`) {
+		return
+	}
+	if !assert.Equal(t, msg, buf2.String(), `contents of the last writer should match`) {
+		return
+	}
+
+	w = rotating.MultiWriter(nil, failingWriter{}, failingWriter{})
+	if _, err := w.Write([]byte(msg)); !assert.Error(t, err, `w.Write should fail when all writers fail`) {
+		return
+	}
+}
+
+func TestFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Fallback")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Files can not be created in a "directory" that is a regular file
+	blocker := filepath.Join(dir, "logs")
+	if !assert.NoError(t, ioutil.WriteFile(blocker, nil, 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	var fallback bytes.Buffer
+	var errs []error
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(blocker, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithFallback(&fallback, 10*time.Second),
+		rotating.WithErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "first\n")
+	fmt.Fprintf(f, "second\n")
+
+	// The primary file recovers, but is not retried until the retry
+	// interval elapses
+	if !assert.NoError(t, os.Remove(blocker), `os.Remove should succeed`) {
+		return
+	}
+	fmt.Fprintf(f, "third\n")
+	clock.Advance(10 * time.Second)
+	fmt.Fprintf(f, "fourth\n")
+
+	if !assert.Equal(t, "first\nsecond\nthird\n", fallback.String(), `contents of the fallback writer should match`) {
+		return
+	}
+	if !assert.Len(t, errs, 1, `the switch to the fallback writer should be reported once`) {
+		return
+	}
+	if !assert.Equal(t, int64(3), f.Stats().Fallback, `stats.Fallback should match`) {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(blocker, "20210101-000000.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "fourth\n", string(buf), `contents of the primary file should match`) {
+		return
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-CircuitBreaker")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Files can not be created in a "directory" that is a regular file
+	blocker := filepath.Join(dir, "logs")
+	if !assert.NoError(t, ioutil.WriteFile(blocker, nil, 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	var errs []error
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(blocker, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithCircuitBreaker(2, 10*time.Second),
+		rotating.WithErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	var cerr *rotating.CircuitOpenError
+	for i := 0; i < 2; i++ {
+		_, err := fmt.Fprintf(f, "Hello, World\n")
+		if !assert.Error(t, err, `write should fail`) {
+			return
+		}
+		if !assert.False(t, errors.As(err, &cerr), `error should not be a *rotating.CircuitOpenError`) {
+			return
+		}
+	}
+	if !assert.Len(t, errs, 1, `opening the breaker should be reported`) {
+		return
+	}
+
+	// The file system recovers, but the breaker is still open
+	if !assert.NoError(t, os.Remove(blocker), `os.Remove should succeed`) {
+		return
+	}
+	_, err = fmt.Fprintf(f, "Hello, World\n")
+	if !assert.True(t, errors.As(err, &cerr), `error should be a *rotating.CircuitOpenError`) {
+		return
+	}
+
+	clock.Advance(10 * time.Second)
+	if _, err := fmt.Fprintf(f, "Hello, World\n"); !assert.NoError(t, err, `write should succeed after the cool-down period`) {
+		return
+	}
+	if !assert.Equal(t, int64(1), f.Stats().CircuitOpen, `stats.CircuitOpen should match`) {
+		return
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Passthrough")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var buf bytes.Buffer
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithPassthrough(&buf),
+		rotating.WithTransformer(func(b []byte) []byte {
+			return append([]byte("[app] "), b...)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+	clock.Advance(6 * time.Second)
+	fmt.Fprintf(f, msg)
+	f.Close()
+
+	if !assert.Equal(t, "[app] "+msg+"[app] "+msg, buf.String(), `contents should match`) {
+		return
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if !assert.NoError(t, err, `ioutil.ReadDir should succeed`) {
+		return
+	}
+	if !assert.Len(t, entries, 0, `no files should be created`) {
+		return
+	}
+}
+
+func TestNewWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-NewWriter")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	t.Run("stdout", func(t *testing.T) {
+		w, err := rotating.NewWriter(ctx, "-")
+		if !assert.NoError(t, err, `rotating.NewWriter should succeed`) {
+			return
+		}
+		defer w.Close()
+		_, ok := w.(*rotating.File)
+		if !assert.False(t, ok, `writer should not be a *rotating.File`) {
+			return
+		}
+	})
+	t.Run("passthrough", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := rotating.NewWriter(ctx, filepath.Join(dir, "passthrough-%Y%m%d.log"), rotating.WithPassthrough(&buf))
+		if !assert.NoError(t, err, `rotating.NewWriter should succeed`) {
+			return
+		}
+		fmt.Fprintf(w, "Hello, World\n")
+		if !assert.NoError(t, w.Close(), `w.Close should succeed`) {
+			return
+		}
+		if !assert.Equal(t, "Hello, World\n", buf.String(), `contents should match`) {
+			return
+		}
+	})
+	t.Run("file", func(t *testing.T) {
+		w, err := rotating.NewWriter(ctx, filepath.Join(dir, "file-%Y%m%d.log"))
+		if !assert.NoError(t, err, `rotating.NewWriter should succeed`) {
+			return
+		}
+		defer w.Close()
+		if !assert.IsType(t, &rotating.File{}, w, `writer should be a *rotating.File`) {
+			return
+		}
+	})
+}
+
+type memSink struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (s *memSink) Size() int64 {
+	return int64(s.Len())
+}
+
+func (s *memSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestFileOpener(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var mu sync.Mutex
+	sinks := make(map[string]*memSink)
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		"/nonexistent/%Y%m%d-%H%M%S.log",
+		rotating.WithClock(clock),
+		rotating.WithMaxFileSize(20),
+		rotating.WithCheckInterval(time.Second),
+		rotating.WithFileHeader(rotating.StaticHeader("# header\n")),
+		rotating.WithFileOpener(func(name string) (io.WriteCloser, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			s := &memSink{}
+			sinks[name] = s
+			return s, nil
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+	clock.Advance(time.Second)
+	fmt.Fprintf(f, msg)
+	f.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := map[string]string{
+		"/nonexistent/20210101-000000.log":   "# header\n" + msg,
+		"/nonexistent/20210101-000000.log.1": "# header\n" + msg,
+	}
+	if !assert.Len(t, sinks, len(expected), `number of sinks should match`) {
+		return
+	}
+	for name, content := range expected {
+		s, ok := sinks[name]
+		if !assert.True(t, ok, `sink %s should exist`, name) {
+			return
+		}
+		if !assert.Equal(t, content, s.String(), `contents of %s should match`, name) {
+			return
+		}
+		if !assert.True(t, s.closed, `sink %s should be closed`, name) {
+			return
+		}
+	}
+}
+
+func TestWriterWrapper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-WriterWrapper")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wrapped []string
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log.gz"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithWriterWrapper(func(w io.Writer, filename string) io.Writer {
+			mu.Lock()
+			wrapped = append(wrapped, filepath.Base(filename))
+			mu.Unlock()
+			return gzip.NewWriter(w)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+	fmt.Fprintf(f, msg)
+	clock.Advance(6 * time.Second)
+	fmt.Fprintf(f, msg)
+	f.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Equal(t, []string{"20210101-000000.log.gz", "20210101-000005.log.gz"}, wrapped, `wrapped files should match`) {
+		return
+	}
+
+	expected := map[string]string{
+		"20210101-000000.log.gz": msg + msg,
+		"20210101-000005.log.gz": msg,
+	}
+	for name, content := range expected {
+		fh, err := os.Open(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `os.Open should succeed`) {
+			return
+		}
+		defer fh.Close()
+
+		gz, err := gzip.NewReader(fh)
+		if !assert.NoError(t, err, `gzip.NewReader should succeed`) {
+			return
+		}
+		buf, err := ioutil.ReadAll(gz)
+		if !assert.NoError(t, err, `reading a complete gzip stream should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(buf), `contents of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func TestNewStdLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-NewStdLogger")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	logger, f, err := rotating.NewStdLogger(ctx, filepath.Join(dir, "app.log"))
+	if !assert.NoError(t, err, `rotating.NewStdLogger should succeed`) {
+		return
+	}
+	logger.SetFlags(0)
+	logger.Printf("Hello, World")
+	f.Close()
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "Hello, World\n", string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-MaxAge")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"20210101-000000.log", "20210108-000000.log"} {
+		fn := filepath.Join(dir, name)
+		if !assert.NoError(t, ioutil.WriteFile(fn, nil, 0644), `ioutil.WriteFile should succeed`) {
+			return
+		}
+		mtime := now.Add(-time.Duration(9-7*i) * 24 * time.Hour)
+		if !assert.NoError(t, os.Chtimes(fn, mtime, mtime), `os.Chtimes should succeed`) {
+			return
+		}
+	}
+
+	clock := NewFakeClock(now)
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithMaxAge(7*24*time.Hour),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	fmt.Fprintf(f, "Hello, World\n")
+	f.Close()
+
+	entries, err := ioutil.ReadDir(dir)
+	if !assert.NoError(t, err, `ioutil.ReadDir should succeed`) {
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !assert.Equal(t, []string{"20210108-000000.log", "20210110-000000.log"}, names, `only files newer than the max age should remain`) {
+		return
+	}
+}
+
+func TestDockerJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-DockerJSON")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "app.log"),
+		rotating.WithClock(clock),
+		rotating.WithDockerJSON("stderr"),
+		rotating.WithTransformer(func(rec []byte) []byte {
+			return bytes.ToUpper(rec)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	fmt.Fprintf(f, "hello\n\"world\"\n")
+	clock.Advance(time.Second)
+	fmt.Fprintf(f, "no newline")
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	expected := `{"log":"HELLO\n","stream":"stderr","time":"2021-01-01T00:00:00Z"}` + "\n" +
+		`{"log":"\"WORLD\"\n","stream":"stderr","time":"2021-01-01T00:00:00Z"}` + "\n" +
+		`{"log":"NO NEWLINE","stream":"stderr","time":"2021-01-01T00:00:01Z"}` + "\n"
+	if !assert.Equal(t, expected, string(content), `content should match`) {
+		return
+	}
+}
+
+func TestClone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Clone")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	header := func(filename string, _ time.Time) []byte {
+		return []byte("# " + filepath.Base(filename) + "\n")
+	}
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "app-%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithFileHeader(header),
+		rotating.WithSymlink(filepath.Join(dir, "app.log")),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	access, err := f.Clone(filepath.Join(dir, "access-%Y%m%d.log"), rotating.WithSymlink(filepath.Join(dir, "access.log")))
+	if !assert.NoError(t, err, `f.Clone should succeed`) {
+		return
+	}
+	defer access.Close()
+
+	audit, err := f.Clone(filepath.Join(dir, "audit-%Y%m%d.log"))
+	if !assert.NoError(t, err, `f.Clone should succeed`) {
+		return
+	}
+	defer audit.Close()
+
+	for _, w := range []*rotating.File{f, access, audit} {
+		if _, err := w.Write([]byte("hello\n")); !assert.NoError(t, err, `Write should succeed`) {
+			return
+		}
+		if !assert.NoError(t, w.Close(), `Close should succeed`) {
+			return
+		}
+	}
+
+	// The clock and the header are shared
+	for _, name := range []string{"app-20210101.log", "access-20210101.log", "audit-20210101.log"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, "# "+name+"\nhello\n", string(data), `contents of %s should match`, name) {
+			return
+		}
+	}
+
+	// The symlink is not inherited
+	for link, target := range map[string]string{"app.log": "app-20210101.log", "access.log": "access-20210101.log"} {
+		dest, err := os.Readlink(filepath.Join(dir, link))
+		if !assert.NoError(t, err, `os.Readlink should succeed`) {
+			return
+		}
+		if !assert.Equal(t, target, filepath.Base(dest), `symlink %s should point to %s`, link, target) {
+			return
+		}
+	}
+}
+
+func TestDirMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-DirMode")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "logs", "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithSymlink(filepath.Join(dir, "current", "app.log")),
+		rotating.WithDirMode(0700),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	fmt.Fprintf(f, "hello\n")
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	for _, name := range []string{"logs", "current"} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `os.Stat should succeed`) {
+			return
+		}
+		if !assert.Equal(t, os.FileMode(0700), fi.Mode().Perm(), `mode of %s should match`, name) {
+			return
+		}
+	}
+}
+
+type chownRecorder struct {
+	rotating.FileSystem
+	mu     sync.Mutex
+	chowns []string
+}
+
+func (fs *chownRecorder) Chown(name string, uid, gid int) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.chowns = append(fs.chowns, fmt.Sprintf("%s:%d:%d", name, uid, gid))
+	return nil
+}
+
+func TestOwner(t *testing.T) {
+	t.Run("created files and directories", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "rotating_test-Owner")
+		if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		fs := &chownRecorder{FileSystem: rotating.OSFileSystem()}
+		clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+		f, err := rotating.NewFile(
+			ctx,
+			filepath.Join(dir, "a", "b", "%Y%m%d.log"),
+			rotating.WithClock(clock),
+			rotating.WithFileSystem(fs),
+			rotating.WithOwner(1000, -1),
+		)
+		if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+			return
+		}
+
+		fmt.Fprintf(f, "hello\n")
+		if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+			return
+		}
+
+		expected := []string{
+			filepath.Join(dir, "a") + ":1000:-1",
+			filepath.Join(dir, "a", "b") + ":1000:-1",
+			filepath.Join(dir, "a", "b", "20210101.log") + ":1000:-1",
+		}
+		if !assert.Equal(t, expected, fs.chowns, `only created paths should be chown'ed`) {
+			return
+		}
+	})
+	t.Run("unsupported file system", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		var mu sync.Mutex
+		var errs []error
+		clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+		f, err := rotating.NewFile(
+			ctx,
+			"/logs/%Y%m%d.log",
+			rotating.WithClock(clock),
+			rotating.WithFileSystem(rotatingtest.NewMemFS(clock)),
+			rotating.WithOwner(1000, 1000),
+			rotating.WithErrorHandler(func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, err)
+			}),
+		)
+		if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+			return
+		}
+
+		_, err = fmt.Fprintf(f, "hello\n")
+		if !assert.NoError(t, err, `write should succeed`) {
+			return
+		}
+		if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !assert.NotEmpty(t, errs, `chown failures should be reported`) {
+			return
+		}
+	})
+}
+
+func TestExactPermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ExactPermissions")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// 0666 and 0777 would be reduced by any non-zero umask
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "logs", "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithFileMode(0666),
+		rotating.WithDirMode(0777),
+		rotating.WithExactPermissions(true),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	fmt.Fprintf(f, "hello\n")
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, "logs"))
+	if !assert.NoError(t, err, `os.Stat should succeed`) {
+		return
+	}
+	if !assert.Equal(t, os.FileMode(0777), fi.Mode().Perm(), `mode of directory should match`) {
+		return
+	}
+
+	fi, err = os.Stat(filepath.Join(dir, "logs", "20210101.log"))
+	if !assert.NoError(t, err, `os.Stat should succeed`) {
+		return
+	}
+	if !assert.Equal(t, os.FileMode(0666), fi.Mode().Perm(), `mode of file should match`) {
+		return
+	}
+}
+
+func TestTruncateOnOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-TruncateOnOpen")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "20210101.log")
+	if !assert.NoError(t, ioutil.WriteFile(filename, []byte("previous run\n"), 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithTruncateOnOpen(true),
+		rotating.WithIdleTimeout(50*time.Millisecond),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+	// reopening the released file handle should not truncate the file
+	time.Sleep(150 * time.Millisecond)
+	fmt.Fprintf(f, msg)
+	f.Close()
+
+	buf, err := ioutil.ReadFile(filename)
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, msg+msg, string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestOpenCurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-OpenCurrent")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(24*time.Hour),
+		rotating.WithBufferSize(4096),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	_, err = f.OpenCurrent()
+	if !assert.Error(t, err, `f.OpenCurrent should fail before anything is written`) {
+		return
+	}
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+
+	r, err := f.OpenCurrent()
+	if !assert.NoError(t, err, `f.OpenCurrent should succeed`) {
+		return
+	}
+	defer r.Close()
+
+	// the handle should still refer to the same file after rotation
+	clock.Advance(24 * time.Hour)
+	fmt.Fprintf(f, "next day\n")
+
+	buf, err := ioutil.ReadAll(r)
+	if !assert.NoError(t, err, `ioutil.ReadAll should succeed`) {
+		return
+	}
+	if !assert.Equal(t, msg, string(buf), `buffered data should have been flushed`) {
+		return
+	}
+}
+
+func TestBaseTimeAndGeneration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-BaseTimeAndGeneration")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 12, 30, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(24*time.Hour),
+		rotating.WithMaxFileSize(10),
+		rotating.WithCheckInterval(100*time.Millisecond),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	if !assert.True(t, f.BaseTime().IsZero(), `base time should be zero before anything is written`) {
+		return
+	}
+
+	const msg = "0123456789\n"
+	for i := 0; i < 3; i++ {
+		clock.Advance(200 * time.Millisecond)
+		fmt.Fprintf(f, msg)
+		if !assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), f.BaseTime(), `base time should match`) {
+			return
+		}
+		if !assert.Equal(t, i, f.Generation(), `generation should match`) {
+			return
+		}
+	}
+
+	clock.Advance(24 * time.Hour)
+	fmt.Fprintf(f, msg)
+	if !assert.Equal(t, time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), f.BaseTime(), `base time should match`) {
+		return
+	}
+	if !assert.Equal(t, 0, f.Generation(), `generation should be reset`) {
+		return
+	}
+}
+
+func TestVerifyDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-VerifyDirectory")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	t.Run("directory is created", func(t *testing.T) {
+		f, err := rotating.NewFile(
+			ctx,
+			filepath.Join(dir, "logs", "%Y", "%m%d.log"),
+			rotating.WithVerifyDirectory(true),
+		)
+		if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+			return
+		}
+		defer f.Close()
+
+		entries, err := os.ReadDir(filepath.Join(dir, "logs"))
+		if !assert.NoError(t, err, `os.ReadDir should succeed`) {
+			return
+		}
+		if !assert.Len(t, entries, 0, `the probe should have been removed`) {
+			return
+		}
+	})
+	t.Run("directory is not writable", func(t *testing.T) {
+		// a regular file where the directory should be
+		blocker := filepath.Join(dir, "blocker")
+		if !assert.NoError(t, ioutil.WriteFile(blocker, nil, 0644), `ioutil.WriteFile should succeed`) {
+			return
+		}
+
+		_, err := rotating.NewFile(
+			ctx,
+			filepath.Join(blocker, "%Y%m%d.log"),
+			rotating.WithVerifyDirectory(true),
+		)
+		if !assert.Error(t, err, `rotating.NewFile should fail`) {
+			return
+		}
+	})
+}
+
+func TestPreopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Preopen")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var mu sync.Mutex
+	var opened []string
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 59, 50, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H.log"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(time.Hour),
+		rotating.WithPreopen(30*time.Second),
+		rotating.WithFileOpener(func(name string) (io.WriteCloser, error) {
+			mu.Lock()
+			opened = append(opened, filepath.Base(name))
+			mu.Unlock()
+			return os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	fmt.Fprintf(f, "before\n")
+
+	// the file for the next slot is opened in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(opened)
+		mu.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	clock.Advance(10 * time.Second)
+	fmt.Fprintf(f, "after\n")
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Equal(t, []string{"20210101-00.log", "20210101-01.log"}, opened, `the next file should only be opened once`) {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101-01.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "after\n", string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestRetainSlots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-RetainSlots")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(24*time.Hour),
+		rotating.WithMaxFileSize(10),
+		rotating.WithCheckInterval(100*time.Millisecond),
+		rotating.WithRetainSlots(2),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	// two generations per day
+	for day := 0; day < 3; day++ {
+		for i := 0; i < 2; i++ {
+			fmt.Fprintf(f, "0123456789\n")
+			clock.Advance(200 * time.Millisecond)
+		}
+		clock.Set(time.Date(2021, 1, 2+day, 0, 0, 0, 0, time.UTC))
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if !assert.NoError(t, err, `os.ReadDir should succeed`) {
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !assert.Equal(t, []string{"20210102.log", "20210102.log.1", "20210103.log", "20210103.log.1"}, names, `only the last 2 days should be retained`) {
+		return
+	}
+}
+
+func TestFilePurge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-FilePurge")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"20210101.log", "20210102.log", "20210103.log", "20210104.log"} {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644), `ioutil.WriteFile should succeed`) {
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(NewFakeClock(time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC))),
+		rotating.WithRotationCount(2),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	removed, err := f.Purge()
+	if !assert.NoError(t, err, `f.Purge should succeed`) {
+		return
+	}
+	if !assert.Equal(t, []string{filepath.Join(dir, "20210101.log"), filepath.Join(dir, "20210102.log")}, removed, `removed files should match`) {
+		return
+	}
+
+	removed, err = f.Purge()
+	if !assert.NoError(t, err, `f.Purge should succeed`) {
+		return
+	}
+	if !assert.Empty(t, removed, `nothing should be removed the second time`) {
+		return
+	}
+}
+
+// tornWriter writes only half of the first write to the file, and fails
+type tornWriter struct {
+	*os.File
+	torn bool
+}
+
+func (w *tornWriter) Write(p []byte) (int, error) {
+	if w.torn {
+		return w.File.Write(p)
+	}
+	w.torn = true
+	n, _ := w.File.Write(p[:len(p)/2])
+	return n, errors.New(`quota exceeded`)
+}
+
+func TestPartialWriteRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-PartialWriteRetry")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var opens int
+	var reported []error
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithPartialWriteRetry(1),
+		rotating.WithErrorHandler(func(err error) {
+			reported = append(reported, err)
+		}),
+		rotating.WithFileOpener(func(name string) (io.WriteCloser, error) {
+			opens++
+			fh, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, err
+			}
+			return &tornWriter{File: fh, torn: opens > 1}, nil
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "0123456789\n"
+	n, err := f.Write([]byte(msg))
+	if !assert.NoError(t, err, `f.Write should succeed`) {
+		return
+	}
+	if !assert.Equal(t, len(msg), n, `f.Write should report the full length`) {
+		return
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	if !assert.Equal(t, 2, opens, `the file should have been reopened`) {
+		return
+	}
+	if !assert.Len(t, reported, 1, `the partial write should have been reported`) {
+		return
+	}
+
+	stats := f.Stats()
+	if !assert.Equal(t, int64(1), stats.Records, `records should match`) {
+		return
+	}
+	if !assert.Equal(t, int64(len(msg)), stats.Bytes, `bytes should match`) {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, msg, string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestFileError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-FileError")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// a regular file where the directory should be
+	blocker := filepath.Join(dir, "blocker")
+	if !assert.NoError(t, ioutil.WriteFile(blocker, nil, 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var mu sync.Mutex
+	var reported int
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithSymlink(filepath.Join(blocker, "current.log")),
+		rotating.WithErrorHandler(func(err error) {
+			mu.Lock()
+			reported++
+			mu.Unlock()
+			var fe *rotating.FileError
+			if assert.True(t, errors.As(err, &fe), `reported error should be a *rotating.FileError`) {
+				assert.Equal(t, rotating.OpSymlink, fe.Op, `operation should match`)
+				assert.Equal(t, filepath.Join(blocker, "current.log"), fe.Path, `path should match`)
+			}
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	fmt.Fprintf(f, "hello\n")
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Equal(t, 1, reported, `the symlink failure should have been reported`) {
+		return
+	}
+
+	f, err = rotating.NewFile(
+		ctx,
+		filepath.Join(blocker, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "hello\n")
+	var fe *rotating.FileError
+	if !assert.True(t, errors.As(err, &fe), `error should be a *rotating.FileError`) {
+		return
+	}
+	if !assert.Equal(t, rotating.OpRotate, fe.Op, `operation should match`) {
+		return
+	}
+	if !assert.Equal(t, filepath.Join(blocker, "20210101.log"), fe.Path, `path should match`) {
+		return
+	}
+}
+
+func TestContinuationMarkers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ContinuationMarkers")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(24*time.Hour),
+		rotating.WithFileHeader(rotating.StaticHeader("# header\n")),
+		rotating.WithContinuationMarkers(true),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	fmt.Fprintf(f, "day 1\n")
+	clock.Advance(24 * time.Hour)
+	fmt.Fprintf(f, "day 2\n")
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	first := filepath.Join(dir, "20210101.log")
+	second := filepath.Join(dir, "20210102.log")
+	expected := map[string]string{
+		first:  "# header\nday 1\n-- continued in " + second + " --\n",
+		second: "# header\n-- continued from " + first + " --\nday 2\n",
+	}
+	for name, content := range expected {
+		buf, err := ioutil.ReadFile(name)
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(buf), `contents of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func TestMaxUncompressedSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-MaxUncompressedSize")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log.gz"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(24*time.Hour),
+		rotating.WithMaxFileSize(1<<20),
+		rotating.WithMaxUncompressedSize(300),
+		rotating.WithWriterWrapper(func(w io.Writer, _ string) io.Writer {
+			return gzip.NewWriter(w)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	// 100 bytes per record, so that every 3 records fill a file
+	record := strings.Repeat("a", 99) + "\n"
+	for i := 0; i < 9; i++ {
+		if _, err := f.Write([]byte(record)); !assert.NoError(t, err, `f.Write should succeed`) {
+			return
+		}
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	for _, name := range []string{"20210101.log.gz", "20210101.log.gz.1", "20210101.log.gz.2"} {
+		fh, err := os.Open(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `os.Open should succeed`) {
+			return
+		}
+		zr, err := gzip.NewReader(fh)
+		if !assert.NoError(t, err, `gzip.NewReader should succeed`) {
+			fh.Close()
+			return
+		}
+		buf, err := ioutil.ReadAll(zr)
+		fh.Close()
+		if !assert.NoError(t, err, `ioutil.ReadAll should succeed`) {
+			return
+		}
+		if !assert.Equal(t, strings.Repeat(record, 3), string(buf), `contents of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Snapshot")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "logs", "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithBufferSize(4096),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+
+	dst := filepath.Join(dir, "bundle", "app.log")
+	n, err := f.Snapshot(dst)
+	if !assert.NoError(t, err, `f.Snapshot should succeed`) {
+		return
+	}
+	if !assert.Equal(t, int64(len(msg)), n, `f.Snapshot should report the size of the copy`) {
+		return
+	}
+	fmt.Fprintf(f, "after the snapshot\n")
+
+	buf, err := ioutil.ReadFile(dst)
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, msg, string(buf), `contents should match`) {
+		return
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(dst))
+	if !assert.NoError(t, err, `os.ReadDir should succeed`) {
+		return
+	}
+	if !assert.Len(t, entries, 1, `the temporary file should have been renamed`) {
+		return
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Backoff")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// fail the first two attempts to create the file
+	var attempts int
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithBackoff(backoff.NewConstantPolicy(
+			backoff.WithInterval(time.Millisecond),
+			backoff.WithMaxRetries(5),
+		)),
+		rotating.WithFileOpener(func(name string) (io.WriteCloser, error) {
+			attempts++
+			if attempts <= 2 {
+				return nil, errors.New(`file system is unavailable`)
+			}
+			return os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "hello\n")
+	if !assert.NoError(t, err, `write should succeed after retrying`) {
+		return
+	}
+	if !assert.Equal(t, 3, attempts, `the file should have been created on the third attempt`) {
+		return
+	}
+}
+
+func TestRotateHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-RotateHook")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var infos []rotating.RotationInfo
+	var contents []string
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d%H.log"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(time.Hour),
+		rotating.WithRotateHook(func(info rotating.RotationInfo) {
+			// the previous file must be complete by the time the hook is called
+			buf, _ := ioutil.ReadFile(info.Previous)
+			infos = append(infos, info)
+			contents = append(contents, string(buf))
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	fmt.Fprintf(f, "first\n")
+	if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+		return
+	}
+	fmt.Fprintf(f, "second\n")
+	clock.Advance(time.Hour)
+	fmt.Fprintf(f, "third\n")
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	expected := []rotating.RotationInfo{
+		{
+			Previous: filepath.Join(dir, "2021010100.log"),
+			Filename: filepath.Join(dir, "2021010100.log.1"),
+			Reason:   rotating.RotationManual,
+			Time:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Previous: filepath.Join(dir, "2021010100.log.1"),
+			Filename: filepath.Join(dir, "2021010101.log"),
+			Reason:   rotating.RotationInterval,
+			Time:     time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC),
+		},
+	}
+	if !assert.Equal(t, expected, infos, `the hook should have been called for each rotation`) {
+		return
+	}
+	if !assert.Equal(t, []string{"first\n", "second\n"}, contents, `the previous files should be complete`) {
+		return
+	}
+}
+
+type failingCloser struct {
+	io.WriteCloser
+}
+
+func (c failingCloser) Close() error {
+	_ = c.WriteCloser.Close()
+	return errors.New(`close failed`)
+}
+
+func TestCloseErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-CloseErrors")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var mu sync.Mutex
+	var handled []error
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithIdleTimeout(50*time.Millisecond),
+		rotating.WithErrorHandler(func(err error) {
+			mu.Lock()
+			handled = append(handled, err)
+			mu.Unlock()
+		}),
+		rotating.WithFileOpener(func(name string) (io.WriteCloser, error) {
+			fh, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, err
+			}
+			return failingCloser{fh}, nil
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+	// let the file handle be released, and write again
+	time.Sleep(150 * time.Millisecond)
+	fmt.Fprintf(f, msg)
+
+	mu.Lock()
+	released := handled
+	mu.Unlock()
+	var fe *rotating.FileError
+	if !assert.Len(t, released, 1, `releasing the idle file should have been reported`) {
+		return
+	}
+	if !assert.True(t, errors.As(released[0], &fe), `error should be a FileError`) {
+		return
+	}
+	if !assert.Equal(t, rotating.OpFinalize, fe.Op, `operation should match`) {
+		return
+	}
+
+	err = f.Close()
+	if !assert.Error(t, err, `f.Close should report the failure to close the current file`) {
+		return
+	}
+	if !assert.True(t, errors.As(err, &fe), `error should be a FileError`) {
+		return
+	}
+	if !assert.Equal(t, filepath.Join(dir, "20210101.log"), fe.Path, `path should match`) {
+		return
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-TypedErrors")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithFileOpener(func(name string) (io.WriteCloser, error) {
+			return nil, errors.New(`file system is unavailable`)
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	_, err = fmt.Fprintf(f, "hello\n")
+	if !assert.True(t, errors.Is(err, rotating.ErrRotationFailed), `error should be ErrRotationFailed`) {
+		return
+	}
+	if !assert.False(t, errors.Is(err, rotating.ErrPurgeFailed), `error should not be ErrPurgeFailed`) {
+		return
+	}
+
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+	_, err = fmt.Fprintf(f, "hello\n")
+	if !assert.True(t, errors.Is(err, rotating.ErrClosed), `writing after Close should fail with ErrClosed`) {
+		return
+	}
+	if !assert.True(t, errors.Is(f.Rotate(), rotating.ErrClosed), `rotating after Close should fail with ErrClosed`) {
+		return
+	}
+}
+
+type syncRecorder struct {
+	io.WriteCloser
+	syncs int
+}
+
+func (r *syncRecorder) Sync() error {
+	r.syncs++
+	return nil
+}
+
+func TestSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Sync")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var rec *syncRecorder
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithBufferSize(1024),
+		rotating.WithFileOpener(func(name string) (io.WriteCloser, error) {
+			fh, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, err
+			}
+			rec = &syncRecorder{WriteCloser: fh}
+			return rec, nil
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	if !assert.NoError(t, f.Sync(), `f.Sync should succeed before anything is written`) {
+		return
+	}
+
+	const msg = "Hello, World\n"
+	fmt.Fprintf(f, msg)
+	if !assert.NoError(t, f.Sync(), `f.Sync should succeed`) {
+		return
+	}
+	if !assert.Equal(t, 0, f.Buffered(), `f.Buffered should be 0 after sync`) {
+		return
+	}
+	if !assert.NotZero(t, rec.syncs, `the file should have been synced`) {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, msg, string(buf), `contents should match`) {
+		return
+	}
+}
+
+func readGzip(t *testing.T, filename string) string {
+	t.Helper()
+	fh, err := os.Open(filename)
+	if !assert.NoError(t, err, `os.Open should succeed`) {
+		return ""
+	}
+	defer fh.Close()
+
+	gz, err := gzip.NewReader(fh)
+	if !assert.NoError(t, err, `gzip.NewReader should succeed`) {
+		return ""
+	}
+	buf, err := ioutil.ReadAll(gz)
+	if !assert.NoError(t, err, `reading the gzip stream should succeed`) {
+		return ""
+	}
+	return string(buf)
+}
+
+func TestCompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Compress")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	newFile := func(options ...rotating.Option) (*rotating.File, error) {
+		options = append(options, rotating.WithClock(clock), rotating.WithCompress(true))
+		return rotating.NewFile(ctx, filepath.Join(dir, "%Y%m%d.log"), options...)
+	}
+
+	t.Run("Rotate", func(t *testing.T) {
+		var previous []string
+		f, err := newFile(
+			rotating.WithRotateHook(func(info rotating.RotationInfo) {
+				previous = append(previous, info.Previous)
+			}),
+		)
+		if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+			return
+		}
+
+		for _, msg := range []string{"first\n", "second\n", "third\n"} {
+			fmt.Fprint(f, msg)
+			if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+				return
+			}
+		}
+		if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+			return
+		}
+
+		expected := []string{
+			filepath.Join(dir, "20210101.log.gz"),
+			filepath.Join(dir, "20210101.log.1.gz"),
+			filepath.Join(dir, "20210101.log.2.gz"),
+		}
+		if !assert.Equal(t, expected, previous, `the hook should see the compressed files`) {
+			return
+		}
+
+		for i, msg := range []string{"first\n", "second\n", "third\n"} {
+			if !assert.Equal(t, msg, readGzip(t, expected[i]), `contents should match`) {
+				return
+			}
+		}
+
+		matches, err := filepath.Glob(filepath.Join(dir, "*"))
+		if !assert.NoError(t, err, `filepath.Glob should succeed`) {
+			return
+		}
+		if !assert.ElementsMatch(t, append(expected, filepath.Join(dir, "20210101.log.3")), matches, `the original files should have been removed`) {
+			return
+		}
+	})
+
+	t.Run("Append", func(t *testing.T) {
+		// A restarted process writes to the same names again, and the
+		// data is appended to the files compressed by the previous run
+		for _, msg := range []string{"once\n", "again\n"} {
+			f, err := newFile()
+			if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+				return
+			}
+			fmt.Fprint(f, msg)
+			if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+				return
+			}
+			if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+				return
+			}
+		}
+
+		if !assert.Equal(t, "first\nonce\nagain\n", readGzip(t, filepath.Join(dir, "20210101.log.gz")), `contents should match`) {
+			return
+		}
+		if _, err := os.Stat(filepath.Join(dir, "20210101.log")); !assert.True(t, os.IsNotExist(err), `the original file should have been removed`) {
+			return
+		}
+	})
+}
+
+// upperCompressor "compresses" files by converting them to upper case
+type upperCompressor struct{}
+
+func (upperCompressor) Compress(dst io.Writer, src io.Reader) error {
+	buf, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(bytes.ToUpper(buf))
+	return err
+}
+
+func (upperCompressor) Suffix() string {
+	return ".up"
+}
+
+func TestCompressor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Compressor")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithCompressor(upperCompressor{}),
+		rotating.WithRotationCount(2),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	for _, msg := range []string{"first\n", "second\n"} {
+		fmt.Fprint(f, msg)
+		if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+			return
+		}
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*"))
+	if !assert.NoError(t, err, `filepath.Glob should succeed`) {
+		return
+	}
+	compressed := filepath.Join(dir, "20210101.log.1.up")
+	if !assert.ElementsMatch(t, []string{compressed, filepath.Join(dir, "20210101.log.2")}, matches, `files should match`) {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(compressed)
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "SECOND\n", string(buf), `contents should match`) {
+		return
+	}
+}
+
+// blockingCompressor copies the files as they are, but waits until
+// release is closed before doing so
+type blockingCompressor struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c blockingCompressor) Compress(dst io.Writer, src io.Reader) error {
+	c.started <- struct{}{}
+	<-c.release
+	_, err := io.Copy(dst, src)
+	return err
+}
+
+func (blockingCompressor) Suffix() string {
+	return ".z"
+}
+
+func TestCompressionWorkers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-CompressionWorkers")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	compressor := blockingCompressor{
+		started: make(chan struct{}, 3),
+		release: make(chan struct{}),
+	}
+	var mu sync.Mutex
+	var infos []rotating.CompressionInfo
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithCompressor(compressor),
+		rotating.WithCompressionWorkers(2),
+		rotating.WithCompressHook(func(info rotating.CompressionInfo) {
+			mu.Lock()
+			infos = append(infos, info)
+			mu.Unlock()
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	// The rotations must not wait for the compression
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(f, "file %d\n", i)
+		if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+			return
+		}
+	}
+
+	// Only two files are compressed at a time
+	for i := 0; i < 2; i++ {
+		select {
+		case <-compressor.started:
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, `compression should have started`)
+			return
+		}
+	}
+	select {
+	case <-compressor.started:
+		assert.Fail(t, `the third file should wait for a worker`)
+		return
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(compressor.release)
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	if !assert.Len(t, infos, 3, `the hook should have been called for each file`) {
+		return
+	}
+	sources := make([]string, len(infos))
+	for i, info := range infos {
+		if !assert.NoError(t, info.Err, `compression should succeed`) {
+			return
+		}
+		if !assert.Equal(t, info.Source+".z", info.Filename, `name of the compressed file should match`) {
+			return
+		}
+		sources[i] = filepath.Base(info.Source)
+	}
+	if !assert.ElementsMatch(t, []string{"20210101.log", "20210101.log.1", "20210101.log.2"}, sources, `compressed files should match`) {
+		return
+	}
+	if !assert.Equal(t, 0, infos[2].Pending, `no files should be pending after the last one`) {
+		return
+	}
+}
+
+func TestArchiveDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-ArchiveDir")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// The name of the archive directory matches the pattern, but it must
+	// not be counted (or archived)
+	archive := filepath.Join(dir, "archive.log.d")
+	if !assert.NoError(t, os.Mkdir(archive, 0755), `os.Mkdir should succeed`) {
+		return
+	}
+	// A file archived by a previous run
+	if !assert.NoError(t, ioutil.WriteFile(filepath.Join(archive, "20210101.log"), []byte("previous\n"), 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+	for _, name := range []string{"20210101.log", "20210102.log", "20210103.log", "20210104.log"} {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644), `ioutil.WriteFile should succeed`) {
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(NewFakeClock(time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC))),
+		rotating.WithRotationCount(2),
+		rotating.WithArchiveDir(archive),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	removed, err := f.Purge()
+	if !assert.NoError(t, err, `f.Purge should succeed`) {
+		return
+	}
+	if !assert.Equal(t, []string{filepath.Join(dir, "20210101.log"), filepath.Join(dir, "20210102.log")}, removed, `archived files should match`) {
+		return
+	}
+
+	removed, err = f.Purge()
+	if !assert.NoError(t, err, `f.Purge should succeed`) {
+		return
+	}
+	if !assert.Empty(t, removed, `nothing should be archived the second time`) {
+		return
+	}
+
+	expected := map[string]string{
+		"20210101.log":   "previous\n",
+		"20210101.log.1": "20210101.log",
+		"20210102.log":   "20210102.log",
+	}
+	entries, err := os.ReadDir(archive)
+	if !assert.NoError(t, err, `os.ReadDir should succeed`) {
+		return
+	}
+	if !assert.Len(t, entries, len(expected), `number of archived files should match`) {
+		return
+	}
+	for name, content := range expected {
+		buf, err := ioutil.ReadFile(filepath.Join(archive, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(buf), `contents of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func TestArchiver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Archiver")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// archiver records the archived files, and fails for the files in
+	// failures as many times as specified
+	type archiver struct {
+		mu       sync.Mutex
+		archived map[string]string
+		failures map[string]int
+		deadline bool
+	}
+	newArchiver := func(failures map[string]int) *archiver {
+		return &archiver{archived: make(map[string]string), failures: failures}
+	}
+	archiveFunc := func(a *archiver) rotating.Archiver {
+		return rotating.ArchiverFunc(func(ctx context.Context, path string) error {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			_, a.deadline = ctx.Deadline()
+			name := filepath.Base(path)
+			if a.failures[name] != 0 {
+				a.failures[name]--
+				return errors.New(`connection refused`)
+			}
+			buf, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			a.archived[name] = string(buf)
+			return nil
+		})
+	}
+	newFile := func(a *archiver, errs *[]error) (*rotating.File, error) {
+		return rotating.NewFile(
+			ctx,
+			filepath.Join(dir, "%Y%m%d.log"),
+			rotating.WithClock(NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))),
+			rotating.WithRotationCount(1),
+			rotating.WithArchiver(archiveFunc(a)),
+			rotating.WithArchiveTimeout(time.Minute),
+			rotating.WithErrorHandler(func(err error) { *errs = append(*errs, err) }),
+		)
+	}
+	writeFiles := func(f *rotating.File) bool {
+		for _, s := range []string{"first\n", "second\n"} {
+			fmt.Fprint(f, s)
+			if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+				return false
+			}
+		}
+		return assert.NoError(t, f.Close(), `f.Close should succeed`)
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	t.Run("Retry", func(t *testing.T) {
+		defer func() {
+			files, _ := filepath.Glob(filepath.Join(dir, "*"))
+			for _, file := range files {
+				os.Remove(file)
+			}
+		}()
+
+		// The first file fails to be archived once, and is archived
+		// along with the next one
+		a := newArchiver(map[string]int{"20210101.log": 1})
+		var errs []error
+		f, err := newFile(a, &errs)
+		if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+			return
+		}
+		if !writeFiles(f) {
+			return
+		}
+
+		expected := map[string]string{"20210101.log": "first\n", "20210101.log.1": "second\n"}
+		if !assert.Equal(t, expected, a.archived, `archived files should match`) {
+			return
+		}
+		if !assert.True(t, a.deadline, `the context should have a deadline`) {
+			return
+		}
+		if !assert.Len(t, errs, 1, `there should be one error`) {
+			return
+		}
+		var fe *rotating.FileError
+		if !assert.True(t, errors.As(errs[0], &fe), `error should be a *FileError`) {
+			return
+		}
+		if !assert.Equal(t, rotating.OpArchive, fe.Op, `Op should match`) {
+			return
+		}
+		markers, _ := filepath.Glob(filepath.Join(dir, "*_archive"))
+		if !assert.Empty(t, markers, `no markers should be left`) {
+			return
+		}
+	})
+
+	t.Run("Recover", func(t *testing.T) {
+		// The files that fail to be archived are kept regardless of the
+		// rotation count
+		a := newArchiver(map[string]int{"20210101.log": -1, "20210101.log.1": -1})
+		var errs []error
+		f, err := newFile(a, &errs)
+		if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+			return
+		}
+		if !writeFiles(f) {
+			return
+		}
+		if !assert.Empty(t, a.archived, `no files should be archived`) {
+			return
+		}
+		for _, name := range []string{"20210101.log", "20210101.log_archive", "20210101.log.1", "20210101.log.1_archive", "20210101.log.2"} {
+			if !assert.True(t, exists(name), `%s should exist`, name) {
+				return
+			}
+		}
+
+		// The next File archives them
+		a = newArchiver(nil)
+		errs = nil
+		f, err = newFile(a, &errs)
+		if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+			return
+		}
+		if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+			return
+		}
+		if !assert.Empty(t, errs, `there should be no errors`) {
+			return
+		}
+		expected := map[string]string{"20210101.log": "first\n", "20210101.log.1": "second\n"}
+		if !assert.Equal(t, expected, a.archived, `archived files should match`) {
+			return
+		}
+		for _, name := range []string{"20210101.log_archive", "20210101.log.1_archive"} {
+			if !assert.False(t, exists(name), `%s should be removed`, name) {
+				return
+			}
+		}
+	})
+}
+
+func TestMinDiskFree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-MinDiskFree")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"20210101.log", "20210102.log", "20210103.log"} {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644), `ioutil.WriteFile should succeed`) {
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// writes to the current file (which purges the old files), and
+	// returns the names of the files that are left
+	run := func(min rotating.DiskFree) ([]string, error) {
+		f, err := rotating.NewFile(
+			ctx,
+			filepath.Join(dir, "%Y%m%d.log"),
+			rotating.WithClock(NewFakeClock(time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC))),
+			rotating.WithMinDiskFree(min),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fmt.Fprintf(f, "Hello, World\n"); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names, nil
+	}
+
+	// There is always more than 1 byte free
+	names, err := run(rotating.DiskFreeBytes(1))
+	if !assert.NoError(t, err, `writing should succeed`) {
+		return
+	}
+	if !assert.Equal(t, []string{"20210101.log", "20210102.log", "20210103.log", "20210104.log"}, names, `no files should be removed`) {
+		return
+	}
+
+	// There is never 100% free, so all of the files are removed except
+	// for the current one
+	names, err = run(rotating.DiskFreePercent(100))
+	if !assert.NoError(t, err, `writing should succeed`) {
+		return
+	}
+	if !assert.Equal(t, []string{"20210104.log"}, names, `only the current file should be kept`) {
+		return
+	}
+}
+
+func TestPurgeHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-PurgeHook")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"20210101.log", "20210103.log"} {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644), `ioutil.WriteFile should succeed`) {
+			return
+		}
+	}
+	// A non-empty directory matching the pattern cannot be removed
+	if !assert.NoError(t, os.MkdirAll(filepath.Join(dir, "20210102.log", "sub"), 0755), `os.MkdirAll should succeed`) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var calls int
+	var removed []string
+	var errs []error
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(NewFakeClock(time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC))),
+		rotating.WithRotationCount(1),
+		rotating.WithPurgeHook(func(r []string, e []error) {
+			calls++
+			removed = r
+			errs = e
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	fmt.Fprintf(f, "Hello, World\n")
+	f.Close()
+
+	if !assert.Equal(t, 1, calls, `the hook should be called once`) {
+		return
+	}
+	if !assert.Equal(t, []string{filepath.Join(dir, "20210101.log"), filepath.Join(dir, "20210103.log")}, removed, `removed files should match`) {
+		return
+	}
+	if !assert.Len(t, errs, 1, `there should be one error`) {
+		return
+	}
+	var fe *rotating.FileError
+	if !assert.True(t, errors.As(errs[0], &fe), `error should be a *FileError`) {
+		return
+	}
+	if !assert.Equal(t, rotating.OpPurge, fe.Op, `Op should match`) {
+		return
+	}
+	if !assert.Equal(t, filepath.Join(dir, "20210102.log"), fe.Path, `Path should match`) {
+		return
+	}
+}
+
+func TestMaxTotalSizeSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-MaxTotalSizeSymlink")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// The symlink is relative to its directory, and must still protect
+	// the current file
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))),
+		rotating.WithSymlink(filepath.Join(dir, "current")),
+		rotating.WithMaxTotalSize(15),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	for i := 0; i < 4; i++ {
+		if i > 0 {
+			if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+				return
+			}
+		}
+		fmt.Fprintf(f, "record %02d\n", i)
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if !assert.NoError(t, err, `os.ReadDir should succeed`) {
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !assert.Equal(t, []string{"20210101.log.2", "20210101.log.3", "current"}, names, `files should match`) {
+		return
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "current"))
+	if !assert.NoError(t, err, `the symlink should point to an existing file`) {
+		return
+	}
+	if !assert.Equal(t, "record 03\n", string(buf), `contents of the current file should match`) {
+		return
+	}
+}
+
+func TestMinDiskFreeSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-MinDiskFreeSymlink")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"20210101.log", "20210102.log", "20210103.log"} {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644), `ioutil.WriteFile should succeed`) {
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// There is never 100% free, so all of the files are removed except
+	// for the current one, which the relative symlink points to
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(NewFakeClock(time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC))),
+		rotating.WithSymlink(filepath.Join(dir, "current")),
+		rotating.WithMinDiskFree(rotating.DiskFreePercent(100)),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	fmt.Fprintf(f, "Hello, World\n")
+	if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+		return
+	}
+	fmt.Fprintf(f, "Hello, World\n")
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if !assert.NoError(t, err, `os.ReadDir should succeed`) {
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !assert.Equal(t, []string{"20210104.log.1", "current"}, names, `only the current file should be kept`) {
+		return
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "current"))
+	if !assert.NoError(t, err, `the symlink should point to an existing file`) {
+		return
+	}
+	if !assert.Equal(t, "Hello, World\n", string(buf), `contents of the current file should match`) {
+		return
+	}
+}
+
+func TestFrameReaderGenerations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-FrameReaderGenerations")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pattern := filepath.Join(dir, "%Y%m%d.log")
+	f, err := rotating.NewFile(
+		ctx,
+		pattern,
+		rotating.WithClock(NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))),
+		rotating.WithFraming(true),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	var expected []string
+	for i := 0; i < 12; i++ {
+		record := fmt.Sprintf("record %d", i)
+		expected = append(expected, record)
+		f.Write([]byte(record))
+		if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+			return
+		}
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	// Compressed files are skipped
+	if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "20210101.log.99.gz"), []byte("garbage"), 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	// The generations are read in numeric order, i.e. .log.10 comes
+	// after .log.9
+	r := rotating.NewFrameReader(pattern)
+	defer r.Close()
+
+	var payloads []string
+	for {
+		payload, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err, `r.Next should succeed`) {
+			return
+		}
+		payloads = append(payloads, string(payload))
+	}
+	if !assert.Equal(t, expected, payloads, `payloads should match`) {
+		return
+	}
+	if !assert.Zero(t, r.Unrecoverable(), `no frames should be unrecoverable`) {
+		return
+	}
+}
+
+func TestFrameResync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-FrameResync")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pattern := filepath.Join(dir, "%Y%m%d.log")
+	f, err := rotating.NewFile(
+		ctx,
+		pattern,
+		rotating.WithClock(NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))),
+		rotating.WithFraming(true),
+		rotating.WithFrameChecksum(true),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	large := strings.Repeat("x", 8192)
+	for _, record := range []string{"first", "second", large, "third"} {
+		f.Write([]byte(record))
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	// Corrupt the header of the second frame, so that it claims a
+	// gigantic size
+	fn := filepath.Join(dir, "20210101.log")
+	buf, err := ioutil.ReadFile(fn)
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	copy(buf[8+len("first"):], []byte{0xff, 0xff, 0xff, 0xff})
+	if !assert.NoError(t, ioutil.WriteFile(fn, buf, 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	readAll := func(r *rotating.FrameReader) ([]string, bool) {
+		var payloads []string
+		for {
+			payload, err := r.Next()
+			if err == io.EOF {
+				return payloads, true
+			}
+			if !assert.NoError(t, err, `r.Next should succeed`) {
+				return nil, false
+			}
+			payloads = append(payloads, string(payload))
+		}
+	}
+
+	// The reader skips the corrupted frame, and resumes reading at the
+	// next valid frame
+	r := rotating.NewFrameReader(pattern)
+	defer r.Close()
+	payloads, ok := readAll(r)
+	if !ok {
+		return
+	}
+	if !assert.Equal(t, []string{"first", large, "third"}, payloads, `payloads should match`) {
+		return
+	}
+	if !assert.Equal(t, int64(1), r.Unrecoverable(), `one frame should be unrecoverable`) {
+		return
+	}
+
+	// Frames larger than the maximum are skipped as well. Here, the
+	// large frame is skipped while looking for the frame that follows
+	// the corrupted one
+	r2 := rotating.NewFrameReader(pattern, rotating.WithMaxFrameSize(1024))
+	defer r2.Close()
+	payloads, ok = readAll(r2)
+	if !ok {
+		return
+	}
+	if !assert.Equal(t, []string{"first", "third"}, payloads, `payloads should match`) {
+		return
+	}
+	if !assert.Equal(t, int64(1), r2.Unrecoverable(), `one frame should be unrecoverable`) {
+		return
+	}
+}
+
+func TestPreopenMarker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-PreopenMarker")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pattern := filepath.Join(dir, "%Y%m%d-%H.log")
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 59, 50, 0, time.UTC))
+	newFile := func() (*rotating.File, error) {
+		return rotating.NewFile(
+			ctx,
+			pattern,
+			rotating.WithClock(clock),
+			rotating.WithMaxInterval(time.Hour),
+			rotating.WithPreopen(30*time.Second),
+		)
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+	waitPreopened := func() bool {
+		deadline := time.Now().Add(5 * time.Second)
+		for !exists("20210101-01.log") && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return assert.True(t, exists("20210101-01.log_preopen"), `the marker should exist`)
+	}
+
+	f, err := newFile()
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	fmt.Fprintf(f, "before\n")
+	if !waitPreopened() {
+		return
+	}
+
+	// The file opened ahead of time is not read until it is written to
+	r, err := rotating.NewConcatReader(pattern, time.Time{}, time.Time{})
+	if !assert.NoError(t, err, `rotating.NewConcatReader should succeed`) {
+		return
+	}
+	if !assert.Equal(t, []string{filepath.Join(dir, "20210101-00.log")}, r.Files(), `files should match`) {
+		return
+	}
+
+	// Closing the File before the boundary removes the file
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+	for _, name := range []string{"20210101-01.log", "20210101-01.log_preopen"} {
+		if !assert.False(t, exists(name), `%s should be removed`, name) {
+			return
+		}
+	}
+
+	// Once the boundary is crossed, the marker is removed
+	f, err = newFile()
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "before\n")
+	if !waitPreopened() {
+		return
+	}
+	clock.Advance(10 * time.Second)
+	fmt.Fprintf(f, "after\n")
+	if !assert.False(t, exists("20210101-01.log_preopen"), `the marker should be removed`) {
+		return
+	}
+	r, err = rotating.NewConcatReader(pattern, time.Time{}, time.Time{})
+	if !assert.NoError(t, err, `rotating.NewConcatReader should succeed`) {
+		return
+	}
+	if !assert.Equal(t, []string{filepath.Join(dir, "20210101-00.log"), filepath.Join(dir, "20210101-01.log")}, r.Files(), `files should match`) {
+		return
+	}
+}
+
+func TestSlotQuotaRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-SlotQuotaRetention")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	const msg = "0123456789\n"
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))),
+		rotating.WithSlotQuota(int64(len(msg)), rotating.QuotaOverflow),
+		rotating.WithRotationCount(1),
+		rotating.WithMaxTotalSize(1),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	// The overflow file that is being written to is neither counted
+	// nor removed by the retention policy
+	fmt.Fprint(f, msg)
+	fmt.Fprint(f, msg)
+	if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+		return
+	}
+	fmt.Fprint(f, msg)
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if !assert.NoError(t, err, `os.ReadDir should succeed`) {
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !assert.Equal(t, []string{"20210101.log.1", "20210101.log.overflow"}, names, `files should match`) {
+		return
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "20210101.log.overflow"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, msg+msg, string(buf), `contents should match`) {
+		return
+	}
+}
+
+// blockingWriter is a sink whose Close blocks until release is closed
+type blockingWriter struct {
+	bytes.Buffer
+	closing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Close() error {
+	close(w.closing)
+	<-w.release
+	return nil
+}
+
+func TestAsyncFinalization(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Only closing the first file blocks
+	release := make(chan struct{})
+	released := make(chan struct{})
+	close(released)
+	var mu sync.Mutex
+	var writers []*blockingWriter
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		"%Y%m%d-%H%M%S.log",
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithFileOpener(func(string) (io.WriteCloser, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			w := &blockingWriter{closing: make(chan struct{}), release: released}
+			if len(writers) == 0 {
+				w.release = release
+			}
+			writers = append(writers, w)
+			return w, nil
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	fmt.Fprintf(f, "first\n")
+	clock.Advance(6 * time.Second)
+
+	// The write that triggers the rotation returns while the previous
+	// file is still being closed
+	if _, err := f.Write([]byte("second\n")); !assert.NoError(t, err, `f.Write should succeed`) {
+		close(release)
+		return
+	}
+	mu.Lock()
+	first := writers[0]
+	mu.Unlock()
+	select {
+	case <-first.closing:
+	case <-time.After(5 * time.Second):
+		close(release)
+		assert.Fail(t, `timed out waiting for the previous file to be closed`)
+		return
+	}
+
+	// Close waits for the pending finalization
+	closed := make(chan error, 1)
+	go func() { closed <- f.Close() }()
+	select {
+	case <-closed:
+		close(release)
+		assert.Fail(t, `f.Close should wait for the previous file to be closed`)
+		return
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-closed:
+		if !assert.NoError(t, err, `f.Close should succeed`) {
+			return
+		}
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, `timed out waiting for f.Close`)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Len(t, writers, 2, `two files should be opened`) {
+		return
+	}
+	if !assert.Equal(t, "first\n", writers[0].String(), `contents should match`) {
+		return
+	}
+	if !assert.Equal(t, "second\n", writers[1].String(), `contents should match`) {
+		return
+	}
+}
+
+// eventWriter is a sink that records when it is closed
+type eventWriter struct {
+	name   string
+	record func(string)
+	writes bool // record the writes too
+}
+
+func (w *eventWriter) Write(p []byte) (int, error) {
+	if w.writes {
+		w.record("write " + w.name + " " + string(p))
+	}
+	return len(p), nil
+}
+
+func (w *eventWriter) Close() error {
+	// Give the next file a chance to be opened too early
+	time.Sleep(time.Millisecond)
+	w.record("close " + w.name)
+	return nil
+}
+
+func TestSynchronousRotationOrdering(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		"%Y%m%d-%H%M%S.log",
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithSynchronousRotation(true),
+		rotating.WithFileOpener(func(name string) (io.WriteCloser, error) {
+			record("open " + name)
+			return &eventWriter{name: name, record: record}, nil
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				fmt.Fprintf(f, "record\n")
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(2 * time.Millisecond)
+		clock.Advance(5 * time.Second)
+	}
+	close(done)
+	wg.Wait()
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	// Each file is closed before the next one is opened
+	mu.Lock()
+	defer mu.Unlock()
+	var current string
+	for _, event := range events {
+		if name := strings.TrimPrefix(event, "open "); name != event {
+			if !assert.Empty(t, current, `%s should be closed before %s is opened`, current, name) {
+				return
+			}
+			current = name
+			continue
+		}
+		if !assert.Equal(t, "close "+current, event, `only the current file should be closed`) {
+			return
+		}
+		current = ""
+	}
+	if !assert.Greater(t, len(events), 2, `the file should have been rotated`) {
+		return
+	}
+}
+
+// dirSyncRecorder records the directories that are synced, and fails to
+// sync them if err is set
+type dirSyncRecorder struct {
+	rotating.FileSystem
+
+	mu    sync.Mutex
+	err   error
+	syncs []string
+}
+
+func (fs *dirSyncRecorder) SyncDir(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.syncs = append(fs.syncs, name)
+	return fs.err
+}
+
+func (fs *dirSyncRecorder) synced() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]string(nil), fs.syncs...)
+}
+
+func TestDirSync(t *testing.T) {
+	newFile := func(fs *dirSyncRecorder, dir string, errs *[]error) (*rotating.File, error) {
+		var mu sync.Mutex
+		return rotating.NewFile(
+			context.Background(),
+			filepath.Join(dir, "logs", "%Y%m%d.log"),
+			rotating.WithClock(NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))),
+			rotating.WithFileSystem(fs),
+			rotating.WithSymlink(filepath.Join(dir, "current")),
+			rotating.WithDirSync(true),
+			rotating.WithErrorHandler(func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				*errs = append(*errs, err)
+			}),
+		)
+	}
+
+	t.Run("synced directories", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "rotating_test-DirSync")
+		if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		fs := &dirSyncRecorder{FileSystem: rotating.OSFileSystem()}
+		var errs []error
+		f, err := newFile(fs, dir, &errs)
+		if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+			return
+		}
+
+		fmt.Fprintf(f, "first\n")
+		if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+			return
+		}
+		if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+			return
+		}
+		if !assert.Empty(t, errs, `there should be no errors`) {
+			return
+		}
+
+		// The directory of the file is synced when each file is
+		// created, and the directory of the symlink after each update
+		logs := filepath.Join(dir, "logs")
+		expected := []string{logs, dir, logs, dir}
+		if !assert.ElementsMatch(t, expected, fs.synced(), `synced directories should match`) {
+			return
+		}
+	})
+	t.Run("failure", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "rotating_test-DirSync")
+		if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		// A file that may not survive a crash is not written to
+		fs := &dirSyncRecorder{FileSystem: rotating.OSFileSystem(), err: errors.New(`input/output error`)}
+		var errs []error
+		f, err := newFile(fs, dir, &errs)
+		if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+			return
+		}
+		defer f.Close()
+
+		_, err = f.Write([]byte("first\n"))
+		if !assert.Error(t, err, `f.Write should fail`) {
+			return
+		}
+		if !assert.Contains(t, err.Error(), `input/output error`, `the error should be reported`) {
+			return
+		}
+	})
+}
+
+func TestOpenFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-OpenFlags")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	fn := filepath.Join(dir, "20210101.log")
+	newFile := func(flags int) (*rotating.File, error) {
+		return rotating.NewFile(
+			ctx,
+			filepath.Join(dir, "%Y%m%d.log"),
+			rotating.WithClock(NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))),
+			rotating.WithOpenFlags(flags),
+		)
+	}
+	if !assert.NoError(t, ioutil.WriteFile(fn, []byte("existing\n"), 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	// O_EXCL refuses to open a file that already exists
+	f, err := newFile(os.O_EXCL)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	_, err = f.Write([]byte("excl\n"))
+	if !assert.True(t, errors.Is(err, os.ErrExist), `f.Write should fail because the file exists`) {
+		return
+	}
+	f.Close()
+
+	// O_TRUNC discards the contents of the file
+	f, err = newFile(os.O_TRUNC)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	fmt.Fprintf(f, "trunc\n")
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(fn)
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "trunc\n", string(buf), `contents should match`) {
+		return
+	}
+}
+
+func TestSynchronousRotationOpenFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	var failed bool
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		"%Y%m%d-%H%M%S.log",
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithSynchronousRotation(true),
+		rotating.WithFileFooter(func(rotating.FooterInfo) []byte {
+			return []byte("FOOTER\n")
+		}),
+		rotating.WithFileOpener(func(name string) (io.WriteCloser, error) {
+			record("open " + name)
+			if name == "20210101-000005.log" && !failed {
+				failed = true
+				return nil, errors.New(`failed to open`)
+			}
+			return &eventWriter{name: name, record: record, writes: true}, nil
+		}),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	if _, err := f.Write([]byte("a\n")); !assert.NoError(t, err, `f.Write should succeed`) {
+		return
+	}
+	clock.Advance(5 * time.Second)
+	if _, err := f.Write([]byte("b\n")); !assert.Error(t, err, `f.Write should fail when the next file cannot be opened`) {
+		return
+	}
+	// The finalized file is not written to again: the rotation is retried
+	if _, err := f.Write([]byte("c\n")); !assert.NoError(t, err, `f.Write should succeed`) {
+		return
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{
+		"open 20210101-000000.log",
+		"write 20210101-000000.log a\n",
+		"write 20210101-000000.log FOOTER\n",
+		"close 20210101-000000.log",
+		"open 20210101-000005.log",
+		"open 20210101-000005.log",
+		"write 20210101-000005.log c\n",
+		"write 20210101-000005.log FOOTER\n",
+		"close 20210101-000005.log",
+	}
+	if !assert.Equal(t, expected, events, `events should match`) {
+		return
+	}
+}
@@ -0,0 +1,430 @@
+// Package rotatingtest provides utilities for testing applications that
+// use github.com/lestrrat-go/rotating.
+package rotatingtest
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+)
+
+var (
+	errIsDir    = errors.New(`is a directory`)
+	errNotDir   = errors.New(`not a directory`)
+	errNotEmpty = errors.New(`directory not empty`)
+	errLoop     = errors.New(`too many levels of symbolic links`)
+)
+
+// MemFS is an in-memory rotating.FileSystem. Pass it to rotating.NewFile
+// using rotating.WithFileSystem, so that tests do not touch the disk,
+// and inspect the produced files using ReadFile and Files:
+//
+//	fs := rotatingtest.NewMemFS(clock)
+//	f, _ := rotating.NewFile(ctx, "/logs/%Y%m%d.log", rotating.WithFileSystem(fs))
+//	...
+//	data, _ := fs.ReadFile("/logs/20210101.log")
+//
+// Data written to a file is immediately visible through ReadFile, unless
+// the File buffers it.
+type MemFS struct {
+	clock rotating.Clock
+
+	mu    sync.Mutex
+	nodes map[string]*memNode
+}
+
+type memNode struct {
+	mode    os.FileMode
+	modTime time.Time
+	data    []byte
+	target  string // symlinks only
+}
+
+var _ rotating.FileSystem = (*MemFS)(nil)
+
+// NewMemFS creates a new, empty MemFS. The clock is used for the
+// modification times of the files, and should usually be the same
+// clock that is passed to rotating.NewFile
+func NewMemFS(clock rotating.Clock) *MemFS {
+	return &MemFS{
+		clock: clock,
+		nodes: make(map[string]*memNode),
+	}
+}
+
+// ReadFile returns the contents of the named file, following symlinks
+func (fs *MemFS) ReadFile(name string) ([]byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	node, _, err := fs.resolve(`read`, name)
+	if err != nil {
+		return nil, err
+	}
+	if node.mode.IsDir() {
+		return nil, &os.PathError{Op: `read`, Path: name, Err: errIsDir}
+	}
+	data := make([]byte, len(node.data))
+	copy(data, node.data)
+	return data, nil
+}
+
+// Files returns the names of all of the regular files, in lexical order
+func (fs *MemFS) Files() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var names []string
+	for name, node := range fs.nodes {
+		if node.mode.IsRegular() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (fs *MemFS) OpenFile(name string, flag int, perm os.FileMode) (rotating.FileHandle, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	node, resolved, err := fs.resolve(`open`, name)
+	switch {
+	case err == nil:
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, &os.PathError{Op: `open`, Path: name, Err: os.ErrExist}
+		}
+		if node.mode.IsDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return nil, &os.PathError{Op: `open`, Path: name, Err: errIsDir}
+		}
+		if flag&os.O_TRUNC != 0 {
+			node.data = nil
+			node.modTime = fs.clock.Now()
+		}
+	case os.IsNotExist(err) && flag&os.O_CREATE != 0:
+		if err := fs.checkParent(`open`, resolved); err != nil {
+			return nil, err
+		}
+		node = &memNode{mode: perm &^ os.ModeType, modTime: fs.clock.Now()}
+		fs.nodes[resolved] = node
+	default:
+		return nil, err
+	}
+
+	h := &memHandle{fs: fs, node: node, flag: flag}
+	if flag&os.O_APPEND != 0 {
+		h.offset = int64(len(node.data))
+	}
+	return h, nil
+}
+
+func (fs *MemFS) Stat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	node, resolved, err := fs.resolve(`stat`, name)
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(resolved, node), nil
+}
+
+func (fs *MemFS) Lstat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	name = clean(name)
+	node, ok := fs.lookup(name)
+	if !ok {
+		return nil, &os.PathError{Op: `lstat`, Path: name, Err: os.ErrNotExist}
+	}
+	return newFileInfo(name, node), nil
+}
+
+func (fs *MemFS) Glob(pattern string) ([]string, error) {
+	// Validate the pattern, as filepath.Glob does
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var matches []string
+	for name := range fs.nodes {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (fs *MemFS) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	name = clean(name)
+	node, ok := fs.nodes[name]
+	if !ok {
+		return &os.PathError{Op: `remove`, Path: name, Err: os.ErrNotExist}
+	}
+	if node.mode.IsDir() {
+		prefix := name + string(filepath.Separator)
+		for other := range fs.nodes {
+			if strings.HasPrefix(other, prefix) {
+				return &os.PathError{Op: `remove`, Path: name, Err: errNotEmpty}
+			}
+		}
+	}
+	delete(fs.nodes, name)
+	return nil
+}
+
+func (fs *MemFS) Rename(oldpath, newpath string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	oldpath = clean(oldpath)
+	newpath = clean(newpath)
+	node, ok := fs.nodes[oldpath]
+	if !ok {
+		return &os.LinkError{Op: `rename`, Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if err := fs.checkParent(`rename`, newpath); err != nil {
+		return err
+	}
+	if node.mode.IsDir() {
+		prefix := oldpath + string(filepath.Separator)
+		for other, child := range fs.nodes {
+			if strings.HasPrefix(other, prefix) {
+				delete(fs.nodes, other)
+				fs.nodes[newpath+other[len(oldpath):]] = child
+			}
+		}
+	}
+	delete(fs.nodes, oldpath)
+	fs.nodes[newpath] = node
+	return nil
+}
+
+func (fs *MemFS) Symlink(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	newname = clean(newname)
+	if _, ok := fs.lookup(newname); ok {
+		return &os.LinkError{Op: `symlink`, Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	if err := fs.checkParent(`symlink`, newname); err != nil {
+		return err
+	}
+	fs.nodes[newname] = &memNode{
+		mode:    os.ModeSymlink | 0777,
+		modTime: fs.clock.Now(),
+		target:  oldname,
+	}
+	return nil
+}
+
+func (fs *MemFS) Readlink(name string) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	name = clean(name)
+	node, ok := fs.nodes[name]
+	if !ok {
+		return "", &os.PathError{Op: `readlink`, Path: name, Err: os.ErrNotExist}
+	}
+	if node.mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: `readlink`, Path: name, Err: os.ErrInvalid}
+	}
+	return node.target, nil
+}
+
+func (fs *MemFS) MkdirAll(path string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	path = clean(path)
+	var dirs []string
+	for p := path; !isRoot(p); p = filepath.Dir(p) {
+		dirs = append(dirs, p)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		node, ok := fs.nodes[dirs[i]]
+		if !ok {
+			fs.nodes[dirs[i]] = &memNode{mode: os.ModeDir | perm, modTime: fs.clock.Now()}
+			continue
+		}
+		if !node.mode.IsDir() {
+			return &os.PathError{Op: `mkdir`, Path: dirs[i], Err: errNotDir}
+		}
+	}
+	return nil
+}
+
+// lookup must be called while holding the lock
+func (fs *MemFS) lookup(name string) (*memNode, bool) {
+	if isRoot(name) {
+		return &memNode{mode: os.ModeDir | 0755}, true
+	}
+	node, ok := fs.nodes[name]
+	return node, ok
+}
+
+// resolve looks up the node for name, following symlinks. It returns
+// the resolved name even if the node does not exist.
+// It must be called while holding the lock
+func (fs *MemFS) resolve(op, name string) (*memNode, string, error) {
+	name = clean(name)
+	for i := 0; i < 16; i++ {
+		node, ok := fs.lookup(name)
+		if !ok {
+			return nil, name, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+		if node.mode&os.ModeSymlink == 0 {
+			return node, name, nil
+		}
+		target := node.target
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(name), target)
+		}
+		name = clean(target)
+	}
+	return nil, name, &os.PathError{Op: op, Path: name, Err: errLoop}
+}
+
+// checkParent must be called while holding the lock
+func (fs *MemFS) checkParent(op, name string) error {
+	parent, ok := fs.lookup(filepath.Dir(name))
+	if !ok {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	if !parent.mode.IsDir() {
+		return &os.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return nil
+}
+
+func clean(name string) string {
+	return filepath.Clean(name)
+}
+
+func isRoot(name string) bool {
+	return name == "." || filepath.Dir(name) == name
+}
+
+// memHandle is an open file in a MemFS
+type memHandle struct {
+	fs     *MemFS
+	node   *memNode
+	flag   int
+	offset int64
+	closed bool
+}
+
+func (h *memHandle) Read(p []byte) (int, error) {
+	h.fs.mu.Lock()
+	defer h.fs.mu.Unlock()
+
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	if h.offset >= int64(len(h.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, h.node.data[h.offset:])
+	h.offset += int64(n)
+	return n, nil
+}
+
+func (h *memHandle) Write(p []byte) (int, error) {
+	h.fs.mu.Lock()
+	defer h.fs.mu.Unlock()
+
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	if h.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, &os.PathError{Op: `write`, Err: os.ErrPermission}
+	}
+	if h.flag&os.O_APPEND != 0 {
+		h.offset = int64(len(h.node.data))
+	}
+
+	end := h.offset + int64(len(p))
+	if end > int64(len(h.node.data)) {
+		data := make([]byte, end)
+		copy(data, h.node.data)
+		h.node.data = data
+	}
+	copy(h.node.data[h.offset:], p)
+	h.offset = end
+	h.node.modTime = h.fs.clock.Now()
+	return len(p), nil
+}
+
+func (h *memHandle) Seek(offset int64, whence int) (int64, error) {
+	h.fs.mu.Lock()
+	defer h.fs.mu.Unlock()
+
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += h.offset
+	case io.SeekEnd:
+		offset += int64(len(h.node.data))
+	default:
+		return 0, os.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	h.offset = offset
+	return offset, nil
+}
+
+func (h *memHandle) Close() error {
+	h.fs.mu.Lock()
+	defer h.fs.mu.Unlock()
+
+	if h.closed {
+		return os.ErrClosed
+	}
+	h.closed = true
+	return nil
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func newFileInfo(name string, node *memNode) *fileInfo {
+	return &fileInfo{
+		name:    filepath.Base(name),
+		size:    int64(len(node.data)),
+		mode:    node.mode,
+		modTime: node.modTime,
+	}
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,144 @@
+package rotatingtest_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/lestrrat-go/rotating/rotatingtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestMemFS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// The directory does not exist on disk, and is never created
+	const dir = "/rotatingtest-nonexistent"
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	fs := rotatingtest.NewMemFS(clock)
+	f, err := rotating.NewFile(
+		ctx,
+		dir+"/%Y%m%d-%H%M%S.log",
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(5*time.Second),
+		rotating.WithRotationCount(3),
+		rotating.WithSymlink(dir+"/current"),
+		rotating.WithSynchronousRotation(true),
+		rotating.WithFileSystem(fs),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(f, "record %d\n", i)
+
+		// Written data is visible immediately
+		data, err := fs.ReadFile(fmt.Sprintf("%s/20210101-0000%02d.log", dir, i*5))
+		if !assert.NoError(t, err, `fs.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, fmt.Sprintf("record %d\n", i), string(data), `content should match`) {
+			return
+		}
+		clock.now = clock.now.Add(6 * time.Second)
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	if !assert.Equal(t, []string{dir + "/20210101-000000.log", dir + "/20210101-000005.log", dir + "/20210101-000010.log"}, fs.Files(), `files should match`) {
+		return
+	}
+	data, err := fs.ReadFile(dir + "/current")
+	if !assert.NoError(t, err, `fs.ReadFile should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "record 2\n", string(data), `symlink should point to the last file`) {
+		return
+	}
+	if _, err := os.Stat(dir); !assert.True(t, os.IsNotExist(err), `directory should not exist on disk`) {
+		return
+	}
+}
+
+func TestMemFSOperations(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	fs := rotatingtest.NewMemFS(clock)
+
+	_, err := fs.OpenFile("/a/b.log", os.O_CREATE|os.O_WRONLY, 0644)
+	if !assert.True(t, os.IsNotExist(err), `opening a file in a missing directory should fail`) {
+		return
+	}
+
+	if !assert.NoError(t, fs.MkdirAll("/a", 0755), `fs.MkdirAll should succeed`) {
+		return
+	}
+	fh, err := fs.OpenFile("/a/b.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if !assert.NoError(t, err, `fs.OpenFile should succeed`) {
+		return
+	}
+	fh.Write([]byte("hello"))
+	fh.Close()
+
+	_, err = fs.OpenFile("/a/b.log", os.O_CREATE|os.O_EXCL, 0644)
+	if !assert.True(t, os.IsExist(err), `O_EXCL should fail for existing files`) {
+		return
+	}
+
+	fi, err := fs.Stat("/a/b.log")
+	if !assert.NoError(t, err, `fs.Stat should succeed`) {
+		return
+	}
+	if !assert.Equal(t, int64(5), fi.Size(), `size should match`) {
+		return
+	}
+
+	if !assert.NoError(t, fs.Symlink("b.log", "/a/link"), `fs.Symlink should succeed`) {
+		return
+	}
+	fi, err = fs.Lstat("/a/link")
+	if !assert.NoError(t, err, `fs.Lstat should succeed`) {
+		return
+	}
+	if !assert.Equal(t, os.ModeSymlink, fi.Mode()&os.ModeSymlink, `link should be a symlink`) {
+		return
+	}
+
+	if !assert.NoError(t, fs.Rename("/a/b.log", "/a/c.log"), `fs.Rename should succeed`) {
+		return
+	}
+	if _, err := fs.Stat("/a/link"); !assert.True(t, os.IsNotExist(err), `dangling symlink should not be followed`) {
+		return
+	}
+
+	matches, err := fs.Glob("/a/*")
+	if !assert.NoError(t, err, `fs.Glob should succeed`) {
+		return
+	}
+	if !assert.Equal(t, []string{"/a/c.log", "/a/link"}, matches, `matches should match`) {
+		return
+	}
+
+	if !assert.Error(t, fs.Remove("/a"), `removing a non-empty directory should fail`) {
+		return
+	}
+	if !assert.NoError(t, fs.Remove("/a/c.log"), `fs.Remove should succeed`) {
+		return
+	}
+	if _, err := fs.ReadFile("/a/c.log"); !assert.True(t, os.IsNotExist(err), `removed file should not exist`) {
+		return
+	}
+}
@@ -0,0 +1,171 @@
+package rotating
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RotationReason specifies why the File rotated to another file
+type RotationReason int
+
+const (
+	// RotationSize means that the file reached the size given by
+	// WithMaxFileSize or WithMaxUncompressedSize (or was found to have
+	// been truncated, or removed)
+	RotationSize RotationReason = iota
+	// RotationInterval means that the time slot given by
+	// WithMaxInterval ended
+	RotationInterval
+	// RotationManual means that Rotate was called
+	RotationManual
+)
+
+func (r RotationReason) String() string {
+	switch r {
+	case RotationSize:
+		return `size`
+	case RotationInterval:
+		return `interval`
+	case RotationManual:
+		return `manual`
+	default:
+		return fmt.Sprintf(`RotationReason(%d)`, int(r))
+	}
+}
+
+// RotationInfo describes a rotation, and is passed to the function
+// specified by WithRotateHook
+type RotationInfo struct {
+	// Previous is the name of the file that was rotated out. With
+	// WithCompress or WithCompressor, it is the name of the compressed
+	// file, unless the compression failed
+	Previous string
+	// Filename is the name of the file that is written to from now on. It
+	// is empty if the previous file was finished by a Scheduler, in which
+	// case the next file is opened by the next write
+	Filename string
+	// Reason is the reason for the rotation
+	Reason RotationReason
+	// Time is the time of the rotation, according to the Clock
+	Time time.Time
+}
+
+// Rotate switches to a new file regardless of the size of the current
+// file and the time, e.g. in response to SIGHUP. If the time slot has not
+// changed, the new file is the next generation of the current slot, i.e.
+// the generation is appended to its name as if the file had reached the
+// size given by WithMaxFileSize.
+//
+// Rotate does nothing when WithPassthrough is in effect, and returns
+// ErrClosed after the File has been closed.
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if f.passthrough != nil {
+		return nil
+	}
+	return f.rotate(f.ctx, RotationManual)
+}
+
+// rotate switches to the first file of the current time slot if the slot
+// has changed, or to the next generation in the same slot otherwise.
+// It must be called while holding the lock
+func (f *File) rotate(ctx context.Context, reason RotationReason) error {
+	prevBaseTime, prevGeneration := f.baseTime, f.generation
+	baseTime := truncate(f.clock.Now(), f.maxInterval)
+	fn := f.pattern.FormatString(baseTime)
+	if !f.baseTime.Equal(baseTime) {
+		f.baseTime = baseTime
+		f.endSlot()
+		f.generation = 0
+	} else if f.filename != "" { // We are still writing to the same "time slot"
+		f.generation++
+		fn = fmt.Sprintf("%s.%d", fn, f.generation)
+	}
+
+	if err := f.rotateFile(ctx, fn, reason); err != nil {
+		if f.sealed {
+			// The rotation is retried upon the next write, which must
+			// choose the same file
+			f.baseTime, f.generation = prevBaseTime, prevGeneration
+		}
+		return err
+	}
+	return nil
+}
+
+// sealFile schedules the tasks for the file that has been rotated out:
+// compressing it as specified by WithCompress or WithCompressor (in the
+// compression workers), handing the resulting file over to the Archiver
+// specified by WithArchiver (in the archive worker), and calling the
+// function specified by WithRotateHook with its name.
+// Because the previous file is finalized by a task that has been
+// scheduled earlier, it is complete by the time these tasks run.
+// It must be called while holding the lock
+func (f *File) sealFile(previous, filename string, reason RotationReason) {
+	hook := f.rotateHook
+	pool := f.compression
+	archiving := f.archiving
+	if (hook == nil && pool == nil && archiving == nil) || previous == "" {
+		return
+	}
+
+	if archiving != nil {
+		// Keep the file from being purged until it has been archived
+		f.markUnarchived(previous)
+	}
+
+	info := RotationInfo{
+		Previous: previous,
+		Filename: filename,
+		Reason:   reason,
+		Time:     f.clock.Now(),
+	}
+	notify := func(name string) {
+		if hook != nil {
+			info.Previous = name
+			hook(info)
+		}
+	}
+	// seal archives the file, and calls the hook
+	seal := func(name string) error {
+		if archiving == nil {
+			notify(name)
+			return nil
+		}
+		archiving.push(func() error {
+			err := f.archive(previous, name)
+			notify(name)
+			return err
+		})
+		return nil
+	}
+
+	if pool == nil {
+		f.schedule(func() error {
+			return seal(previous)
+		})
+		return
+	}
+
+	// The file is handed over to the compression workers once it has
+	// been finalized
+	f.schedule(func() error {
+		pool.push(func() error {
+			name, err := f.compress(previous)
+			if err != nil {
+				f.handleError(fileError(OpCompress, previous, err))
+			}
+			if name == "" {
+				name = previous
+			}
+			return seal(name)
+		})
+		return nil
+	})
+}
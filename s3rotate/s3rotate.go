@@ -0,0 +1,144 @@
+// Package s3rotate uploads the files that have been rotated out by a
+// *rotating.File to Amazon S3, or to a compatible store.
+//
+// The package does not depend on an AWS SDK. Instead, the Uploader uses
+// the small Client interface, which the S3 client of the SDK that the
+// application already uses can be adapted to, e.g. for aws-sdk-go-v2:
+//
+//	type client struct {
+//		*s3.Client
+//	}
+//
+//	func (c client) PutObject(ctx context.Context, bucket, key string, body io.ReadSeeker, size int64) error {
+//		_, err := c.Client.PutObject(ctx, &s3.PutObjectInput{
+//			Bucket:        aws.String(bucket),
+//			Key:           aws.String(key),
+//			Body:          body,
+//			ContentLength: aws.Int64(size),
+//		})
+//		return err
+//	}
+package s3rotate
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+)
+
+// Client uploads objects to S3
+type Client interface {
+	PutObject(ctx context.Context, bucket, key string, body io.ReadSeeker, size int64) error
+}
+
+// Options configures the Uploader
+type Options struct {
+	// Prefix is prepended to the base names of the files to form the
+	// keys of the objects, e.g. "logs/app/"
+	Prefix string
+
+	// DeleteLocal specifies that files are removed once they have been
+	// uploaded successfully
+	DeleteLocal bool
+
+	// Timeout bounds the time spent uploading each file. If zero, the
+	// uploads are not bounded
+	Timeout time.Duration
+
+	// ErrorHandler is called with the errors that occur while uploading
+	// the files handed over by RotateHook. If nil, they are discarded
+	ErrorHandler func(error)
+}
+
+// Uploader uploads files to a bucket
+type Uploader struct {
+	client      Client
+	bucket      string
+	prefix      string
+	deleteLocal bool
+	timeout     time.Duration
+	onError     func(error)
+}
+
+// New creates a new Uploader that uploads files to the given bucket
+// using client. If opts is nil, the default options are used.
+func New(client Client, bucket string, opts *Options) *Uploader {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	return &Uploader{
+		client:      client,
+		bucket:      bucket,
+		prefix:      opts.Prefix,
+		deleteLocal: opts.DeleteLocal,
+		timeout:     opts.Timeout,
+		onError:     opts.ErrorHandler,
+	}
+}
+
+// Key returns the key of the object that the given file is uploaded to
+func (u *Uploader) Key(filename string) string {
+	return u.prefix + filepath.Base(filename)
+}
+
+// Upload uploads the given file, and removes it afterwards if
+// DeleteLocal was specified
+func (u *Uploader) Upload(ctx context.Context, filename string) error {
+	if u.timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, u.timeout)
+		defer cancel()
+	}
+
+	fh, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrapf(err, `s3rotate: failed to open file %s`, filename)
+	}
+	defer fh.Close()
+
+	fi, err := fh.Stat()
+	if err != nil {
+		return errors.Wrapf(err, `s3rotate: failed to stat file %s`, filename)
+	}
+
+	key := u.Key(filename)
+	if err := u.client.PutObject(ctx, u.bucket, key, fh, fi.Size()); err != nil {
+		return errors.Wrapf(err, `s3rotate: failed to upload file %s to s3://%s/%s`, filename, u.bucket, key)
+	}
+
+	if u.deleteLocal {
+		if err := os.Remove(filename); err != nil {
+			return errors.Wrapf(err, `s3rotate: failed to remove uploaded file %s`, filename)
+		}
+	}
+	return nil
+}
+
+// RotateHook uploads the file that has been rotated out. Pass it to
+// rotating.WithRotateHook to upload each file once it is complete:
+//
+//	f, err := rotating.NewFile(ctx, pattern, rotating.WithRotateHook(uploader.RotateHook))
+//
+// The upload is performed synchronously by the goroutine that calls the
+// hook, so the background tasks of the File that follow it (e.g. purging
+// old files) wait for it.
+func (u *Uploader) RotateHook(info rotating.RotationInfo) {
+	if err := u.Upload(context.Background(), info.Previous); err != nil && u.onError != nil {
+		u.onError(err)
+	}
+}
+
+// Archive uploads the given file. It implements rotating.Archiver, so the
+// Uploader can be passed to rotating.WithArchiver, which keeps the files
+// from being purged until they have been uploaded:
+//
+//	f, err := rotating.NewFile(ctx, pattern, rotating.WithArchiver(uploader))
+func (u *Uploader) Archive(ctx context.Context, filename string) error {
+	return u.Upload(ctx, filename)
+}
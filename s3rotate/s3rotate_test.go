@@ -0,0 +1,119 @@
+package s3rotate_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/lestrrat-go/rotating/s3rotate"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClient struct {
+	mu      sync.Mutex
+	objects map[string]string
+	fail    bool
+}
+
+func (c *fakeClient) PutObject(ctx context.Context, bucket, key string, body io.ReadSeeker, size int64) error {
+	if c.fail {
+		return errors.New(`access denied`)
+	}
+
+	buf, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if int64(len(buf)) != size {
+		return errors.Errorf(`expected %d bytes, got %d`, size, len(buf))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objects[bucket+"/"+key] = string(buf)
+	return nil
+}
+
+var _ rotating.Archiver = (*s3rotate.Uploader)(nil)
+
+func TestUploader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3rotate_test")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	client := &fakeClient{objects: make(map[string]string)}
+	var errs []error
+	uploader := s3rotate.New(client, "bucket", &s3rotate.Options{
+		Prefix:       "logs/",
+		DeleteLocal:  true,
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d.log"),
+		rotating.WithClock(rotating.ClockFn(func() time.Time {
+			return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		})),
+		rotating.WithRotateHook(uploader.RotateHook),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+
+	fmt.Fprintf(f, "Hello, World\n")
+	if !assert.NoError(t, f.Rotate(), `f.Rotate should succeed`) {
+		return
+	}
+	if !assert.NoError(t, f.Close(), `f.Close should succeed`) {
+		return
+	}
+
+	if !assert.Empty(t, errs, `there should be no errors`) {
+		return
+	}
+	filename := filepath.Join(dir, "20210101.log")
+	expected := map[string]string{
+		"bucket/logs/20210101.log": "Hello, World\n",
+	}
+	if !assert.Equal(t, expected, client.objects, `uploaded objects should match`) {
+		return
+	}
+	if _, err := os.Stat(filename); !assert.True(t, os.IsNotExist(err), `the uploaded file should have been removed`) {
+		return
+	}
+}
+
+func TestUploaderError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3rotate_test-Error")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log")
+	if !assert.NoError(t, ioutil.WriteFile(filename, []byte("Hello, World\n"), 0644), `ioutil.WriteFile should succeed`) {
+		return
+	}
+
+	uploader := s3rotate.New(&fakeClient{fail: true}, "bucket", &s3rotate.Options{DeleteLocal: true})
+	if !assert.Error(t, uploader.Upload(context.Background(), filename), `uploader.Upload should fail`) {
+		return
+	}
+	if _, err := os.Stat(filename); !assert.NoError(t, err, `the file should be kept if the upload failed`) {
+		return
+	}
+}
@@ -0,0 +1,252 @@
+package rotating
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// defaultSchedulerInterval is the interval at which a Scheduler performs
+// the periodic maintenance of its Files, if none was specified
+const defaultSchedulerInterval = time.Second
+
+// Scheduler performs the maintenance of many Files using a fixed number
+// of goroutines and a single timer, instead of the goroutine and timers
+// that each File otherwise uses. Files use a Scheduler when one is
+// specified using WithScheduler, and a Manager creates one for its Files
+// automatically.
+//
+// The maintenance tasks of the Files (finalizing rotated files, updating
+// symlinks, and purging old files) are executed by the worker goroutines
+// of the Scheduler, in the order they were scheduled for each File.
+// In addition, at every interval the Scheduler
+//
+//   - checks the sizes of the files that have a maximum size, so that
+//     they are rotated upon the next write, instead of having the write
+//     path check them (see WithCheckInterval)
+//   - finishes the files whose interval has elapsed (the footer is
+//     written, and the file is closed) instead of waiting for the next
+//     write to do so. The next file is created upon the next write
+//   - releases the file handles that have been idle for longer than the
+//     duration specified by WithIdleTimeout
+type Scheduler struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	files    map[*File]struct{}
+	ready    []*taskQueue
+	closed   bool
+	done     chan struct{}
+	wg       sync.WaitGroup
+	interval time.Duration
+}
+
+// NewScheduler creates a new Scheduler that performs the periodic
+// maintenance every interval (one second if interval is not positive),
+// and executes the maintenance tasks using the given number of worker
+// goroutines (GOMAXPROCS if workers is not positive).
+//
+// Close must be called to stop the goroutines once the Scheduler is no
+// longer needed.
+func NewScheduler(interval time.Duration, workers int) *Scheduler {
+	if interval <= 0 {
+		interval = defaultSchedulerInterval
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	s := &Scheduler{
+		files:    make(map[*File]struct{}),
+		done:     make(chan struct{}),
+		interval: interval,
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	s.wg.Add(workers + 1)
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	go s.loop()
+	return s
+}
+
+// Close stops the Scheduler, after executing the pending maintenance
+// tasks. Files that still use the Scheduler execute their maintenance
+// tasks synchronously from then on.
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Scheduler) register(f *File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[f] = struct{}{}
+}
+
+func (s *Scheduler) unregister(f *File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, f)
+}
+
+// enqueue marks the queue as ready to be processed by the workers. It
+// returns false if the Scheduler has been closed
+func (s *Scheduler) enqueue(q *taskQueue) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.ready = append(s.ready, q)
+	s.cond.Signal()
+	return true
+}
+
+func (s *Scheduler) work() {
+	defer s.wg.Done()
+	for {
+		s.mu.Lock()
+		for len(s.ready) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.ready) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		q := s.ready[0]
+		s.ready = s.ready[1:]
+		s.mu.Unlock()
+
+		q.run()
+	}
+}
+
+func (s *Scheduler) loop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+// sweep performs the periodic maintenance of all Files
+func (s *Scheduler) sweep() {
+	s.mu.Lock()
+	files := make([]*File, 0, len(s.files))
+	for f := range s.files {
+		files = append(files, f)
+	}
+	s.mu.Unlock()
+
+	for _, f := range files {
+		f.sweep()
+	}
+}
+
+// sweep performs the periodic maintenance of the file on behalf of the
+// Scheduler
+func (f *File) sweep() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.ctx.Err() != nil || f.passthrough != nil || f.filename == "" {
+		return
+	}
+
+	// Finish the file once its interval has elapsed, instead of waiting
+	// for the next write to rotate it
+	if f.intervalExceeded() {
+		f.endSlot()
+		f.writeFooter("")
+		if f.file != nil {
+			f.finalizeAsync(f.file, f.filename)
+			f.file = nil
+		}
+		// The next file is opened by the next write
+		f.sealFile(f.filename, "", RotationInterval)
+		f.filename = ""
+		f.activeName.Store("")
+		f.oversized = false
+		return
+	}
+
+	if f.checkInterval > 0 && !f.oversized {
+		f.oversized = f.checkSize()
+	}
+
+	if f.idleTimeout > 0 && f.file != nil && time.Since(f.lastActive) >= f.idleTimeout {
+		f.releaseFile()
+	}
+}
+
+// taskQueue holds the maintenance tasks of a File that uses a Scheduler
+type taskQueue struct {
+	scheduler *Scheduler
+	onError   func(error)
+	mu        sync.Mutex
+	cond      *sync.Cond
+	tasks     []func() error
+	running   bool
+}
+
+// push appends a task to the queue, and hands the queue over to the
+// workers of the Scheduler if it is not already being processed
+func (q *taskQueue) push(task func() error) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, task)
+	if q.running {
+		q.mu.Unlock()
+		return
+	}
+	q.running = true
+	q.mu.Unlock()
+
+	if !q.scheduler.enqueue(q) {
+		q.run()
+	}
+}
+
+// run executes the tasks in the queue until it is empty
+func (q *taskQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.tasks) == 0 {
+			q.running = false
+			q.cond.Broadcast()
+			q.mu.Unlock()
+			return
+		}
+		task := q.tasks[0]
+		q.tasks = q.tasks[1:]
+		q.mu.Unlock()
+
+		if err := task(); err != nil {
+			q.onError(err)
+		}
+	}
+}
+
+// wait waits for the pending tasks to complete
+func (q *taskQueue) wait() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.running {
+		q.cond.Wait()
+	}
+}
@@ -0,0 +1,234 @@
+package rotating_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-Scheduler")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := rotating.NewScheduler(10*time.Millisecond, 2)
+	defer s.Close()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	footer := func(info rotating.FooterInfo) []byte {
+		return []byte(fmt.Sprintf("-- %d records --\n", info.Records))
+	}
+
+	sized, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "sized-%Y%m%d.log"),
+		rotating.WithClock(clock),
+		rotating.WithMaxInterval(24*time.Hour),
+		rotating.WithMaxFileSize(10),
+		rotating.WithScheduler(s),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer sized.Close()
+
+	timed, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "timed-%Y%m%d%H.log"),
+		rotating.WithClock(clock),
+		rotating.WithFileFooter(footer),
+		rotating.WithScheduler(s),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer timed.Close()
+
+	if _, err := sized.Write([]byte("0123456789\n")); !assert.NoError(t, err, `sized.Write should succeed`) {
+		return
+	}
+	if _, err := timed.Write([]byte("hello\n")); !assert.NoError(t, err, `timed.Write should succeed`) {
+		return
+	}
+
+	// The scheduler finishes the file once its interval has elapsed,
+	// without waiting for the next write
+	clock.Advance(time.Hour)
+	readFile := func(name string) string {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		return string(data)
+	}
+	if !assert.Eventually(t, func() bool {
+		return readFile("timed-2021010100.log") == "hello\n-- 1 records --\n"
+	}, 5*time.Second, 10*time.Millisecond, `footer should be written by the scheduler`) {
+		return
+	}
+
+	// The size of the file has been checked by the scheduler, so the
+	// next write goes to a new file
+	time.Sleep(50 * time.Millisecond)
+	if _, err := sized.Write([]byte("next\n")); !assert.NoError(t, err, `sized.Write should succeed`) {
+		return
+	}
+	if !assert.NoError(t, sized.Close(), `sized.Close should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "next\n", readFile("sized-20210101.log.1"), `next file should have been created`) {
+		return
+	}
+
+	if _, err := timed.Write([]byte("world\n")); !assert.NoError(t, err, `timed.Write should succeed`) {
+		return
+	}
+	if !assert.NoError(t, timed.Close(), `timed.Close should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "world\n-- 1 records --\n", readFile("timed-2021010101.log"), `next file should have been created`) {
+		return
+	}
+	if !assert.Equal(t, "hello\n-- 1 records --\n", readFile("timed-2021010100.log"), `previous file should be untouched`) {
+		return
+	}
+}
+
+// newScheduledFile creates a File that is maintained by a Scheduler, with
+// hourly files, and writes to the first one
+func newScheduledFile(t *testing.T, ctx context.Context, dir string, clock *fakeClock, options ...rotating.Option) (*rotating.File, *rotating.Scheduler, bool) {
+	s := rotating.NewScheduler(10*time.Millisecond, 1)
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d%H.log"),
+		append([]rotating.Option{rotating.WithClock(clock), rotating.WithScheduler(s)}, options...)...,
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		s.Close()
+		return nil, nil, false
+	}
+	if _, err := f.Write([]byte("hello\n")); !assert.NoError(t, err, `f.Write should succeed`) {
+		f.Close()
+		s.Close()
+		return nil, nil, false
+	}
+	return f, s, true
+}
+
+func TestSchedulerArchiver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-SchedulerArchiver")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var archived []string
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, s, ok := newScheduledFile(t, ctx, dir, clock, rotating.WithArchiver(rotating.ArchiverFunc(func(_ context.Context, path string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		archived = append(archived, filepath.Base(path))
+		return nil
+	})))
+	if !ok {
+		return
+	}
+	defer s.Close()
+	defer f.Close()
+
+	// The file finished by the scheduler is archived without another write
+	clock.Advance(time.Hour)
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(archived) == 1 && archived[0] == "2021010100.log"
+	}, 5*time.Second, 10*time.Millisecond, `the file should be archived`)
+}
+
+func TestSchedulerRotateHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-SchedulerRotateHook")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var rotations []rotating.RotationInfo
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, s, ok := newScheduledFile(t, ctx, dir, clock, rotating.WithRotateHook(func(info rotating.RotationInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		rotations = append(rotations, info)
+	}))
+	if !ok {
+		return
+	}
+	defer s.Close()
+	defer f.Close()
+
+	clock.Advance(time.Hour)
+	if !assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(rotations) == 1
+	}, 5*time.Second, 10*time.Millisecond, `the hook should be called`) {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Equal(t, filepath.Join(dir, "2021010100.log"), rotations[0].Previous, `Previous should match`) {
+		return
+	}
+	if !assert.Equal(t, rotating.RotationInterval, rotations[0].Reason, `Reason should match`) {
+		return
+	}
+}
+
+func TestSchedulerCompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-SchedulerCompress")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, s, ok := newScheduledFile(t, ctx, dir, clock, rotating.WithCompress(true))
+	if !ok {
+		return
+	}
+	defer s.Close()
+	defer f.Close()
+
+	clock.Advance(time.Hour)
+	filename := filepath.Join(dir, "2021010100.log")
+	if !assert.Eventually(t, func() bool {
+		_, err := os.Stat(filename)
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond, `the file should be compressed`) {
+		return
+	}
+	if !assert.Equal(t, "hello\n", readGzip(t, filename+".gz"), `contents of the compressed file should match`) {
+		return
+	}
+}
@@ -0,0 +1,3 @@
+// Package slogrotate provides an slog.Handler that writes structured
+// log records to a *rotating.File. It requires Go 1.21 or later.
+package slogrotate
@@ -0,0 +1,103 @@
+//go:build go1.21
+// +build go1.21
+
+package slogrotate
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/lestrrat-go/rotating"
+)
+
+// Format specifies the format of the records written by the Handler
+type Format int
+
+const (
+	// FormatJSON writes records using slog.JSONHandler
+	FormatJSON Format = iota
+	// FormatText writes records using slog.TextHandler
+	FormatText
+)
+
+// Options configures the Handler
+type Options struct {
+	slog.HandlerOptions
+
+	// Format specifies the format of the records
+	Format Format
+
+	// FlushLevel specifies the minimum level of records that cause the
+	// file to be flushed immediately after being written. This is only
+	// meaningful if the file buffers writes (see rotating.WithBufferSize).
+	// If nil, records are never flushed explicitly
+	FlushLevel slog.Leveler
+}
+
+// Handler is an slog.Handler that writes to a *rotating.File. Each record
+// is written using a single call to Write, so records are never split
+// across files, and buffered records are flushed to the previous file
+// when the file is rotated.
+type Handler struct {
+	file       *rotating.File
+	flushLevel slog.Leveler
+	handler    slog.Handler
+}
+
+// New creates a new Handler that writes to f. If opts is nil, the
+// default options are used.
+func New(f *rotating.File, opts *Options) *Handler {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	var h slog.Handler
+	switch opts.Format {
+	case FormatText:
+		h = slog.NewTextHandler(f, &opts.HandlerOptions)
+	default:
+		h = slog.NewJSONHandler(f, &opts.HandlerOptions)
+	}
+
+	return &Handler{
+		file:       f,
+		flushLevel: opts.FlushLevel,
+		handler:    h,
+	}
+}
+
+// Enabled reports whether the handler handles records at the given level
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle writes the record to the file
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if err := h.handler.Handle(ctx, r); err != nil {
+		return err
+	}
+
+	if h.flushLevel != nil && r.Level >= h.flushLevel.Level() {
+		return h.file.Flush()
+	}
+	return nil
+}
+
+// WithAttrs returns a new Handler whose records include the given attributes
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(h.handler.WithAttrs(attrs))
+}
+
+// WithGroup returns a new Handler that qualifies the attributes with the
+// given group name
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return h.with(h.handler.WithGroup(name))
+}
+
+func (h *Handler) with(handler slog.Handler) *Handler {
+	return &Handler{
+		file:       h.file,
+		flushLevel: h.flushLevel,
+		handler:    handler,
+	}
+}
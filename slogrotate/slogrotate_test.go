@@ -0,0 +1,80 @@
+//go:build go1.21
+// +build go1.21
+
+package slogrotate_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/lestrrat-go/rotating/slogrotate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slogrotate_test")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "app.log"),
+		rotating.WithBufferSize(4096),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	logger := slog.New(slogrotate.New(f, &slogrotate.Options{
+		FlushLevel: slog.LevelError,
+	})).With("app", "test")
+
+	logger.Info("buffered")
+	if !assert.NotZero(t, f.Buffered(), `info records should be buffered`) {
+		return
+	}
+
+	logger.Error("flushed", "code", 42)
+	if !assert.Zero(t, f.Buffered(), `error records should be flushed`) {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+
+	var records []map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	for dec.More() {
+		var record map[string]interface{}
+		if !assert.NoError(t, dec.Decode(&record), `dec.Decode should succeed`) {
+			return
+		}
+		records = append(records, record)
+	}
+
+	if !assert.Len(t, records, 2, `there should be 2 records`) {
+		return
+	}
+	if !assert.Equal(t, "flushed", records[1]["msg"], `message should match`) {
+		return
+	}
+	if !assert.Equal(t, "test", records[1]["app"], `attributes should be included`) {
+		return
+	}
+}
@@ -0,0 +1,61 @@
+package rotating
+
+// Stats contains statistics about the records written through a File
+type Stats struct {
+	// Records is the number of records written to the files
+	Records int64
+	// Bytes is the number of bytes written to the files, excluding
+	// headers, footers, and markers
+	Bytes int64
+	// Rotations is the number of files that have been opened
+	Rotations int64
+	// Filtered is the number of records dropped by the filters
+	// specified by WithFilter
+	Filtered int64
+	// RateLimited is the number of records dropped because they
+	// exceeded the rate limit specified by WithRateLimit
+	RateLimited int64
+	// Oversized is the number of records that exceeded the size
+	// specified by WithMaxRecordSize
+	Oversized int64
+	// CircuitOpen is the number of records that were rejected because
+	// the circuit breaker specified by WithCircuitBreaker was open
+	CircuitOpen int64
+	// Fallback is the number of records written to the fallback writer
+	// specified by WithFallback
+	Fallback int64
+	// MirrorDropped is the number of writes to the mirror specified by
+	// WithMirror that were dropped because the mirror could not keep up
+	MirrorDropped int64
+	// QuotaSuppressed is the number of records dropped because they
+	// exceeded the quota specified by WithSlotQuota
+	QuotaSuppressed int64
+	// DiskFullDropped is the number of bytes dropped because the disk
+	// was full, as specified by WithDropOnDiskFull
+	DiskFullDropped int64
+	// DiskFullEpisodes is the number of times that the File started
+	// dropping data because the disk was full
+	DiskFullEpisodes int64
+}
+
+// Stats returns a snapshot of the statistics for this File
+func (f *File) Stats() Stats {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.stats
+}
+
+func (s *Stats) add(o Stats) {
+	s.Records += o.Records
+	s.Bytes += o.Bytes
+	s.Rotations += o.Rotations
+	s.Filtered += o.Filtered
+	s.RateLimited += o.RateLimited
+	s.Oversized += o.Oversized
+	s.CircuitOpen += o.CircuitOpen
+	s.Fallback += o.Fallback
+	s.MirrorDropped += o.MirrorDropped
+	s.QuotaSuppressed += o.QuotaSuppressed
+	s.DiskFullDropped += o.DiskFullDropped
+	s.DiskFullEpisodes += o.DiskFullEpisodes
+}
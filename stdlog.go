@@ -0,0 +1,18 @@
+package rotating
+
+import (
+	"context"
+	"log"
+)
+
+// NewStdLogger creates a File using the same arguments as NewFile, and
+// a standard library logger that writes to it, using log.LstdFlags and
+// no prefix. Both are returned, so that the caller can change the
+// logger's settings, and Close the File when done.
+func NewStdLogger(ctx context.Context, p string, options ...Option) (*log.Logger, *File, error) {
+	f, err := NewFile(ctx, p, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return log.New(f, "", log.LstdFlags), f, nil
+}
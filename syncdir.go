@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package rotating
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// syncDir persists the entries of the given directory
+func syncDir(dir string) error {
+	fh, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrapf(err, `failed to open directory %s`, dir)
+	}
+	defer fh.Close()
+
+	if err := fh.Sync(); err != nil {
+		return errors.Wrapf(err, `failed to sync directory %s`, dir)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package rotating
+
+// syncDir is a no-op on Windows, where directories cannot be synced
+func syncDir(_ string) error {
+	return nil
+}
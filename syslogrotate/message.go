@@ -0,0 +1,158 @@
+package syslogrotate
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// Message is a parsed syslog message
+type Message struct {
+	Facility  int
+	Severity  int
+	Timestamp time.Time
+	Hostname  string
+	// AppName, ProcID, MsgID, and StructuredData are only populated
+	// for RFC5424 messages
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData string
+	// Content is the free form part of the message. For RFC3164
+	// messages, it includes the tag
+	Content string
+	// Raw is the message without the priority
+	Raw []byte
+}
+
+// FacilityName returns the name of the facility (e.g. "daemon", "local0")
+func (m *Message) FacilityName() string {
+	if m.Facility >= 0 && m.Facility < len(facilityNames) {
+		return facilityNames[m.Facility]
+	}
+	return strconv.Itoa(m.Facility)
+}
+
+// Parse parses a single RFC3164 or RFC5424 message
+func Parse(b []byte) (*Message, error) {
+	b = bytes.TrimRight(b, "\r\n\x00")
+	if len(b) < 3 || b[0] != '<' {
+		return nil, errors.New(`syslogrotate: missing priority`)
+	}
+	end := bytes.IndexByte(b, '>')
+	if end < 2 || end > 4 {
+		return nil, errors.New(`syslogrotate: invalid priority`)
+	}
+	pri, err := strconv.Atoi(string(b[1:end]))
+	if err != nil || pri > 191 {
+		return nil, errors.New(`syslogrotate: invalid priority`)
+	}
+
+	m := &Message{
+		Facility: pri / 8,
+		Severity: pri % 8,
+		Raw:      b[end+1:],
+	}
+	rest := string(m.Raw)
+	if strings.HasPrefix(rest, "1 ") {
+		if err := parse5424(m, rest[2:]); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	parse3164(m, rest)
+	return m, nil
+}
+
+// parse3164 parses the part of an RFC3164 message after the priority.
+// RFC3164 only describes the conventional format, so messages that do
+// not conform to it are accepted, and stored in Content as is
+func parse3164(m *Message, s string) {
+	if len(s) >= len(time.Stamp) {
+		if t, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], time.Local); err == nil {
+			// The year is not part of the timestamp
+			now := time.Now()
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			m.Timestamp = t
+			s = strings.TrimPrefix(s[len(time.Stamp):], " ")
+			if i := strings.IndexByte(s, ' '); i > 0 {
+				m.Hostname = s[:i]
+				s = s[i+1:]
+			}
+		}
+	}
+	m.Content = s
+}
+
+// parse5424 parses the part of an RFC5424 message after the version
+func parse5424(m *Message, s string) error {
+	var fields [5]string
+	for i := range fields {
+		j := strings.IndexByte(s, ' ')
+		if j < 0 {
+			return errors.New(`syslogrotate: truncated RFC5424 header`)
+		}
+		fields[i] = nilValue(s[:j])
+		s = s[j+1:]
+	}
+	if fields[0] != "" {
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return errors.Wrap(err, `syslogrotate: invalid timestamp`)
+		}
+		m.Timestamp = t
+	}
+	m.Hostname = fields[1]
+	m.AppName = fields[2]
+	m.ProcID = fields[3]
+	m.MsgID = fields[4]
+
+	// Structured data is either "-", or one or more [...] elements, in
+	// which "]" may be escaped with a backslash
+	switch {
+	case strings.HasPrefix(s, "-"):
+		s = s[1:]
+	case strings.HasPrefix(s, "["):
+		i := 0
+		for i < len(s) && s[i] == '[' {
+			i++
+			for i < len(s) && s[i] != ']' {
+				if s[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(s) {
+				return errors.New(`syslogrotate: unterminated structured data`)
+			}
+			i++
+		}
+		m.StructuredData = s[:i]
+		s = s[i:]
+	default:
+		return errors.New(`syslogrotate: invalid structured data`)
+	}
+
+	s = strings.TrimPrefix(s, " ")
+	m.Content = strings.TrimPrefix(s, "\xef\xbb\xbf")
+	return nil
+}
+
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,310 @@
+// Package syslogrotate provides a minimal syslog server that writes the
+// messages it receives to rotating files. It listens on UDP, TCP, or
+// unix sockets, accepts both RFC3164 and RFC5424 messages, and can write
+// to a separate file per facility and/or per host:
+//
+//	s := syslogrotate.New(ctx, "/var/log/remote/{host}/{facility}-%Y%m%d.log", rotating.WithRotationCount(7))
+//	go s.ListenAndServe("udp", ":514")
+//	defer s.Close()
+package syslogrotate
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+)
+
+const (
+	// HostPlaceholder is replaced with the host name in the pattern
+	HostPlaceholder = "{host}"
+	// FacilityPlaceholder is replaced with the facility name in the pattern
+	FacilityPlaceholder = "{facility}"
+
+	maxPacketSize = 64 * 1024
+)
+
+// Server receives syslog messages, and writes them to rotating files.
+// Each message is written without its priority, followed by a newline
+type Server struct {
+	// ErrorHandler, if set, is called with messages that could not be
+	// parsed or written, and with errors on individual connections.
+	// It must be set before the server starts serving
+	ErrorHandler func(error)
+
+	ctx     context.Context
+	pattern string
+	options []rotating.Option
+
+	mu      sync.Mutex
+	files   map[string]*rotating.File
+	closers map[io.Closer]struct{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// New creates a new Server. The pattern may contain HostPlaceholder and
+// FacilityPlaceholder, in which case a separate file is created for each
+// host and/or facility. The options are passed to each file
+func New(ctx context.Context, pattern string, options ...rotating.Option) *Server {
+	return &Server{
+		ctx:     ctx,
+		pattern: pattern,
+		options: options,
+		files:   make(map[string]*rotating.File),
+		closers: make(map[io.Closer]struct{}),
+	}
+}
+
+// ListenAndServe listens on the given network ("udp", "tcp", "unixgram",
+// "unix", ...) and address, and serves until the server is closed
+func (s *Server) ListenAndServe(network, address string) error {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		c, err := net.ListenPacket(network, address)
+		if err != nil {
+			return errors.Wrapf(err, `syslogrotate: failed to listen on %s %s`, network, address)
+		}
+		return s.ServePacket(c)
+	case "tcp", "tcp4", "tcp6", "unix":
+		l, err := net.Listen(network, address)
+		if err != nil {
+			return errors.Wrapf(err, `syslogrotate: failed to listen on %s %s`, network, address)
+		}
+		return s.Serve(l)
+	default:
+		return errors.Errorf(`syslogrotate: unsupported network %q`, network)
+	}
+}
+
+// ServePacket reads messages from c, one message per datagram, until the
+// server is closed
+func (s *Server) ServePacket(c net.PacketConn) error {
+	if !s.track(c) {
+		c.Close()
+		return errors.New(`syslogrotate: server closed`)
+	}
+	defer s.untrack(c)
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := c.ReadFrom(buf)
+		if n > 0 {
+			if err := s.Handle(buf[:n], addr); err != nil {
+				s.handleError(err)
+			}
+		}
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return errors.Wrap(err, `syslogrotate: failed to read`)
+		}
+	}
+}
+
+// Serve accepts stream connections from l until the server is closed.
+// Messages are framed either with octet counting (RFC6587) or with
+// newlines, which is detected per message
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l) {
+		l.Close()
+		return errors.New(`syslogrotate: server closed`)
+	}
+	defer s.untrack(l)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return errors.Wrap(err, `syslogrotate: failed to accept`)
+		}
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+
+		go func() {
+			defer s.untrack(conn)
+			defer conn.Close()
+			if err := s.serveConn(conn); err != nil && !s.isClosed() {
+				s.handleError(err)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) error {
+	rdr := bufio.NewReader(conn)
+	for {
+		msg, err := readFrame(rdr)
+		if len(msg) > 0 {
+			if err := s.Handle(msg, conn.RemoteAddr()); err != nil {
+				s.handleError(err)
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Wrap(err, `syslogrotate: failed to read`)
+		}
+	}
+}
+
+// readFrame reads a single message from a stream
+func readFrame(rdr *bufio.Reader) ([]byte, error) {
+	b, err := rdr.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] < '1' || b[0] > '9' {
+		return rdr.ReadBytes('\n')
+	}
+
+	// Octet counting: MSG-LEN SP SYSLOG-MSG
+	prefix, err := rdr.ReadString(' ')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+	if err != nil || n > maxPacketSize {
+		return nil, errors.Errorf(`invalid message length %q`, prefix)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(rdr, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Handle parses a single message, and writes it to the corresponding
+// file. addr is used as the host name for messages that do not have one,
+// and may be nil
+func (s *Server) Handle(b []byte, addr net.Addr) error {
+	msg, err := Parse(b)
+	if err != nil {
+		return err
+	}
+
+	host := msg.Hostname
+	if host == "" && addr != nil {
+		host = addr.String()
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+
+	f, err := s.file(host, msg.FacilityName())
+	if err != nil {
+		return err
+	}
+
+	record := make([]byte, 0, len(msg.Raw)+1)
+	record = append(record, msg.Raw...)
+	record = append(record, '\n')
+	if _, err := f.Write(record); err != nil {
+		return errors.Wrap(err, `syslogrotate: failed to write message`)
+	}
+	return nil
+}
+
+// file returns the file for the given host and facility, creating it
+// if necessary
+func (s *Server) file(host, facility string) (*rotating.File, error) {
+	pattern := s.pattern
+	pattern = strings.Replace(pattern, HostPlaceholder, label(host), -1)
+	pattern = strings.Replace(pattern, FacilityPlaceholder, label(facility), -1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, errors.New(`syslogrotate: server closed`)
+	}
+	if f, ok := s.files[pattern]; ok {
+		return f, nil
+	}
+
+	f, err := rotating.NewFile(s.ctx, pattern, s.options...)
+	if err != nil {
+		return nil, errors.Wrap(err, `syslogrotate: failed to create file`)
+	}
+	s.files[pattern] = f
+	return f, nil
+}
+
+// label makes s safe to be used as a part of a pattern
+func label(s string) string {
+	if s == "" || s == "." || s == ".." {
+		return "unknown"
+	}
+	s = strings.NewReplacer("/", "_", `\`, "_").Replace(s)
+	return strings.Replace(s, `%`, `%%`, -1)
+}
+
+// Close stops the server, waits for the connections to be closed, and
+// closes all of the files
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for c := range s.closers {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for _, f := range s.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// track registers c to be closed by Close, which then waits until
+// untrack is called for it
+func (s *Server) track(c io.Closer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.closers[c] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(c io.Closer) {
+	s.mu.Lock()
+	delete(s.closers, c)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) handleError(err error) {
+	if h := s.ErrorHandler; h != nil {
+		h(err)
+	}
+}
@@ -0,0 +1,161 @@
+package syslogrotate_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating/syslogrotate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("RFC5424", func(t *testing.T) {
+		msg, err := syslogrotate.Parse([]byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventID="1011\]"] An application event log entry...`))
+		if !assert.NoError(t, err, `syslogrotate.Parse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, 20, msg.Facility, `facility should match`) {
+			return
+		}
+		if !assert.Equal(t, "local4", msg.FacilityName(), `facility name should match`) {
+			return
+		}
+		if !assert.Equal(t, 5, msg.Severity, `severity should match`) {
+			return
+		}
+		if !assert.Equal(t, time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC), msg.Timestamp.UTC(), `timestamp should match`) {
+			return
+		}
+		if !assert.Equal(t, "mymachine.example.com", msg.Hostname, `hostname should match`) {
+			return
+		}
+		if !assert.Equal(t, "evntslog", msg.AppName, `app name should match`) {
+			return
+		}
+		if !assert.Equal(t, "", msg.ProcID, `proc id should match`) {
+			return
+		}
+		if !assert.Equal(t, "ID47", msg.MsgID, `msg id should match`) {
+			return
+		}
+		if !assert.Equal(t, `[exampleSDID@32473 iut="3" eventID="1011\]"]`, msg.StructuredData, `structured data should match`) {
+			return
+		}
+		if !assert.Equal(t, "An application event log entry...", msg.Content, `content should match`) {
+			return
+		}
+	})
+	t.Run("RFC3164", func(t *testing.T) {
+		msg, err := syslogrotate.Parse([]byte("<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8\n"))
+		if !assert.NoError(t, err, `syslogrotate.Parse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, "auth", msg.FacilityName(), `facility name should match`) {
+			return
+		}
+		if !assert.Equal(t, 2, msg.Severity, `severity should match`) {
+			return
+		}
+		if !assert.Equal(t, "mymachine", msg.Hostname, `hostname should match`) {
+			return
+		}
+		if !assert.Equal(t, "su: 'su root' failed for lonvick on /dev/pts/8", msg.Content, `content should match`) {
+			return
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		for _, src := range []string{"", "hello", "<999>hello", "<13>1 2003-10-11T22:14:15Z host"} {
+			if _, err := syslogrotate.Parse([]byte(src)); !assert.Error(t, err, `syslogrotate.Parse should fail for %q`, src) {
+				return
+			}
+		}
+	})
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslogrotate-")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := syslogrotate.New(ctx, filepath.Join(dir, "{host}", "{facility}.log"))
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err, `net.ListenPacket should succeed`) {
+		return
+	}
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err, `net.Listen should succeed`) {
+		return
+	}
+
+	served := make(chan error, 2)
+	go func() { served <- s.ServePacket(udp) }()
+	go func() { served <- s.Serve(tcp) }()
+
+	uconn, err := net.Dial("udp", udp.LocalAddr().String())
+	if !assert.NoError(t, err, `net.Dial should succeed`) {
+		return
+	}
+	defer uconn.Close()
+	fmt.Fprintf(uconn, "<13>Oct 11 22:14:15 web1 app: from udp")
+
+	tconn, err := net.Dial("tcp", tcp.Addr().String())
+	if !assert.NoError(t, err, `net.Dial should succeed`) {
+		return
+	}
+	// Both newline and octet counting framing
+	fmt.Fprintf(tconn, "<13>Oct 11 22:14:15 web1 app: from tcp\n")
+	msg := "<30>1 2003-10-11T22:14:15Z web2 app - - - framed"
+	fmt.Fprintf(tconn, "%d %s", len(msg), msg)
+	tconn.Close()
+
+	expected := map[string]string{
+		filepath.Join("web1", "user.log"):   "Oct 11 22:14:15 web1 app: from udp\nOct 11 22:14:15 web1 app: from tcp\n",
+		filepath.Join("web2", "daemon.log"): "1 2003-10-11T22:14:15Z web2 app - - - framed\n",
+	}
+	assert.Eventually(t, func() bool {
+		for name, want := range expected {
+			content, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil || len(content) != len(want) {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond, `messages should be written`)
+
+	if !assert.NoError(t, s.Close(), `s.Close should succeed`) {
+		return
+	}
+	for i := 0; i < 2; i++ {
+		if !assert.NoError(t, <-served, `serving should stop without errors`) {
+			return
+		}
+	}
+
+	for name, want := range expected {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		// UDP and TCP messages may arrive in any order
+		if !assert.ElementsMatch(t, splitLines(want), splitLines(string(content)), `content of %s should match`, name) {
+			return
+		}
+	}
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
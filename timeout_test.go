@@ -0,0 +1,67 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package rotating_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperationTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating_test-OperationTimeout")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Opening a FIFO for writing blocks until somebody opens it for
+	// reading, which allows us to simulate a hung file system
+	fn := filepath.Join(dir, "20210101-000000.log")
+	if !assert.NoError(t, syscall.Mkfifo(fn, 0644), `syscall.Mkfifo should succeed`) {
+		return
+	}
+	defer func() {
+		// unblock the abandoned open
+		if fh, err := os.OpenFile(fn, os.O_RDONLY|syscall.O_NONBLOCK, 0); err == nil {
+			fh.Close()
+		}
+	}()
+
+	clock := NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	f, err := rotating.NewFile(
+		ctx,
+		filepath.Join(dir, "%Y%m%d-%H%M%S.log"),
+		rotating.WithClock(clock),
+		rotating.WithOperationTimeout(100*time.Millisecond),
+	)
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer f.Close()
+
+	_, err = f.Write([]byte("Hello, World\n"))
+	if !assert.Error(t, err, `f.Write should fail`) {
+		return
+	}
+
+	var terr *rotating.TimeoutError
+	if !assert.True(t, errors.As(err, &terr), `error should be a *rotating.TimeoutError`) {
+		return
+	}
+	if !assert.Equal(t, `open`, terr.Op, `operation should match`) {
+		return
+	}
+}
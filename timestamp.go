@@ -0,0 +1,60 @@
+package rotating
+
+import (
+	"strconv"
+	"time"
+)
+
+// Special layouts for TimestampWriter, which format the timestamp as the
+// number of seconds or milliseconds elapsed since the Unix epoch
+const (
+	TimestampUnix      = "unix"
+	TimestampUnixMilli = "unixmilli"
+)
+
+// TimestampWriter is a thin wrapper around a File that prepends a
+// timestamp to each record. The timestamp is taken from the Clock that
+// the File was configured with, so that it is consistent with the times
+// used for rotation.
+//
+// It is meant to be used with loggers that do not generate timestamps
+// by themselves, e.g. `log.New(rotating.NewTimestampWriter(f, time.RFC3339), "", 0)`.
+type TimestampWriter struct {
+	file   *File
+	layout string
+}
+
+// NewTimestampWriter creates a new TimestampWriter that formats the
+// timestamp using the given layout, as understood by time.Time.Format.
+// TimestampUnix and TimestampUnixMilli may be used to write the time
+// elapsed since the Unix epoch instead.
+func NewTimestampWriter(f *File, layout string) *TimestampWriter {
+	return &TimestampWriter{
+		file:   f,
+		layout: layout,
+	}
+}
+
+// Write writes p to the underlying File, prefixed with the current
+// timestamp and a single space. The timestamp and p are written as a
+// single record.
+func (w *TimestampWriter) Write(p []byte) (int, error) {
+	ts := w.format(w.file.clock.Now())
+	ts = append(ts, ' ')
+	if _, err := w.file.WriteVec([][]byte{ts, p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *TimestampWriter) format(t time.Time) []byte {
+	buf := make([]byte, 0, 32)
+	switch w.layout {
+	case TimestampUnix:
+		return strconv.AppendInt(buf, t.Unix(), 10)
+	case TimestampUnixMilli:
+		return strconv.AppendInt(buf, t.UnixNano()/int64(time.Millisecond), 10)
+	default:
+		return t.AppendFormat(buf, w.layout)
+	}
+}
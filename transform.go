@@ -0,0 +1,33 @@
+package rotating
+
+// Transformer is a function that transforms a record before it is
+// written to the file. It receives the complete record, and returns the
+// data that should be written in its place. The input must not be
+// modified nor retained after the function returns.
+type Transformer func([]byte) []byte
+
+// transform applies the transformers to rec, in the order that they
+// were specified
+func (f *File) transform(rec []byte) []byte {
+	for _, t := range f.transformers {
+		rec = t(rec)
+	}
+	return rec
+}
+
+// joinBuffers concatenates bufs into a single record
+func joinBuffers(bufs [][]byte) []byte {
+	if len(bufs) == 1 {
+		return bufs[0]
+	}
+
+	var size int
+	for _, buf := range bufs {
+		size += len(buf)
+	}
+	rec := make([]byte, 0, size)
+	for _, buf := range bufs {
+		rec = append(rec, buf...)
+	}
+	return rec
+}
@@ -0,0 +1,47 @@
+package rotating
+
+// TruncationPolicy specifies what happens when the active file is found
+// to have been truncated by another process (e.g. by a "copytruncate"
+// style log rotation)
+type TruncationPolicy int
+
+const (
+	// TruncationIgnore does not check for truncation
+	TruncationIgnore TruncationPolicy = iota
+	// TruncationReport reports the truncation to the error handler, and
+	// keeps writing to the same file handle
+	TruncationReport
+	// TruncationReopen reports the truncation, and reopens the file
+	TruncationReopen
+	// TruncationRotate reports the truncation, and rotates to a new file
+	TruncationRotate
+)
+
+// checkTruncation compares the size of the active file against the
+// amount of data that is known to have been written to it. It returns
+// true if the file should be rotated.
+// It must be called while holding the lock
+func (f *File) checkTruncation(size int64) bool {
+	expected := f.expectedSize
+	f.expectedSize = size
+	if f.truncation == TruncationIgnore || expected < 0 || size >= expected {
+		return false
+	}
+
+	f.handleError(&TruncationError{
+		Path:     f.filename,
+		Expected: expected,
+		Actual:   size,
+	})
+
+	switch f.truncation {
+	case TruncationReopen:
+		if f.file != nil {
+			_ = finalizeWriter(f.file)
+			f.file = nil
+		}
+	case TruncationRotate:
+		return true
+	}
+	return false
+}
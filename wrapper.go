@@ -0,0 +1,60 @@
+package rotating
+
+import "io"
+
+// WriterWrapper decorates the writer for a newly opened file, e.g. with
+// a buffering, encrypting, or metering writer. It receives the writer
+// for the file and the name of the file, and returns the writer that
+// the data should be written to. See WithWriterWrapper
+type WriterWrapper func(w io.Writer, filename string) io.Writer
+
+// wrappedWriter pairs the writer returned by a WriterWrapper with the
+// writer that it wraps, so that the lifecycle of both can be managed
+type wrappedWriter struct {
+	io.Writer
+	dst io.Writer
+}
+
+// Unwrap returns the underlying writer
+func (w *wrappedWriter) Unwrap() io.Writer {
+	return w.dst
+}
+
+// Buffered returns the number of bytes buffered by the underlying writer
+func (w *wrappedWriter) Buffered() int {
+	if v, ok := w.dst.(interface{ Buffered() int }); ok {
+		return v.Buffered()
+	}
+	return 0
+}
+
+// Flush flushes the decorating writer, followed by the underlying writer
+func (w *wrappedWriter) Flush() error {
+	if err := flushWriter(w.Writer); err != nil {
+		return err
+	}
+	return flushWriter(w.dst)
+}
+
+func (w *wrappedWriter) Sync() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if v, ok := w.dst.(interface{ Sync() error }); ok {
+		return v.Sync()
+	}
+	return nil
+}
+
+// Close closes the decorating writer, so that it can write out any
+// trailing data, and then finalizes the underlying writer
+func (w *wrappedWriter) Close() error {
+	var cerr error
+	if v, ok := w.Writer.(io.Closer); ok {
+		cerr = v.Close()
+	}
+	if err := finalizeWriter(w.dst); err != nil && cerr == nil {
+		cerr = err
+	}
+	return cerr
+}
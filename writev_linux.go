@@ -0,0 +1,70 @@
+//go:build linux
+// +build linux
+
+package rotating
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxIovecs is the maximum number of buffers we pass to a single
+// writev(2) call. Linux defines IOV_MAX as 1024
+const maxIovecs = 1024
+
+func writeVec(w io.Writer, bufs [][]byte) (int64, error) {
+	fh, ok := w.(*os.File)
+	if !ok {
+		return writeVecGeneric(w, bufs)
+	}
+
+	rc, err := fh.SyscallConn()
+	if err != nil {
+		return writeVecGeneric(w, bufs)
+	}
+
+	var written int64
+	var copied bool
+	for len(bufs) > 0 {
+		chunk := bufs
+		if len(chunk) > maxIovecs {
+			chunk = chunk[:maxIovecs]
+		}
+
+		var n int
+		var werr error
+		if err := rc.Write(func(fd uintptr) bool {
+			n, werr = unix.Writev(int(fd), chunk)
+			return werr != unix.EAGAIN
+		}); err != nil {
+			return written, err
+		}
+		if werr != nil {
+			return written, &os.PathError{Op: "writev", Path: fh.Name(), Err: werr}
+		}
+		written += int64(n)
+
+		// writev(2) may write less than what we asked for, so skip
+		// over the buffers (or parts of buffers) that have been consumed
+		for n > 0 && len(bufs) > 0 {
+			if l := len(bufs[0]); n >= l {
+				n -= l
+				bufs = bufs[1:]
+				continue
+			}
+			// Don't modify the caller's slice
+			if !copied {
+				bufs = append([][]byte(nil), bufs...)
+				copied = true
+			}
+			bufs[0] = bufs[0][n:]
+			n = 0
+		}
+		for len(bufs) > 0 && len(bufs[0]) == 0 {
+			bufs = bufs[1:]
+		}
+	}
+	return written, nil
+}
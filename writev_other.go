@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package rotating
+
+import "io"
+
+func writeVec(w io.Writer, bufs [][]byte) (int64, error) {
+	return writeVecGeneric(w, bufs)
+}
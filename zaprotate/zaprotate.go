@@ -0,0 +1,143 @@
+// Package zaprotate registers a zap sink for the "rotating" URL scheme,
+// so that zap can be configured to write to rotating files through its
+// configuration alone:
+//
+//	import _ "github.com/lestrrat-go/rotating/zaprotate"
+//
+//	cfg := zap.NewProductionConfig()
+//	cfg.OutputPaths = []string{"rotating:///var/log/app/%25Y%25m%25d.log?maxsize=100MB&keep=7"}
+//
+// As the output paths are parsed as URLs, the "%" characters in the
+// strftime pattern must be escaped as "%25".
+package zaprotate
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Scheme is the URL scheme that the sink is registered for
+const Scheme = `rotating`
+
+func init() {
+	if err := zap.RegisterSink(Scheme, NewSink); err != nil {
+		panic(errors.Wrapf(err, `zaprotate: failed to register sink for scheme %q`, Scheme))
+	}
+}
+
+// Sink is a zap.Sink that writes to a *rotating.File
+type Sink struct {
+	*rotating.File
+}
+
+// Sync flushes the buffered data to the file, and syncs the file to
+// stable storage
+func (s *Sink) Sync() error {
+	return s.File.Sync()
+}
+
+// NewSink creates a Sink from a URL of the form
+// `rotating:///path/to/%25Y%25m%25d.log?maxsize=100MB&keep=7`. The
+// following query parameters are recognized:
+//
+//	maxsize   maximum size of each file (e.g. 1048576, 512KB, 100MB, 1GB)
+//	keep      number of files to retain
+//	interval  interval between rotations (e.g. 1h, 24h)
+//	symlink   path of the symlink to the current file
+//	buffer    size of the write buffer (e.g. 64KB)
+//	utc       use UTC instead of the local time for file names (true/false)
+func NewSink(u *url.URL) (zap.Sink, error) {
+	if u.Path == "" {
+		return nil, errors.Errorf(`zaprotate: missing file name pattern in %q`, u.String())
+	}
+	if u.Host != "" {
+		return nil, errors.Errorf(`zaprotate: unexpected host %q (use three slashes for absolute paths)`, u.Host)
+	}
+
+	var options []rotating.Option
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		switch key {
+		case "maxsize":
+			size, err := parseSize(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, `zaprotate: invalid value for %s`, key)
+			}
+			options = append(options, rotating.WithMaxFileSize(size))
+		case "keep":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, `zaprotate: invalid value for %s`, key)
+			}
+			options = append(options, rotating.WithRotationCount(count))
+		case "interval":
+			interval, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, `zaprotate: invalid value for %s`, key)
+			}
+			options = append(options, rotating.WithMaxInterval(interval))
+		case "symlink":
+			options = append(options, rotating.WithSymlink(value))
+		case "buffer":
+			size, err := parseSize(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, `zaprotate: invalid value for %s`, key)
+			}
+			options = append(options, rotating.WithBufferSize(int(size)))
+		case "utc":
+			utc, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, `zaprotate: invalid value for %s`, key)
+			}
+			if utc {
+				options = append(options, rotating.WithClock(rotating.UTC()))
+			}
+		default:
+			return nil, errors.Errorf(`zaprotate: unknown parameter %q`, key)
+		}
+	}
+
+	// zap closes the sink when it is no longer needed, which is when
+	// the file should stop being used
+	f, err := rotating.NewFile(context.Background(), u.Path, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, `zaprotate: failed to create file`)
+	}
+	return &Sink{File: f}, nil
+}
+
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"B", 1},
+}
+
+// parseSize parses sizes such as "100MB". Units are powers of 1024
+func parseSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(v, unit.suffix) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, `invalid size %q`, s)
+	}
+	return n * multiplier, nil
+}
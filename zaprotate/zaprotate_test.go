@@ -0,0 +1,67 @@
+package zaprotate_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/lestrrat-go/rotating/zaprotate"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zaprotate_test")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	u := url.URL{
+		Scheme:   "rotating",
+		Path:     filepath.Join(dir, "%Y%m%d.log"),
+		RawQuery: "maxsize=100MB&keep=7&buffer=4KB&utc=true",
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.OutputPaths = []string{u.String()}
+	cfg.ErrorOutputPaths = []string{"stderr"}
+	logger, err := cfg.Build()
+	if !assert.NoError(t, err, `cfg.Build should succeed`) {
+		return
+	}
+
+	logger.Info("Hello, World", zap.Int("code", 42))
+	if !assert.NoError(t, logger.Sync(), `logger.Sync should succeed`) {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, time.Now().UTC().Format("20060102")+".log"))
+	if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+		return
+	}
+
+	var record map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(buf, &record), `json.Unmarshal should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "Hello, World", record["msg"], `message should match`) {
+		return
+	}
+	if !assert.Equal(t, float64(42), record["code"], `field should match`) {
+		return
+	}
+}
+
+func TestSinkInvalidParameter(t *testing.T) {
+	cfg := zap.NewProductionConfig()
+	cfg.OutputPaths = []string{"rotating:///tmp/%25Y%25m%25d.log?unknown=1"}
+	_, err := cfg.Build()
+	if !assert.Error(t, err, `cfg.Build should fail`) {
+		return
+	}
+}
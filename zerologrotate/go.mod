@@ -0,0 +1,11 @@
+module github.com/lestrrat-go/rotating/zerologrotate
+
+go 1.16
+
+require (
+	github.com/lestrrat-go/rotating v0.0.0-00010101000000-000000000000
+	github.com/rs/zerolog v1.29.1
+	github.com/stretchr/testify v1.6.1
+)
+
+replace github.com/lestrrat-go/rotating => ../
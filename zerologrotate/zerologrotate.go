@@ -0,0 +1,54 @@
+// Package zerologrotate provides a zerolog.LevelWriter that writes log
+// events to rotating files, optionally using a separate file for each
+// level.
+package zerologrotate
+
+import (
+	"github.com/lestrrat-go/rotating"
+	"github.com/rs/zerolog"
+)
+
+// LevelWriter is a zerolog.LevelWriter that writes events to rotating
+// files. zerolog writes each event using a single call to Write, which
+// *rotating.File treats as a single record, so events are never split
+// nor interleaved, and never straddle two files.
+type LevelWriter struct {
+	files       map[zerolog.Level]*rotating.File
+	defaultFile *rotating.File
+}
+
+// New creates a LevelWriter that writes events of all levels to f
+func New(f *rotating.File) *LevelWriter {
+	return NewLevelWriter(nil, f)
+}
+
+// NewLevelWriter creates a LevelWriter that writes events of each level
+// to the corresponding file. Events of levels that are not in files, as
+// well as events written without a level, are written to defaultFile.
+// If defaultFile is nil, such events are discarded.
+func NewLevelWriter(files map[zerolog.Level]*rotating.File, defaultFile *rotating.File) *LevelWriter {
+	m := make(map[zerolog.Level]*rotating.File, len(files))
+	for level, f := range files {
+		m[level] = f
+	}
+	return &LevelWriter{
+		files:       m,
+		defaultFile: defaultFile,
+	}
+}
+
+// Write writes an event without a level to the default file
+func (w *LevelWriter) Write(p []byte) (int, error) {
+	if w.defaultFile == nil {
+		return len(p), nil
+	}
+	return w.defaultFile.Write(p)
+}
+
+// WriteLevel writes an event to the file for the given level
+func (w *LevelWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if f, ok := w.files[level]; ok {
+		return f.Write(p)
+	}
+	return w.Write(p)
+}
@@ -0,0 +1,60 @@
+package zerologrotate_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/rotating"
+	"github.com/lestrrat-go/rotating/zerologrotate"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zerologrotate_test")
+	if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	app, err := rotating.NewFile(ctx, filepath.Join(dir, "app.log"))
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer app.Close()
+
+	errs, err := rotating.NewFile(ctx, filepath.Join(dir, "error.log"))
+	if !assert.NoError(t, err, `rotating.NewFile should succeed`) {
+		return
+	}
+	defer errs.Close()
+
+	logger := zerolog.New(zerologrotate.NewLevelWriter(map[zerolog.Level]*rotating.File{
+		zerolog.ErrorLevel: errs,
+	}, app))
+
+	logger.Info().Msg("Hello, World")
+	logger.Error().Int("code", 42).Msg("Goodbye, World")
+	logger.Log().Msg("no level")
+
+	expected := map[string]string{
+		"app.log":   `{"level":"info","message":"Hello, World"}` + "\n" + `{"message":"no level"}` + "\n",
+		"error.log": `{"level":"error","code":42,"message":"Goodbye, World"}` + "\n",
+	}
+	for name, content := range expected {
+		buf, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if !assert.NoError(t, err, `ioutil.ReadFile should succeed`) {
+			return
+		}
+		if !assert.Equal(t, content, string(buf), `contents of %s should match`, name) {
+			return
+		}
+	}
+}